@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/supergiant/supergiant/common"
+	"github.com/supergiant/supergiant/core"
+)
+
+// The passphrase used to encrypt (on export) and decrypt (on import) private
+// fields. It is a header so that it does not end up in access logs.
+const archivePassphraseHeader = "X-Archive-Passphrase"
+
+type AdminController struct {
+	core *core.Core
+}
+
+type importResult struct {
+	Mode    string `json:"mode"`
+	Records int    `json:"records"`
+}
+
+// Export renders an Archive of every stored record.
+func (c *AdminController) Export(w http.ResponseWriter, r *http.Request) {
+	archive, err := c.core.Export(r.Header.Get(archivePassphraseHeader))
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	body, err := marshalBody(w, archive)
+	if err != nil {
+		return
+	}
+	filename := fmt.Sprintf("supergiant-%s.json", time.Now().UTC().Format("20060102150405"))
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	renderWithStatusOK(w, body)
+}
+
+// Import restores an Archive into an empty store. With ?mode=records (the
+// default) only the records are restored; with ?mode=provision the Kubernetes
+// Namespaces, Services, and Secrets are created as well.
+func (c *AdminController) Import(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	switch mode {
+	case "":
+		mode = "records"
+	case "records", "provision":
+	default:
+		renderError(w, errors.New("mode must be records or provision"), http.StatusBadRequest)
+		return
+	}
+
+	archive := new(common.Archive)
+	if err := unmarshalBodyInto(w, r, archive); err != nil {
+		return
+	}
+
+	n, err := c.core.Import(archive, r.Header.Get(archivePassphraseHeader), mode == "provision")
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	body, err := marshalBody(w, &importResult{mode, n})
+	if err != nil {
+		return
+	}
+	renderWithStatusCreated(w, body)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/supergiant/supergiant/common"
+	"github.com/supergiant/supergiant/core"
+)
+
+// APITokenController lets Users manage their own APITokens. Install-wide
+// admins can manage the APITokens of every User.
+type APITokenController struct {
+	core *core.Core
+}
+
+// Create creates an APIToken for the requesting User, or for the User given
+// in the body. The token is only shown in this response.
+func (c *APITokenController) Create(w http.ResponseWriter, r *http.Request) {
+	token := c.core.APITokens().New()
+
+	if err := unmarshalBodyInto(w, r, token); err != nil {
+		return
+	}
+
+	core.ZeroReadonlyFields(token)
+
+	principal := requestPrincipal(r)
+	if token.User == nil {
+		token.User = common.IDString(principal.Name)
+	}
+	if !canManageAPIToken(principal, token) {
+		renderError(w, fmt.Errorf("%s cannot create APITokens for %s", principal.Name, *token.User), http.StatusForbidden)
+		return
+	}
+
+	err := c.core.APITokens().Create(token)
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	setAuditLocation(r, token)
+
+	core.ZeroPrivateFields(token)
+
+	body, err := marshalBody(w, token)
+	if err != nil {
+		return
+	}
+	renderWithStatusCreated(w, body)
+}
+
+// Index lists the APITokens of the requesting User, or of every User for
+// install-wide admins.
+func (c *APITokenController) Index(w http.ResponseWriter, r *http.Request) {
+	opts, err := listOptions(w, r)
+	if err != nil {
+		return
+	}
+	principal := requestPrincipal(r)
+	opts.Where = func(item core.Resource) bool {
+		return canManageAPIToken(principal, item.(*core.APITokenResource))
+	}
+
+	tokens, err := c.core.APITokens().ListWithOptions(opts)
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	for _, token := range tokens.Items {
+		core.ZeroPrivateFields(token)
+	}
+
+	body, err := marshalBody(w, tokens)
+	if err != nil {
+		return
+	}
+	renderWithStatusOK(w, body)
+}
+
+func (c *APITokenController) Show(w http.ResponseWriter, r *http.Request) {
+	token, err := c.loadOwnAPIToken(w, r)
+	if err != nil {
+		return
+	}
+
+	core.ZeroPrivateFields(token)
+
+	body, err := marshalBody(w, token)
+	if err != nil {
+		return
+	}
+	renderWithStatusOK(w, body)
+}
+
+// Delete revokes an APIToken.
+func (c *APITokenController) Delete(w http.ResponseWriter, r *http.Request) {
+	token, err := c.loadOwnAPIToken(w, r)
+	if err != nil {
+		return
+	}
+	if err = token.Delete(); err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+}
+
+// loadOwnAPIToken loads an APIToken the requesting Principal can manage, or
+// renders an HTTP Not Found error (so as not to tell which IDs exist).
+func (c *APITokenController) loadOwnAPIToken(w http.ResponseWriter, r *http.Request) (*core.APITokenResource, error) {
+	token, err := loadAPIToken(c.core, w, r)
+	if err != nil {
+		return nil, err
+	}
+	if !canManageAPIToken(requestPrincipal(r), token) {
+		err = fmt.Errorf("APIToken %s not found", *token.ID)
+		renderError(w, err, http.StatusNotFound)
+		return nil, err
+	}
+	return token, nil
+}
+
+func canManageAPIToken(principal *core.Principal, token *core.APITokenResource) bool {
+	if principal.Can(core.RoleAdmin, nil) {
+		return true
+	}
+	return token.User != nil && *token.User == principal.Name
+}
@@ -21,10 +21,12 @@ func (c *AppController) Create(w http.ResponseWriter, r *http.Request) {
 
 	err := c.core.Apps().Create(app)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
+	setAuditLocation(r, app)
+
 	body, err := marshalBody(w, app)
 	if err != nil {
 		return
@@ -32,10 +34,20 @@ func (c *AppController) Create(w http.ResponseWriter, r *http.Request) {
 	renderWithStatusCreated(w, body)
 }
 
+// Index lists the Apps the requesting Principal can view.
 func (c *AppController) Index(w http.ResponseWriter, r *http.Request) {
-	apps, err := c.core.Apps().List()
+	opts, err := listOptions(w, r)
+	if err != nil {
+		return
+	}
+	principal := requestPrincipal(r)
+	opts.Where = func(item core.Resource) bool {
+		return principal.Can(core.RoleViewer, item.(*core.AppResource).Name)
+	}
+
+	apps, err := c.core.Apps().ListWithOptions(opts)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -71,8 +83,15 @@ func (c *AppController) Update(w http.ResponseWriter, r *http.Request) {
 
 	core.ZeroReadonlyFields(app)
 
+	revision, err := ifMatchRevision(w, r)
+	if err != nil {
+		return
+	}
+	app.Revision = revision
+
 	if err := app.Patch(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		err = ifMatchError(err, revision)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -90,7 +109,7 @@ func (c *AppController) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := app.Action("delete").Supervise(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
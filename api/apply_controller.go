@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/supergiant/supergiant/common"
+	"github.com/supergiant/supergiant/core"
+)
+
+type ApplyController struct {
+	core *core.Core
+}
+
+// forbiddenError is returned by the authorize function of Apply when the
+// Principal cannot make a change.
+type forbiddenError struct {
+	error
+}
+
+// Apply makes the App of a Manifest, and the Resources it uses, match it. With
+// ?dry_run=true, the changes that would be made are only returned. Every
+// change needs the Role the request making it directly would need. The
+// Manifest is JSON, or YAML with a YAML Content-Type.
+func (c *ApplyController) Apply(w http.ResponseWriter, r *http.Request) {
+	manifest := new(common.Manifest)
+	if isYAMLBody(r) {
+		if err := unmarshalYAMLBodyInto(w, r, manifest); err != nil {
+			return
+		}
+	} else if err := unmarshalBodyInto(w, r, manifest); err != nil {
+		return
+	}
+
+	var dryRun bool
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			renderError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	principal := requestPrincipal(r)
+	authorize := func(change *common.ManifestChange) error {
+		method, urlPath := manifestChangeRequest(change)
+		if role, app := requiredRole(method, "/v0"+urlPath); role != "" && !principal.Can(role, app) {
+			return forbiddenError{roleError(principal, role, app)}
+		}
+		return nil
+	}
+
+	result, err := c.core.ApplyManifest(manifest, dryRun, authorize)
+	if _, forbidden := err.(forbiddenError); forbidden {
+		renderError(w, err, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	body, err := marshalBody(w, result)
+	if err != nil {
+		return
+	}
+	if dryRun {
+		renderWithStatusOK(w, body)
+		return
+	}
+	renderWithStatusAccepted(w, body)
+}
+
+// manifestChangeRequest returns the request that would make a ManifestChange
+// directly.
+func manifestChangeRequest(change *common.ManifestChange) (method string, urlPath string) {
+	switch change.Action {
+	case "create":
+		return "POST", path.Dir(change.Location)
+	case "update":
+		return "PUT", change.Location
+	case "deploy":
+		return "POST", change.Location + "/deploy"
+	default: // release
+		return "POST", change.Location
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/context"
+	"github.com/supergiant/supergiant/core"
+)
+
+// auditHandler records an AuditEntry for every request that may change
+// something, after it has been handled.
+type auditHandler struct {
+	core    *core.Core
+	handler http.Handler
+}
+
+// statusRecorder keeps the status written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// CloseNotify implements http.CloseNotifier, so that handlers streaming
+// responses (see requestContext) stop when the client disconnects. The
+// channel never receives if the ResponseWriter cannot tell.
+func (w *statusRecorder) CloseNotify() <-chan bool {
+	if notifier, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return notifier.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+// Flush implements http.Flusher, for the handlers that stream responses.
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (h *auditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST", "PUT", "PATCH", "DELETE":
+	default:
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	entry := h.core.AuditEntries().New()
+	entry.Actor = requestActor(r)
+	entry.ActionName = r.Method
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	entry.BodyDigest = bodyDigest(r.URL.Path, body)
+
+	recorder := &statusRecorder{w, http.StatusOK}
+	h.handler.ServeHTTP(recorder, r)
+
+	entry.ResourceLocation, entry.ActionName = auditLocation(r)
+	entry.Status = recorder.status
+	if recorder.status < 400 {
+		entry.Result = core.AuditResultSucceeded
+	} else {
+		entry.Result = core.AuditResultFailed
+	}
+
+	if err := h.core.AuditEntries().Create(entry); err != nil {
+		core.Log.Errorf("Could not record audit entry for %s %s: %s", r.Method, r.URL.Path, err)
+	}
+}
+
+// bodyDigest returns the SHA-256 of a request body for its AuditEntry, or an
+// empty string if there is no body. Bodies sent to Resources with private
+// fields (such as the password of a User) get no digest, since an unsalted
+// hash of a short secret can be brute-forced by anyone reading the audit log.
+func bodyDigest(path string, body []byte) string {
+	if len(body) == 0 || core.HasPrivateFields(path) {
+		return ""
+	}
+	digest := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(digest[:])
+}
+
+// setAuditLocation records the Resource a request is about, for its
+// AuditEntry. Handlers that load several Resources record each one in turn, so
+// the last (most specific) one is kept.
+func setAuditLocation(r *http.Request, resource core.Locatable) {
+	context.Set(r, auditLocationKey, core.ResourceLocation(resource))
+}
+
+// auditAction wraps the handler of an action on a Resource, such as deploy,
+// so that its AuditEntry is recorded with the action instead of the HTTP
+// method.
+func auditAction(action string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		context.Set(r, auditActionKey, action)
+		handler(w, r)
+	}
+}
+
+// auditLocation returns the location of the Resource recorded with
+// setAuditLocation, and the action taken on it (see auditAction). Requests
+// that did not get as far as loading a Resource are recorded with their path.
+func auditLocation(r *http.Request) (location string, action string) {
+	location, ok := context.Get(r, auditLocationKey).(string)
+	if !ok {
+		location = strings.TrimPrefix(r.URL.Path, "/v0")
+	}
+	action, ok = context.Get(r, auditActionKey).(string)
+	if !ok {
+		action = r.Method
+	}
+	return location, action
+}
+
+// requestActor returns the name of the Principal making the request.
+func requestActor(r *http.Request) string {
+	if principal := requestPrincipal(r); principal != nil {
+		return principal.Name
+	}
+	return "anonymous"
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/supergiant/supergiant/core"
+)
+
+// defaultAuditLimit is the number of AuditEntries listed when no ?limit= is
+// given, since the audit log only ever grows.
+const defaultAuditLimit = 100
+
+type AuditController struct {
+	core *core.Core
+}
+
+// auditFilter holds the query params of the audit Index. Zero values match
+// everything.
+type auditFilter struct {
+	prefix string
+	actor  string
+	since  time.Time
+	until  time.Time
+	before string // an AuditEntry ID
+}
+
+// Index lists AuditEntries, oldest first. It can be filtered with ?prefix= (of
+// the resource location), ?actor=, and a time range with ?since= and ?until=,
+// given in RFC 3339 (2016-04-12T03:54:56Z) or the format of timestamps in
+// responses. ?before= (an AuditEntry ID) lists only the entries recorded before
+// that one, to page back from the newest entries with ?sort=-name.
+//
+// Pages hold defaultAuditLimit entries unless ?limit= says otherwise.
+func (c *AuditController) Index(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &auditFilter{
+		prefix: query.Get("prefix"),
+		actor:  query.Get("actor"),
+		before: query.Get("before"),
+	}
+	for param, dst := range map[string]*time.Time{"since": &filter.since, "until": &filter.until} {
+		if query.Get(param) == "" {
+			continue
+		}
+		t, err := parseQueryTime(query.Get(param))
+		if err != nil {
+			renderError(w, fmt.Errorf("Invalid %s: %s", param, err), http.StatusBadRequest)
+			return
+		}
+		*dst = t
+	}
+
+	opts, err := listOptions(w, r)
+	if err != nil {
+		return
+	}
+	if query.Get("limit") == "" {
+		opts.Limit = defaultAuditLimit
+	}
+	opts.Where = func(item core.Resource) bool {
+		return filter.matches(item.(*core.AuditEntryResource))
+	}
+
+	entries, err := c.core.AuditEntries().ListWithOptions(opts)
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	body, err := marshalBody(w, entries)
+	if err != nil {
+		return
+	}
+	renderWithStatusOK(w, body)
+}
+
+func parseQueryTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		if t, rfc1123Err := time.Parse(time.RFC1123, value); rfc1123Err == nil {
+			return t, nil
+		}
+	}
+	return t, err
+}
+
+func (filter *auditFilter) matches(entry *core.AuditEntryResource) bool {
+	if !strings.HasPrefix(entry.ResourceLocation, filter.prefix) {
+		return false
+	}
+	if filter.actor != "" && entry.Actor != filter.actor {
+		return false
+	}
+	if filter.before != "" && *entry.ID >= filter.before {
+		return false
+	}
+	if entry.Created != nil {
+		if !filter.since.IsZero() && entry.Created.Before(filter.since) {
+			return false
+		}
+		if !filter.until.IsZero() && entry.Created.After(filter.until) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBodyDigest(t *testing.T) {
+	Convey("Given request bodies", t, func() {
+		Convey("A body sent to an App should get a digest", func() {
+			So(bodyDigest("/v0/apps/test", []byte(`{"name":"test"}`)), ShouldStartWith, "sha256:")
+		})
+
+		Convey("An empty body should get no digest", func() {
+			So(bodyDigest("/v0/apps/test", nil), ShouldEqual, "")
+		})
+
+		Convey("Bodies sent to Resources with private fields should get no digest", func() {
+			for _, path := range []string{"/v0/users", "/v0/users/ci", "/v0/tokens", "/v0/registries/dockerhub/repos/test"} {
+				So(path+" "+bodyDigest(path, []byte(`{"password":"hunter2"}`)), ShouldEqual, path+" ")
+			}
+		})
+	})
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gorilla/context"
+	"github.com/supergiant/supergiant/common"
+	"github.com/supergiant/supergiant/core"
+)
+
+type contextKey int
+
+const (
+	principalKey contextKey = iota
+	auditLocationKey
+	auditActionKey
+)
+
+// authHandler authenticates every request to /v0, with HTTP basic auth (User
+// name and password) or "Authorization: Bearer <APIToken>", and keeps the
+// Principal for the handlers after it. Requests without valid credentials are
+// rejected before anything else happens. The OpenAPI document is public.
+type authHandler struct {
+	core    *core.Core
+	handler http.Handler
+}
+
+func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v0" && !strings.HasPrefix(r.URL.Path, "/v0/") || r.URL.Path == "/v0"+openAPIPath {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	principal, err := h.authenticate(r)
+	if err == core.ErrUnauthenticated {
+		w.Header().Set("WWW-Authenticate", `Basic realm="supergiant"`)
+		renderError(w, err, http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	context.Set(r, principalKey, principal)
+	h.handler.ServeHTTP(w, r)
+}
+
+func (h *authHandler) authenticate(r *http.Request) (*core.Principal, error) {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return h.core.AuthenticateToken(strings.TrimPrefix(header, "Bearer "))
+	}
+	if user, pass, ok := r.BasicAuth(); ok && user != "" {
+		return h.core.Authenticate(user, pass)
+	}
+	return nil, core.ErrUnauthenticated
+}
+
+// roleHandler rejects requests the Principal does not have the Role for. It
+// comes after the auditHandler, so that rejected changes are recorded.
+type roleHandler struct {
+	handler http.Handler
+}
+
+func (h *roleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	principal := requestPrincipal(r)
+	if principal == nil { // not under /v0
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	role, app := requiredRole(r.Method, r.URL.Path)
+	if role != "" && !principal.Can(role, app) {
+		renderError(w, roleError(principal, role, app), http.StatusForbidden)
+		return
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+func roleError(principal *core.Principal, role string, app common.ID) error {
+	scope := "the install"
+	if app != nil {
+		scope = "App " + *app
+	}
+	return fmt.Errorf("%s needs the %s role on %s", principal.Name, role, scope)
+}
+
+// requiredRole returns the Role needed for a request, and the App it is
+// needed on (nil for the whole install). An empty Role means any
+// authenticated Principal, with the handler checking further:
+//
+//   - Users, the admin endpoints and the audit log need an install-wide admin.
+//   - APITokens are managed by their own User, or an install-wide admin.
+//   - Watching needs the Role for reading the path watched, and events are
+//     filtered by the Role for reading their Resource.
+//   - Applying a Manifest needs the Role for each change it makes.
+//   - Listing Apps is filtered to the ones the Principal can view.
+//   - Creating Apps needs an install-wide admin; changing or deleting one needs
+//     admin on the App; anything under it (Components, Releases, deploys,
+//     Instances) needs deployer on the App.
+//   - Retrying and cancelling Tasks needs an install-wide deployer.
+//   - Anything else (Nodes, Entrypoints, ImageRepos) needs an install-wide
+//     admin to change.
+//
+// Reading anything needs viewer.
+func requiredRole(method string, urlPath string) (string, common.ID) {
+	segments := strings.Split(strings.Trim(path.Clean(strings.TrimPrefix(urlPath, "/v0")), "/"), "/")
+	read := method == "GET" || method == "HEAD"
+
+	switch segments[0] {
+	case "users", "admin", "audit":
+		return core.RoleAdmin, nil
+
+	case "tokens", "watch", "apply":
+		return "", nil
+
+	case "apps":
+		if len(segments) == 1 {
+			if read {
+				return "", nil
+			}
+			return core.RoleAdmin, nil
+		}
+		app := common.IDString(segments[1])
+		switch {
+		case read:
+			return core.RoleViewer, app
+		case len(segments) == 2:
+			return core.RoleAdmin, app
+		default:
+			return core.RoleDeployer, app
+		}
+
+	case "tasks":
+		if read {
+			return core.RoleViewer, nil
+		}
+		return core.RoleDeployer, nil
+	}
+
+	if read {
+		return core.RoleViewer, nil
+	}
+	return core.RoleAdmin, nil
+}
+
+// requestPrincipal returns who is making the request, or nil if it was not
+// authenticated.
+func requestPrincipal(r *http.Request) *core.Principal {
+	principal, _ := context.Get(r, principalKey).(*core.Principal)
+	return principal
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/supergiant/common"
+	"github.com/supergiant/supergiant/core"
+)
+
+func TestRequiredRole(t *testing.T) {
+	Convey("Given requests to each part of the API", t, func() {
+		tests := []struct {
+			method string
+			path   string
+			role   string
+			app    string // empty for the whole install
+		}{
+			{"GET", "/v0/apps", "", ""},
+			{"POST", "/v0/apps", core.RoleAdmin, ""},
+			{"GET", "/v0/apps/search", core.RoleViewer, "search"},
+			{"PUT", "/v0/apps/search", core.RoleAdmin, "search"},
+			{"DELETE", "/v0/apps/search", core.RoleAdmin, "search"},
+
+			{"GET", "/v0/apps/search/components", core.RoleViewer, "search"},
+			{"POST", "/v0/apps/search/components", core.RoleDeployer, "search"},
+			{"PUT", "/v0/apps/search/components/web", core.RoleDeployer, "search"},
+			{"DELETE", "/v0/apps/search/components/web", core.RoleDeployer, "search"},
+
+			{"GET", "/v0/apps/search/components/web/releases", core.RoleViewer, "search"},
+			{"POST", "/v0/apps/search/components/web/releases", core.RoleDeployer, "search"},
+			{"POST", "/v0/apps/search/components/web/deploy", core.RoleDeployer, "search"},
+			{"POST", "/v0/apps/search/components/web/deploy/promote", core.RoleDeployer, "search"},
+			{"POST", "/v0/apps/search/components/web/deploy/abort", core.RoleDeployer, "search"},
+			{"POST", "/v0/apps/search/components/web/rollback", core.RoleDeployer, "search"},
+
+			{"GET", "/v0/users", core.RoleAdmin, ""},
+			{"POST", "/v0/users", core.RoleAdmin, ""},
+			{"PUT", "/v0/users/ci", core.RoleAdmin, ""},
+
+			{"GET", "/v0/tokens", "", ""},
+			{"POST", "/v0/tokens", "", ""},
+			{"DELETE", "/v0/tokens/abc", "", ""},
+
+			{"GET", "/v0/audit", core.RoleAdmin, ""},
+			{"GET", "/v0/admin/export", core.RoleAdmin, ""},
+
+			{"GET", "/v0/watch", "", ""},
+			{"POST", "/v0/apply", "", ""},
+
+			{"GET", "/v0/tasks", core.RoleViewer, ""},
+			{"POST", "/v0/tasks/abc/cancel", core.RoleDeployer, ""},
+
+			{"GET", "/v0/nodes", core.RoleViewer, ""},
+			{"HEAD", "/v0/entrypoints", core.RoleViewer, ""},
+			{"POST", "/v0/entrypoints", core.RoleAdmin, ""},
+			{"DELETE", "/v0/nodes/abc", core.RoleAdmin, ""},
+		}
+
+		Convey("Each should need the expected Role, on the expected App", func() {
+			for _, test := range tests {
+				role, app := requiredRole(test.method, test.path)
+				So(test.method+" "+test.path+" "+role, ShouldEqual, test.method+" "+test.path+" "+test.role)
+				if test.app == "" {
+					So(app, ShouldBeNil)
+				} else {
+					So(common.StringID(app), ShouldEqual, test.app)
+				}
+			}
+		})
+	})
+
+	Convey("Given the roleHandler", t, func() {
+		called := false
+		handler := &roleHandler{http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		})}
+
+		Convey("Requests outside /v0, such as metrics scrapes, should need no Principal", func() {
+			r, _ := http.NewRequest("GET", "/metrics", nil)
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			So(called, ShouldBeTrue)
+		})
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/supergiant/supergiant/common"
 	"github.com/supergiant/supergiant/core"
 )
 
@@ -26,10 +27,12 @@ func (c *ComponentController) Create(w http.ResponseWriter, r *http.Request) {
 
 	err = app.Components().Create(component)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
+	setAuditLocation(r, component)
+
 	body, err := marshalBody(w, component)
 	if err != nil {
 		return
@@ -43,9 +46,14 @@ func (c *ComponentController) Index(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	components, err := app.Components().List()
+	opts, err := listOptions(w, r)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	components, err := app.Components().ListWithOptions(opts)
+	if err != nil {
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -81,8 +89,15 @@ func (c *ComponentController) Update(w http.ResponseWriter, r *http.Request) {
 
 	core.ZeroReadonlyFields(component)
 
+	revision, err := ifMatchRevision(w, r)
+	if err != nil {
+		return
+	}
+	component.Revision = revision
+
 	if err := component.Patch(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		err = ifMatchError(err, revision)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -100,7 +115,7 @@ func (c *ComponentController) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := component.Action("delete").Supervise(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -122,24 +137,81 @@ func (c *ComponentController) Deploy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	release, err := component.TargetRelease()
+	if err := component.StartDeploy(); err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	body, err := marshalBody(w, component)
+	if err != nil {
+		return
+	}
+	renderWithStatusAccepted(w, body)
+}
+
+// Promote lets a canary deploy of the Component go on to the rest of the
+// Instances, without waiting out the pause.
+func (c *ComponentController) Promote(w http.ResponseWriter, r *http.Request) {
+	component, err := loadComponent(c.core, w, r)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	release.Committed = true
-	if err := release.Update(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+	release, err := component.Promote()
+	if err != nil {
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
-	if err := component.Action("deploy").Supervise(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+	body, err := marshalBody(w, release)
+	if err != nil {
 		return
 	}
+	renderWithStatusAccepted(w, body)
+}
 
-	body, err := marshalBody(w, component)
+// Abort ends a canary deploy of the Component, removing its canaries and
+// keeping the current Release.
+func (c *ComponentController) Abort(w http.ResponseWriter, r *http.Request) {
+	component, err := loadComponent(c.core, w, r)
+	if err != nil {
+		return
+	}
+
+	release, err := component.Abort()
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	body, err := marshalBody(w, release)
+	if err != nil {
+		return
+	}
+	renderWithStatusAccepted(w, body)
+}
+
+// Rollback takes the Component back to the blueprint of a retired Release,
+// given by ?release= (the most recent one by default), by creating a target
+// Release cloned from it and deploying it.
+func (c *ComponentController) Rollback(w http.ResponseWriter, r *http.Request) {
+	component, err := loadComponent(c.core, w, r)
+	if err != nil {
+		return
+	}
+
+	var timestamp common.ID
+	if value := r.URL.Query().Get("release"); value != "" {
+		timestamp = common.IDString(value)
+	}
+
+	release, err := component.Rollback(timestamp)
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	body, err := marshalBody(w, release)
 	if err != nil {
 		return
 	}
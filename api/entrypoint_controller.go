@@ -21,10 +21,12 @@ func (c *EntrypointController) Create(w http.ResponseWriter, r *http.Request) {
 
 	err := c.core.Entrypoints().Create(entrypoint)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
+	setAuditLocation(r, entrypoint)
+
 	body, err := marshalBody(w, entrypoint)
 	if err != nil {
 		return
@@ -33,9 +35,14 @@ func (c *EntrypointController) Create(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c *EntrypointController) Index(w http.ResponseWriter, r *http.Request) {
-	entrypoints, err := c.core.Entrypoints().List()
+	opts, err := listOptions(w, r)
+	if err != nil {
+		return
+	}
+
+	entrypoints, err := c.core.Entrypoints().ListWithOptions(opts)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -71,8 +78,15 @@ func (c *EntrypointController) Update(w http.ResponseWriter, r *http.Request) {
 
 	core.ZeroReadonlyFields(entrypoint)
 
+	revision, err := ifMatchRevision(w, r)
+	if err != nil {
+		return
+	}
+	entrypoint.Revision = revision
+
 	if err := entrypoint.Patch(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		err = ifMatchError(err, revision)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -89,7 +103,7 @@ func (c *EntrypointController) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err = entrypoint.Delete(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 }
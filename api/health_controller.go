@@ -0,0 +1,64 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/supergiant/supergiant/core"
+)
+
+// HealthController serves the probes and metrics of this replica. They are
+// outside /v0, so they need no authentication.
+type HealthController struct {
+	core *core.Core
+}
+
+// readiness is the response of Readyz: "ok", or the error, of every check.
+type readiness struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Healthz responds 200 as long as the process serves requests, for liveness
+// probes.
+func (c *HealthController) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, "ok\n")
+}
+
+// Readyz checks the store and the Kubernetes API, responding 503 when either
+// cannot be reached, for readiness probes.
+func (c *HealthController) Readyz(w http.ResponseWriter, r *http.Request) {
+	result := &readiness{Ready: true, Checks: make(map[string]string)}
+	for name, err := range c.core.CheckReadiness() {
+		if err != nil {
+			result.Ready = false
+			result.Checks[name] = err.Error()
+			continue
+		}
+		result.Checks[name] = "ok"
+	}
+
+	body, err := marshalBody(w, result)
+	if err != nil {
+		return
+	}
+	if !result.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, body)
+		return
+	}
+	renderWithStatusOK(w, body)
+}
+
+// Metrics serves the metrics of this replica in the Prometheus text format.
+func (c *HealthController) Metrics(w http.ResponseWriter, r *http.Request) {
+	buf := new(bytes.Buffer)
+	if err := c.core.WriteMetrics(buf); err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	buf.WriteTo(w)
+}
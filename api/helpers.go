@@ -4,20 +4,33 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/supergiant/supergiant/common"
 	"github.com/supergiant/supergiant/core"
 
 	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
 )
 
-type errorMessage struct {
-	Status int    `json:"status"`
-	Error  string `json:"error"`
-}
-
 func renderError(w http.ResponseWriter, err error, status int) {
-	msg := &errorMessage{status, err.Error()}
+	msg := &common.Error{
+		Status: status,
+		Code:   core.ErrorCode(err),
+		Error:  err.Error(),
+	}
+	// NOTE errors rendered with another status than their own, and errors
+	// which are not typed, get the code of the status.
+	if errorStatus(err) != status {
+		msg.Code = statusErrorCode(status)
+	}
+	if verr, ok := err.(*core.ValidationError); ok && msg.Code == common.ErrorCodeValidation {
+		msg.Fields = verr.Fields
+	}
 	body, err := json.MarshalIndent(msg, "", "  ")
 	if err != nil {
 		panic(err)
@@ -31,10 +44,11 @@ func loadApp(core *core.Core, w http.ResponseWriter, r *http.Request) (*core.App
 	name := mux.Vars(r)["app_name"]
 	app, err := core.Apps().Get(&name)
 	if err != nil {
-		renderError(w, err, http.StatusNotFound)
+		renderError(w, err, errorStatus(err))
 		return nil, err
 	}
 
+	setAuditLocation(r, app)
 	return app, nil
 }
 
@@ -49,10 +63,11 @@ func loadComponent(core *core.Core, w http.ResponseWriter, r *http.Request) (*co
 	name := mux.Vars(r)["comp_name"]
 	component, err := app.Components().Get(&name)
 	if err != nil {
-		renderError(w, err, http.StatusNotFound)
+		renderError(w, err, errorStatus(err))
 		return nil, err
 	}
 
+	setAuditLocation(r, component)
 	return component, nil
 }
 
@@ -63,10 +78,20 @@ func loadRelease(c *core.Core, w http.ResponseWriter, r *http.Request) (*core.Re
 	if err != nil {
 		return nil, err
 	}
+	release, err := findRelease(component, w, mux.Vars(r)["release_timestamp"])
+	if err != nil {
+		return nil, err
+	}
+	setAuditLocation(r, release)
+	return release, nil
+}
 
+// findRelease loads a Release of a Component by timestamp, or "current" or
+// "target", or renders an HTTP Not Found error.
+func findRelease(component *core.ComponentResource, w http.ResponseWriter, releaseIdentifier string) (*core.ReleaseResource, error) {
 	// TODO
 	var release *core.ReleaseResource
-	releaseIdentifier := mux.Vars(r)["release_timestamp"]
+	var err error
 
 	switch releaseIdentifier {
 	case "current":
@@ -77,7 +102,7 @@ func loadRelease(c *core.Core, w http.ResponseWriter, r *http.Request) (*core.Re
 		}
 		release, err = component.CurrentRelease()
 		if err != nil {
-			renderError(w, err, http.StatusInternalServerError)
+			renderError(w, err, errorStatus(err))
 			return nil, err
 		}
 
@@ -89,14 +114,14 @@ func loadRelease(c *core.Core, w http.ResponseWriter, r *http.Request) (*core.Re
 		}
 		release, err = component.TargetRelease()
 		if err != nil {
-			renderError(w, err, http.StatusInternalServerError)
+			renderError(w, err, errorStatus(err))
 			return nil, err
 		}
 
 	default:
 		release, err = component.Releases().Get(&releaseIdentifier)
 		if err != nil {
-			renderError(w, err, http.StatusNotFound)
+			renderError(w, err, errorStatus(err))
 			return nil, err
 		}
 	}
@@ -118,10 +143,11 @@ func loadInstance(core *core.Core, w http.ResponseWriter, r *http.Request) (*cor
 	}
 	instance, err := release.Instances().Get(&id)
 	if err != nil {
-		renderError(w, err, http.StatusNotFound)
+		renderError(w, err, errorStatus(err))
 		return nil, err
 	}
 
+	setAuditLocation(r, instance)
 	return instance, nil
 }
 
@@ -131,10 +157,11 @@ func loadNode(core *core.Core, w http.ResponseWriter, r *http.Request) (*core.No
 	id := mux.Vars(r)["node_id"]
 	node, err := core.Nodes().Get(&id)
 	if err != nil {
-		renderError(w, err, http.StatusNotFound)
+		renderError(w, err, errorStatus(err))
 		return nil, err
 	}
 
+	setAuditLocation(r, node)
 	return node, nil
 }
 
@@ -144,10 +171,11 @@ func loadImageRepo(core *core.Core, w http.ResponseWriter, r *http.Request) (*co
 	name := mux.Vars(r)["name"]
 	repo, err := core.ImageRepos().Get(&name)
 	if err != nil {
-		renderError(w, err, http.StatusNotFound)
+		renderError(w, err, errorStatus(err))
 		return nil, err
 	}
 
+	setAuditLocation(r, repo)
 	return repo, nil
 }
 
@@ -157,10 +185,11 @@ func loadEntrypoint(core *core.Core, w http.ResponseWriter, r *http.Request) (*c
 	domain := mux.Vars(r)["domain"]
 	entrypoint, err := core.Entrypoints().Get(&domain)
 	if err != nil {
-		renderError(w, err, http.StatusNotFound)
+		renderError(w, err, errorStatus(err))
 		return nil, err
 	}
 
+	setAuditLocation(r, entrypoint)
 	return entrypoint, nil
 }
 
@@ -170,13 +199,86 @@ func loadTask(core *core.Core, w http.ResponseWriter, r *http.Request) (*core.Ta
 	id := mux.Vars(r)["id"]
 	task, err := core.Tasks().Get(&id)
 	if err != nil {
-		renderError(w, err, http.StatusNotFound)
+		renderError(w, err, errorStatus(err))
 		return nil, err
 	}
 
+	setAuditLocation(r, task)
 	return task, nil
 }
 
+// loadFailedTask loads a FailedTask resource from URL params, or renders an
+// HTTP Not Found error.
+func loadFailedTask(core *core.Core, w http.ResponseWriter, r *http.Request) (*core.FailedTaskResource, error) {
+	id := mux.Vars(r)["id"]
+	task, err := core.FailedTasks().Get(&id)
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return nil, err
+	}
+
+	setAuditLocation(r, task)
+	return task, nil
+}
+
+// loadUser loads a User resource from URL params, or renders an HTTP Not
+// Found error.
+func loadUser(core *core.Core, w http.ResponseWriter, r *http.Request) (*core.UserResource, error) {
+	name := mux.Vars(r)["name"]
+	user, err := core.Users().Get(&name)
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return nil, err
+	}
+
+	setAuditLocation(r, user)
+	return user, nil
+}
+
+// loadAPIToken loads an APIToken resource from URL params, or renders an HTTP
+// Not Found error.
+func loadAPIToken(core *core.Core, w http.ResponseWriter, r *http.Request) (*core.APITokenResource, error) {
+	id := mux.Vars(r)["id"]
+	token, err := core.APITokens().Get(&id)
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return nil, err
+	}
+
+	setAuditLocation(r, token)
+	return token, nil
+}
+
+// listOptions parses the tags, sort, limit, and continue query params into the
+// ListOptions given to ListWithOptions, or renders an HTTP Bad Request error.
+func listOptions(w http.ResponseWriter, r *http.Request) (*core.ListOptions, error) {
+	query := r.URL.Query()
+	opts, err := core.ParseListOptions(query.Get("tags"), query.Get("sort"), query.Get("limit"), query.Get("continue"))
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return nil, err
+	}
+	return opts, nil
+}
+
+// requestContext returns a context that is cancelled when the client
+// disconnects, for handlers that stream their response until then. cancel
+// must be called when the handler returns.
+func requestContext(w http.ResponseWriter) (ctx context.Context, cancel context.CancelFunc) {
+	ctx, cancel = context.WithCancel(context.Background())
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closed := notifier.CloseNotify()
+		go func() {
+			select {
+			case <-closed:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, cancel
+}
+
 // unmarshalBodyInto decodes a JSON body into an interface or renders an HTTP
 // Not Found error.
 func unmarshalBodyInto(w http.ResponseWriter, r *http.Request, out interface{}) error {
@@ -189,6 +291,56 @@ func unmarshalBodyInto(w http.ResponseWriter, r *http.Request, out interface{})
 	return nil
 }
 
+// isYAMLBody returns true if the request body is YAML rather than JSON, by its
+// Content-Type (application/yaml, application/x-yaml, text/yaml, ...).
+func isYAMLBody(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Content-Type"), "yaml")
+}
+
+// unmarshalYAMLBodyInto decodes a YAML body into an interface or renders an
+// HTTP Bad Request error. The body is converted to JSON first, so that the json
+// tags of the common types apply to YAML as well.
+func unmarshalYAMLBodyInto(w http.ResponseWriter, r *http.Request, out interface{}) error {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return err
+	}
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return err
+	}
+	if data, err = json.Marshal(jsonValueOfYAML(doc)); err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return err
+	}
+	return nil
+}
+
+// jsonValueOfYAML converts the maps decoded by yaml.v2, which have interface{}
+// keys, into maps with string keys, which can be encoded as JSON.
+func jsonValueOfYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[fmt.Sprint(key)] = jsonValueOfYAML(value)
+		}
+		return out
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonValueOfYAML(v[i])
+		}
+		return v
+	}
+	return v
+}
+
 // marshalBody marshals an interface into a JSON body or renders an HTTP Bad
 // Request error.
 func marshalBody(w http.ResponseWriter, in interface{}) (string, error) {
@@ -200,12 +352,89 @@ func marshalBody(w http.ResponseWriter, in interface{}) (string, error) {
 
 	out, err := json.MarshalIndent(in, "", "  ")
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return "", err
 	}
+
+	// Every Resource has a revision through common.Meta
+	if r, isResource := in.(interface {
+		ETag() string
+	}); isResource {
+		if etag := r.ETag(); etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+	}
+
 	return string(out) + "\n", nil
 }
 
+// ifMatchRevision returns the Resource revision from the If-Match header, or
+// renders an HTTP Bad Request error. It returns an empty string, meaning the
+// write is not conditional, when there is no If-Match header or it is "*".
+func ifMatchRevision(w http.ResponseWriter, r *http.Request) (string, error) {
+	etag := strings.TrimPrefix(strings.TrimSpace(r.Header.Get("If-Match")), "W/")
+	if etag == "" || etag == "*" {
+		return "", nil
+	}
+
+	revision, err := strconv.Unquote(etag)
+	if err != nil {
+		revision = etag // be lenient with unquoted values
+	}
+	if _, err := strconv.ParseUint(revision, 10, 64); err != nil {
+		err = fmt.Errorf("Invalid If-Match header %s", etag)
+		renderError(w, err, http.StatusBadRequest)
+		return "", err
+	}
+	return revision, nil
+}
+
+// errorStatuses are the HTTP statuses of the error codes of core.
+var errorStatuses = map[string]int{
+	common.ErrorCodeInvalidRequest:     http.StatusBadRequest,
+	common.ErrorCodeValidation:         http.StatusBadRequest,
+	common.ErrorCodeUnauthenticated:    http.StatusUnauthorized,
+	common.ErrorCodeForbidden:          http.StatusForbidden,
+	common.ErrorCodeNotFound:           http.StatusNotFound,
+	common.ErrorCodeConflict:           http.StatusConflict,
+	common.ErrorCodePreconditionFailed: http.StatusPreconditionFailed,
+	common.ErrorCodeUpstream:           http.StatusBadGateway,
+}
+
+// errorStatus returns the HTTP status of an error from core: 400 for invalid
+// requests and fields, 404 for Resources that do not exist, 409 for writes
+// that conflict, 412 for failed If-Match conditions, 502 for errors from
+// Kubernetes or AWS, and 500 for anything else.
+func errorStatus(err error) int {
+	if status, ok := errorStatuses[core.ErrorCode(err)]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// statusErrorCode returns the error code of an HTTP status, for errors that do
+// not have their own.
+func statusErrorCode(status int) string {
+	if status == http.StatusBadRequest {
+		return common.ErrorCodeInvalidRequest
+	}
+	for code, codeStatus := range errorStatuses {
+		if codeStatus == status && code != common.ErrorCodeValidation {
+			return code
+		}
+	}
+	return common.ErrorCodeInternal
+}
+
+// ifMatchError returns the error of a write made with ifMatchRevision, which
+// is a failed precondition when the Resource changed since the revision.
+func ifMatchError(err error, revision string) error {
+	if revision != "" && core.IsConflictErr(err) {
+		return &core.PreconditionFailedError{Revision: revision}
+	}
+	return err
+}
+
 // renderWithStatusAccepted renders a response with HTTP status 202.
 func renderWithStatusAccepted(w http.ResponseWriter, body string) {
 	w.WriteHeader(http.StatusAccepted)
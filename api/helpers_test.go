@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+func TestUnmarshalYAMLBodyInto(t *testing.T) {
+	Convey("Given a YAML Manifest", t, func() {
+		body := `
+app:
+  name: my-app
+components:
+  - name: web
+    tags: {env: prod}
+    release:
+      instance_count: 2
+      containers:
+        - image: nginx:1.11
+          ram: {min: 64Mi, max: 256Mi}
+`
+		r, _ := http.NewRequest("POST", "/v0/apply", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/yaml")
+
+		Convey("It should be recognized as YAML", func() {
+			So(isYAMLBody(r), ShouldBeTrue)
+		})
+
+		Convey("It should decode with the json field names", func() {
+			manifest := new(common.Manifest)
+			w := httptest.NewRecorder()
+			err := unmarshalYAMLBodyInto(w, r, manifest)
+
+			So(err, ShouldBeNil)
+			So(common.StringID(manifest.App.Name), ShouldEqual, "my-app")
+			So(manifest.Components, ShouldHaveLength, 1)
+			component := manifest.Components[0]
+			So(common.StringID(component.Name), ShouldEqual, "web")
+			So(component.Tags["env"], ShouldEqual, "prod")
+			So(component.Release.InstanceCount, ShouldEqual, 2)
+			So(component.Release.Containers[0].Image, ShouldEqual, "nginx:1.11")
+		})
+	})
+
+	Convey("Given a body that is not valid YAML", t, func() {
+		r, _ := http.NewRequest("POST", "/v0/apply", strings.NewReader("app: [my-app"))
+		r.Header.Set("Content-Type", "application/yaml")
+
+		Convey("It should render a Bad Request", func() {
+			w := httptest.NewRecorder()
+			err := unmarshalYAMLBodyInto(w, r, new(common.Manifest))
+
+			So(err, ShouldNotBeNil)
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+
+	Convey("Given a JSON body", t, func() {
+		r, _ := http.NewRequest("POST", "/v0/apply", strings.NewReader("{}"))
+		r.Header.Set("Content-Type", "application/json")
+
+		Convey("It should not be taken for YAML", func() {
+			So(isYAMLBody(r), ShouldBeFalse)
+		})
+	})
+}
@@ -21,10 +21,12 @@ func (c *ImageRepoController) Create(w http.ResponseWriter, r *http.Request) {
 
 	err := c.core.ImageRepos().Create(repo)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
+	setAuditLocation(r, repo)
+
 	body, err := marshalBody(w, repo)
 	if err != nil {
 		return
@@ -33,9 +35,14 @@ func (c *ImageRepoController) Create(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c *ImageRepoController) Index(w http.ResponseWriter, r *http.Request) {
-	repos, err := c.core.ImageRepos().List()
+	opts, err := listOptions(w, r)
+	if err != nil {
+		return
+	}
+
+	repos, err := c.core.ImageRepos().ListWithOptions(opts)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -80,8 +87,15 @@ func (c *ImageRepoController) Update(w http.ResponseWriter, r *http.Request) {
 
 	core.ZeroReadonlyFields(repo)
 
+	revision, err := ifMatchRevision(w, r)
+	if err != nil {
+		return
+	}
+	repo.Revision = revision
+
 	if err := repo.Patch(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		err = ifMatchError(err, revision)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -100,7 +114,7 @@ func (c *ImageRepoController) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err = repo.Delete(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 }
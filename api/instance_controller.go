@@ -1,7 +1,14 @@
 package api
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/supergiant/supergiant/core"
 )
@@ -16,7 +23,16 @@ func (c *InstanceController) Index(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	instances := release.Instances().List()
+	opts, err := listOptions(w, r)
+	if err != nil {
+		return
+	}
+
+	instances, err := release.Instances().ListWithOptions(opts)
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
 
 	body, err := marshalBody(w, instances)
 	if err != nil {
@@ -38,20 +54,127 @@ func (c *InstanceController) Show(w http.ResponseWriter, r *http.Request) {
 	renderWithStatusOK(w, body)
 }
 
-// TODO this is not JSON
+// Log renders the log of a container of the Instance as plain text. It takes
+// ?container= (the first container of the Release by default), ?tail= (a
+// number of lines), ?since= (a duration such as 10m, or a time as in the audit
+// Index), and ?previous=, ?follow= and ?timestamps= (true or false).
+//
+// With follow=true, lines are sent as they are written, until the client
+// disconnects; as Server-Sent Events, one line per event, when the request
+// accepts text/event-stream.
 func (c *InstanceController) Log(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseLogOptions(r.URL.Query())
+	if err != nil {
+		renderError(w, err, http.StatusBadRequest)
+		return
+	}
+
 	instance, err := loadInstance(c.core, w, r)
 	if err != nil {
 		return
 	}
 
-	log, err := instance.Log()
+	ctx, cancel := requestContext(w)
+	defer cancel()
+
+	stream, err := instance.Log(ctx, opts)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
+	defer stream.Close()
 
-	renderWithStatusOK(w, log)
+	if opts.Follow && strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		writeLogEvents(w, stream)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if !opts.Follow {
+		io.Copy(w, stream)
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeLogEvents sends each line of a log as a Server-Sent Event, and an
+// "error" event if the log could not be read to the end (which fails
+// silently when the client is gone).
+func writeLogEvents(w http.ResponseWriter, stream io.Reader) {
+	flusher, _ := w.(http.Flusher)
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", scanner.Text()); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", err)
+	}
+}
+
+func parseLogOptions(query url.Values) (*core.LogOptions, error) {
+	opts := &core.LogOptions{
+		Container: query.Get("container"),
+	}
+
+	if tail := query.Get("tail"); tail != "" {
+		n, err := strconv.Atoi(tail)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Invalid tail: %q is not a number of lines", tail)
+		}
+		opts.Tail = n
+	}
+
+	if since := query.Get("since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil {
+			t, timeErr := parseQueryTime(since)
+			if timeErr != nil {
+				return nil, fmt.Errorf("Invalid since: %q is neither a duration nor a time", since)
+			}
+			d = time.Since(t)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("Invalid since: %q is not in the past", since)
+		}
+		opts.Since = d
+	}
+
+	for param, dst := range map[string]*bool{"previous": &opts.Previous, "follow": &opts.Follow, "timestamps": &opts.Timestamps} {
+		if query.Get(param) == "" {
+			continue
+		}
+		set, err := strconv.ParseBool(query.Get(param))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %q is not true or false", param, query.Get(param))
+		}
+		*dst = set
+	}
+	return opts, nil
 }
 
 func (c *InstanceController) Start(w http.ResponseWriter, r *http.Request) {
@@ -61,7 +184,7 @@ func (c *InstanceController) Start(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := instance.Action("start").Supervise(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -79,7 +202,7 @@ func (c *InstanceController) Stop(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := instance.Action("stop").Supervise(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/supergiant/supergiant/core"
+)
+
+// metricsHandler records the time taken by every request, by the template of
+// the route that matches it (e.g. /v0/apps/{app_name}), so that the number of
+// series does not grow with the number of Resources.
+type metricsHandler struct {
+	router  *mux.Router
+	handler http.Handler
+}
+
+func (h *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := "unmatched"
+	var match mux.RouteMatch
+	if h.router.Match(r, &match) {
+		if tpl, err := match.Route.GetPathTemplate(); err == nil {
+			route = tpl
+		}
+	}
+
+	start := time.Now()
+	recorder := &statusRecorder{w, http.StatusOK}
+	h.handler.ServeHTTP(recorder, r)
+	core.ObserveHTTPRequest(r.Method, route, recorder.status, time.Since(start))
+}
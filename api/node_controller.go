@@ -21,10 +21,12 @@ func (c *NodeController) Create(w http.ResponseWriter, r *http.Request) {
 
 	err := c.core.Nodes().Create(node)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
+	setAuditLocation(r, node)
+
 	body, err := marshalBody(w, node)
 	if err != nil {
 		return
@@ -33,9 +35,14 @@ func (c *NodeController) Create(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c *NodeController) Index(w http.ResponseWriter, r *http.Request) {
-	apps, err := c.core.Nodes().List()
+	opts, err := listOptions(w, r)
+	if err != nil {
+		return
+	}
+
+	apps, err := c.core.Nodes().ListWithOptions(opts)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -71,8 +78,15 @@ func (c *NodeController) Update(w http.ResponseWriter, r *http.Request) {
 
 	core.ZeroReadonlyFields(node)
 
+	revision, err := ifMatchRevision(w, r)
+	if err != nil {
+		return
+	}
+	node.Revision = revision
+
 	if err := node.Patch(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		err = ifMatchError(err, revision)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -90,7 +104,7 @@ func (c *NodeController) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := node.Delete(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -0,0 +1,576 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/supergiant/supergiant/common"
+)
+
+const openAPIPath = "/openapi.json"
+
+// openAPIResources maps the collection segment of a route path to the common
+// type of the Resources in it. Routes ending in a collection, or in the ID of
+// a Resource in one, are described as the usual List, Create, Show, Update,
+// and Delete.
+var openAPIResources = map[string]interface{}{
+	"repos":       common.ImageRepo{},
+	"nodes":       common.Node{},
+	"entrypoints": common.Entrypoint{},
+	"apps":        common.App{},
+	"components":  common.Component{},
+	"releases":    common.Release{},
+	"instances":   common.Instance{},
+	"tasks":       common.Task{},
+	"audit":       common.AuditEntry{},
+	"users":       common.User{},
+	"tokens":      common.APIToken{},
+}
+
+// openAPIOperation describes a route that does not follow the usual pattern,
+// by "<method> <path template>" (without /v0).
+type openAPIOperation struct {
+	id          string
+	summary     string
+	request     interface{} // the body; nil for none
+	requestYAML bool        // the body may also be YAML
+	response    interface{} // nil for none
+	status      int
+	contentType string // of the response, when not JSON
+	headers     []string
+	query       []string
+	public      bool // no authentication needed
+}
+
+var openAPIOperations = map[string]*openAPIOperation{
+	"DELETE /apps/{app_name}": {
+		id: "deleteApp", summary: "Delete an App, along with its Components", response: common.App{}, status: http.StatusAccepted,
+	},
+	"DELETE /apps/{app_name}/components/{comp_name}": {
+		id: "deleteComponent", summary: "Delete a Component, along with its Releases", response: common.Component{}, status: http.StatusAccepted,
+	},
+	"DELETE /nodes/{node_id}": {
+		id: "deleteNode", summary: "Delete a Node, terminating its server", response: common.Node{}, status: http.StatusAccepted,
+	},
+	"DELETE /tasks/{id}": {
+		id: "deleteTask", summary: "Delete a Task", response: common.Task{}, status: http.StatusAccepted,
+	},
+	"PATCH /apps/{app_name}/components/{comp_name}/releases": {
+		id: "mergeCreateRelease", summary: "Create a Release from the changes given to the current one", request: common.Release{}, response: common.Release{}, status: http.StatusCreated,
+	},
+	"POST /apps/{app_name}/components/{comp_name}/deploy": {
+		id: "deployComponent", summary: "Deploy the target Release of a Component", response: common.Component{}, status: http.StatusAccepted,
+	},
+	"POST /apps/{app_name}/components/{comp_name}/deploy/promote": {
+		id: "promoteComponent", summary: "Let a canary deploy go on from its canaries to the rest of the Instances", response: common.Release{}, status: http.StatusAccepted,
+	},
+	"POST /apps/{app_name}/components/{comp_name}/deploy/abort": {
+		id: "abortComponentDeploy", summary: "End a canary deploy, removing its canaries and keeping the current Release", response: common.Release{}, status: http.StatusAccepted,
+	},
+	"POST /apps/{app_name}/components/{comp_name}/rollback": {
+		id: "rollbackComponent", summary: "Deploy a new Release cloned from a retired one", response: common.Release{}, status: http.StatusAccepted,
+		query: []string{"release"},
+	},
+	"GET /apps/{app_name}/components/{comp_name}/releases/{release_timestamp}/diff/{other_timestamp}": {
+		id: "diffReleases", summary: "Get what changes when moving from one Release to another (either can be current or target)", response: common.ReleaseDiff{}, status: http.StatusOK,
+	},
+	"POST /apps/{app_name}/components/{comp_name}/releases/{release_timestamp}/instances/{instance_id}/start": {
+		id: "startInstance", summary: "Start an Instance", response: common.Instance{}, status: http.StatusAccepted,
+	},
+	"POST /apps/{app_name}/components/{comp_name}/releases/{release_timestamp}/instances/{instance_id}/stop": {
+		id: "stopInstance", summary: "Stop an Instance", response: common.Instance{}, status: http.StatusAccepted,
+	},
+	"GET /apps/{app_name}/components/{comp_name}/releases/{release_timestamp}/instances/{instance_id}/log": {
+		id: "getInstanceLog", summary: "Get the log of an Instance, or follow it", response: "", status: http.StatusOK, contentType: "text/plain",
+		query: []string{"container", "tail", "since", "previous", "follow", "timestamps"},
+	},
+	"POST /tasks/{id}/cancel": {
+		id: "cancelTask", summary: "Cancel a queued or running Task", response: common.Task{}, status: http.StatusAccepted,
+	},
+	"POST /tasks/{id}/retry": {
+		id: "retryTask", summary: "Queue a failed Task again", response: common.Task{}, status: http.StatusAccepted,
+	},
+	"GET /admin/export": {
+		id: "exportRecords", summary: "Export every stored record", response: common.Archive{}, status: http.StatusOK,
+		headers: []string{archivePassphraseHeader},
+	},
+	"POST /admin/import": {
+		id: "importRecords", summary: "Import an Archive into an empty store", request: common.Archive{}, response: importResult{}, status: http.StatusCreated,
+		headers: []string{archivePassphraseHeader}, query: []string{"mode"},
+	},
+	"GET /audit": {
+		id: "listAuditEntries", summary: "List AuditEntries, oldest first", response: openAPIList{common.AuditEntry{}}, status: http.StatusOK,
+		query: []string{"prefix", "actor", "since", "until", "before", "tags", "sort", "limit", "continue"},
+	},
+	"GET /tasks": {
+		id: "listTasks", summary: "List Tasks", response: openAPIList{common.Task{}}, status: http.StatusOK,
+		query: []string{"status", "tags", "sort", "limit", "continue"},
+	},
+	"GET /watch": {
+		id: "watch", summary: "Stream the changes to the Resources at a path, and under it", response: common.WatchEvent{}, status: http.StatusOK, contentType: "application/x-ndjson",
+		query: []string{"path"},
+	},
+	"POST /apply": {
+		id: "applyManifest", summary: "Make an App match a Manifest, deploying the Components that changed", request: common.Manifest{}, requestYAML: true, response: common.ManifestResult{}, status: http.StatusAccepted,
+		query: []string{"dry_run"},
+	},
+	"GET " + openAPIPath: {
+		id: "getOpenAPI", summary: "Get this document", response: map[string]interface{}{}, status: http.StatusOK, public: true,
+	},
+}
+
+// openAPIParams describes the query params and headers used above.
+var openAPIParams = map[string]string{
+	"tags":     "Tag selector, e.g. team=search,env!=dev, env, or !env",
+	"sort":     "name, created, or updated, with - for descending",
+	"limit":    "The maximum number of items",
+	"continue": "The continue token of the previous page",
+	"status":   "Only Tasks with this status",
+	"prefix":   "Only entries for resource locations with this prefix",
+	"actor":    "Only entries by this actor",
+	"since":    "Only entries from this time on (RFC 3339 or RFC 1123); for logs, also a duration such as 10m",
+	"until":    "Only entries up to this time (RFC 3339 or RFC 1123)",
+	"before":   "Only entries recorded before the entry with this ID",
+	"mode":     "records (the default), or provision to also create the Kubernetes assets",
+
+	"container":  "The name of the container; the first one of the Release by default",
+	"tail":       "Only this many lines from the end",
+	"previous":   "true for the log of the container before it last restarted",
+	"follow":     "true to keep sending lines as they are written, as text/event-stream if accepted",
+	"timestamps": "true to start each line with an RFC 3339 timestamp",
+
+	"path": "An API path like /apps/search; / by default. Sent as text/event-stream if accepted",
+
+	"dry_run": "true to only return the changes, with 200 OK",
+	"release": "The timestamp of the retired Release to roll back to; the most recent one by default",
+
+	archivePassphraseHeader: "Passphrase private fields are encrypted with",
+}
+
+// openAPIList stands for the List of a Resource type in operations.
+type openAPIList struct {
+	item interface{}
+}
+
+var routeVarPattern = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// openAPIHandler renders the OpenAPI document for the routes of r. It is
+// generated on the first request, once every route is registered.
+func openAPIHandler(r *mux.Router) http.HandlerFunc {
+	var once sync.Once
+	var spec map[string]interface{}
+	var specErr error
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		once.Do(func() {
+			spec, specErr = openAPISpec(r)
+		})
+		if specErr != nil {
+			renderError(w, specErr, http.StatusInternalServerError)
+			return
+		}
+
+		body, err := marshalBody(w, spec)
+		if err != nil {
+			return
+		}
+		renderWithStatusOK(w, body)
+	}
+}
+
+// openAPISpec returns an OpenAPI 3 document describing every route of r under
+// /v0, with schemas generated from the common types. It fails on a route it
+// cannot describe, which has to be added to openAPIOperations.
+func openAPISpec(r *mux.Router) (map[string]interface{}, error) {
+	schemas := &openAPISchemas{schemas: make(map[string]interface{})}
+	schemas.schemaOf(reflect.TypeOf(common.Error{}))
+
+	paths := make(map[string]interface{})
+	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil || route.GetHandler() == nil || !strings.HasPrefix(tpl, "/v0/") {
+			return nil
+		}
+		path := strings.TrimPrefix(tpl, "/v0")
+
+		for _, method := range routeMethods(route, tpl) {
+			op, err := describeRoute(method, path)
+			if err != nil {
+				return err
+			}
+			item, ok := paths[path].(map[string]interface{})
+			if !ok {
+				item = make(map[string]interface{})
+				paths[path] = item
+			}
+			item[strings.ToLower(method)] = schemas.operation(method, path, op)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Supergiant API",
+			"version": "v0",
+		},
+		"servers":  []interface{}{map[string]interface{}{"url": "/v0"}},
+		"security": []interface{}{map[string]interface{}{"basicAuth": []string{}}, map[string]interface{}{"bearerAuth": []string{}}},
+		"paths":    paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.schemas,
+			"securitySchemes": map[string]interface{}{
+				"basicAuth":  map[string]interface{}{"type": "http", "scheme": "basic"},
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "An APIToken"},
+			},
+		},
+	}, nil
+}
+
+// routeMethods returns the methods a route matches, by trying each of them on
+// its path.
+func routeMethods(route *mux.Route, tpl string) (methods []string) {
+	path := routeVarPattern.ReplaceAllString(tpl, "x")
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+		req := &http.Request{Method: method, URL: &url.URL{Path: path}, Header: make(http.Header)}
+		if route.Match(req, new(mux.RouteMatch)) {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// describeRoute returns the openAPIOperation for a route, from
+// openAPIOperations or from the Resource it is for.
+func describeRoute(method string, path string) (*openAPIOperation, error) {
+	if op, ok := openAPIOperations[method+" "+path]; ok {
+		return op, nil
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	last := segments[len(segments)-1]
+	isMember := routeVarPattern.MatchString(last)
+	collection := last
+	if isMember && len(segments) > 1 {
+		collection = segments[len(segments)-2]
+	}
+	resource, ok := openAPIResources[collection]
+	if !ok {
+		return nil, fmt.Errorf("No OpenAPI description for %s %s; add it to openAPIOperations", method, path)
+	}
+	name := reflect.TypeOf(resource).Name()
+
+	switch {
+	case !isMember && method == "GET":
+		return &openAPIOperation{
+			id: "list" + pluralize(name), summary: "List " + pluralize(name), response: openAPIList{resource}, status: http.StatusOK,
+			query: []string{"tags", "sort", "limit", "continue"},
+		}, nil
+	case !isMember && method == "POST":
+		return &openAPIOperation{id: "create" + name, summary: "Create " + article(name), request: resource, response: resource, status: http.StatusCreated}, nil
+	case isMember && method == "GET":
+		return &openAPIOperation{id: "get" + name, summary: "Get " + article(name), response: resource, status: http.StatusOK}, nil
+	case isMember && method == "PUT":
+		return &openAPIOperation{
+			id: "update" + name, summary: "Update " + article(name), request: resource, response: resource, status: http.StatusAccepted,
+			headers: []string{"If-Match"},
+		}, nil
+	case isMember && method == "DELETE":
+		return &openAPIOperation{id: "delete" + name, summary: "Delete " + article(name), status: http.StatusOK}, nil
+	}
+	return nil, fmt.Errorf("No OpenAPI description for %s %s; add it to openAPIOperations", method, path)
+}
+
+func pluralize(name string) string {
+	if strings.HasSuffix(name, "y") {
+		return strings.TrimSuffix(name, "y") + "ies"
+	}
+	return name + "s"
+}
+
+func article(name string) string {
+	if strings.ContainsAny(name[:1], "AEIOU") {
+		return "an " + name
+	}
+	return "a " + name
+}
+
+// openAPISchemas collects the schemas of the types used by operations.
+type openAPISchemas struct {
+	schemas map[string]interface{}
+}
+
+func (s *openAPISchemas) operation(method string, path string, op *openAPIOperation) map[string]interface{} {
+	out := map[string]interface{}{
+		"operationId": op.id,
+		"summary":     op.summary,
+	}
+	if op.public {
+		out["security"] = []interface{}{}
+	}
+
+	var params []interface{}
+	for _, match := range routeVarPattern.FindAllStringSubmatch(path, -1) {
+		params = append(params, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, name := range op.query {
+		params = append(params, map[string]interface{}{
+			"name": name, "in": "query", "description": openAPIParams[name], "schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, name := range op.headers {
+		param := map[string]interface{}{"name": name, "in": "header", "schema": map[string]interface{}{"type": "string"}}
+		if name == "If-Match" {
+			param["description"] = "The ETag of the Resource when loaded; the update fails with 412 if it has changed since"
+		} else {
+			param["description"] = openAPIParams[name]
+		}
+		params = append(params, param)
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	if op.request != nil {
+		content := map[string]interface{}{"application/json": map[string]interface{}{"schema": s.bodySchema(op.request)}}
+		if op.requestYAML {
+			content["application/yaml"] = content["application/json"]
+		}
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  content,
+		}
+	}
+
+	response := map[string]interface{}{"description": http.StatusText(op.status)}
+	if op.response != nil {
+		contentType := op.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		response["content"] = map[string]interface{}{contentType: map[string]interface{}{"schema": s.bodySchema(op.response)}}
+	}
+	out["responses"] = map[string]interface{}{
+		strconv.Itoa(op.status): response,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"}}},
+		},
+	}
+	return out
+}
+
+// bodySchema returns the schema of a request or response body.
+func (s *openAPISchemas) bodySchema(body interface{}) map[string]interface{} {
+	list, ok := body.(openAPIList)
+	if !ok {
+		return s.schemaOf(reflect.TypeOf(body))
+	}
+
+	name := reflect.TypeOf(list.item).Name() + "List"
+	if _, ok := s.schemas[name]; !ok {
+		s.schemas[name] = map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"items":    map[string]interface{}{"type": "array", "items": s.schemaOf(reflect.TypeOf(list.item))},
+				"continue": map[string]interface{}{"type": "string", "description": "Set when there are more items, to get the next page with ?continue="},
+			},
+		}
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	timestampType     = reflect.TypeOf(common.Timestamp{})
+)
+
+// schemaOf returns the schema of a type, as a reference for structs.
+func (s *openAPISchemas) schemaOf(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	case t == timestampType:
+		return map[string]interface{}{"type": "string", "example": "Tue, 12 Apr 2016 03:54:56 UTC"}
+	case reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schemaOf(t.Elem())}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Struct:
+		return s.ref(t)
+	}
+	panic(fmt.Errorf("No OpenAPI schema for %s", t))
+}
+
+// ref defines the schema of a struct type, and returns a reference to it.
+func (s *openAPISchemas) ref(t reflect.Type) map[string]interface{} {
+	name := t.Name()
+	if name == "" {
+		return s.object(t)
+	}
+	name = strings.ToUpper(name[:1]) + name[1:] // for unexported types, like importResult
+	if _, ok := s.schemas[name]; !ok {
+		s.schemas[name] = nil // for recursive types
+		s.schemas[name] = s.object(t)
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func (s *openAPISchemas) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	s.addFields(t, properties, &required)
+
+	out := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		out["required"] = required
+	}
+	return out
+}
+
+// addFields adds the fields of a struct type, and of the structs embedded in
+// it, as described by their json, sg, and validate tags.
+func (s *openAPISchemas) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			s.addFields(fieldType, properties, required)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		sg := tagParts(field.Tag.Get("sg"))
+		if sg["readonly"] && sg["private"] {
+			continue // never sent or returned
+		}
+
+		schema := make(map[string]interface{})
+		for k, v := range s.schemaOf(field.Type) {
+			schema[k] = v
+		}
+		if _, isRef := schema["$ref"]; isRef && (sg["readonly"] || sg["private"]) {
+			schema = map[string]interface{}{"allOf": []interface{}{schema}} // siblings of $ref are ignored
+		}
+		if sg["readonly"] {
+			schema["readOnly"] = true
+		}
+		if sg["private"] {
+			schema["writeOnly"] = true
+		}
+		if def, ok := tagValues(field.Tag.Get("sg"))["default"]; ok {
+			schema["default"] = typedTagValue(fieldType, def)
+		}
+
+		for key, value := range tagValues(field.Tag.Get("validate")) {
+			switch key {
+			case "min", "max":
+				addBound(schema, fieldType, key, value)
+			case "regexp":
+				schema["pattern"] = value
+			}
+		}
+		if tagParts(field.Tag.Get("validate"))["nonzero"] {
+			*required = append(*required, name)
+		}
+
+		properties[name] = schema
+	}
+}
+
+func addBound(schema map[string]interface{}, t reflect.Type, key string, value string) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return
+	}
+	switch t.Kind() {
+	case reflect.String:
+		schema[key+"Length"] = n
+	case reflect.Slice, reflect.Array, reflect.Map:
+		schema[key+"Items"] = n
+	default:
+		schema[key+"imum"] = n
+	}
+}
+
+func typedTagValue(t reflect.Type, value string) interface{} {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// tagParts returns the flags of a tag, e.g. readonly in sg:"readonly,nostore".
+func tagParts(tag string) map[string]bool {
+	out := make(map[string]bool)
+	for _, part := range strings.Split(tag, ",") {
+		if part != "" && !strings.Contains(part, "=") {
+			out[part] = true
+		}
+	}
+	return out
+}
+
+// tagValues returns the key=value parts of a tag, e.g. default=10.
+func tagValues(tag string) map[string]string {
+	out := make(map[string]string)
+	for _, part := range strings.Split(tag, ",") {
+		if kv := strings.SplitN(part, "=", 2); len(kv) == 2 {
+			out[kv[0]] = kv[1]
+		}
+	}
+	return out
+}
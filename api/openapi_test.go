@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var updateOpenAPI = flag.Bool("update-openapi", false, "write the generated OpenAPI document to openapi.json")
+
+func TestOpenAPI(t *testing.T) {
+	Convey("Given the OpenAPI document generated from the router", t, func() {
+		spec, err := openAPISpec(newRouter(nil))
+		So(err, ShouldBeNil)
+		generated, err := json.MarshalIndent(spec, "", "  ")
+		So(err, ShouldBeNil)
+		generated = append(generated, '\n')
+
+		if *updateOpenAPI {
+			So(ioutil.WriteFile("openapi.json", generated, 0644), ShouldBeNil)
+		}
+
+		Convey("It should match openapi.json (run go test ./api -update-openapi after changing routes or common types)", func() {
+			committed, err := ioutil.ReadFile("openapi.json")
+			So(err, ShouldBeNil)
+			So(string(generated), ShouldEqual, string(committed))
+		})
+
+		Convey("It should describe fields from their tags", func() {
+			schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+			user := schemas["User"].(map[string]interface{})["properties"].(map[string]interface{})
+			So(user["password"], ShouldResemble, map[string]interface{}{"type": "string", "writeOnly": true})
+			So(user, ShouldNotContainKey, "password_hash")
+
+			app := schemas["App"].(map[string]interface{})
+			So(app["required"], ShouldResemble, []string{"name"})
+
+			release := schemas["Release"].(map[string]interface{})["properties"].(map[string]interface{})
+			So(release["containers"].(map[string]interface{})["minItems"], ShouldEqual, 1)
+			count := release["instance_count"]
+			So(count, ShouldResemble, map[string]interface{}{"type": "integer", "minimum": 1, "default": 1})
+		})
+	})
+}
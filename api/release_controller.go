@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/gorilla/mux"
 	"github.com/supergiant/supergiant/core"
 )
 
@@ -26,10 +27,12 @@ func (c *ReleaseController) Create(w http.ResponseWriter, r *http.Request) {
 
 	err = component.Releases().Create(release)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
+	setAuditLocation(r, release)
+
 	body, err := marshalBody(w, release)
 	if err != nil {
 		return
@@ -43,6 +46,17 @@ func (c *ReleaseController) MergeCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// NOTE If-Match applies to the Component here, which gets the new Release
+	// as its target.
+	revision, err := ifMatchRevision(w, r)
+	if err != nil {
+		return
+	}
+	if revision != "" && revision != component.Revision {
+		renderError(w, &core.PreconditionFailedError{Revision: revision}, http.StatusPreconditionFailed)
+		return
+	}
+
 	release := component.Releases().New()
 	if err := unmarshalBodyInto(w, r, release); err != nil {
 		return
@@ -50,10 +64,12 @@ func (c *ReleaseController) MergeCreate(w http.ResponseWriter, r *http.Request)
 
 	err = component.Releases().MergeCreate(release)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
+	setAuditLocation(r, release)
+
 	body, err := marshalBody(w, release)
 	if err != nil {
 		return
@@ -67,9 +83,14 @@ func (c *ReleaseController) Index(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	releases, err := component.Releases().List()
+	opts, err := listOptions(w, r)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	releases, err := component.Releases().ListWithOptions(opts)
+	if err != nil {
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -112,8 +133,15 @@ func (c *ReleaseController) Update(w http.ResponseWriter, r *http.Request) {
 
 	core.ZeroReadonlyFields(release)
 
+	revision, err := ifMatchRevision(w, r)
+	if err != nil {
+		return
+	}
+	release.Revision = revision
+
 	if err := release.Patch(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		err = ifMatchError(err, revision)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -131,7 +159,7 @@ func (c *ReleaseController) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err = release.Delete(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 }
@@ -149,7 +177,7 @@ func (c *ReleaseController) Current(w http.ResponseWriter, r *http.Request) {
 
 	release, err := component.CurrentRelease()
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -172,7 +200,7 @@ func (c *ReleaseController) Target(w http.ResponseWriter, r *http.Request) {
 	}
 	release, err := component.TargetRelease()
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
 		return
 	}
 
@@ -182,3 +210,26 @@ func (c *ReleaseController) Target(w http.ResponseWriter, r *http.Request) {
 	}
 	renderWithStatusOK(w, body)
 }
+
+// Diff renders what changes when the Component moves from one Release to
+// another, e.g. .../releases/current/diff/target.
+func (c *ReleaseController) Diff(w http.ResponseWriter, r *http.Request) {
+	component, err := loadComponent(c.core, w, r)
+	if err != nil {
+		return
+	}
+	from, err := findRelease(component, w, mux.Vars(r)["release_timestamp"])
+	if err != nil {
+		return
+	}
+	to, err := findRelease(component, w, mux.Vars(r)["other_timestamp"])
+	if err != nil {
+		return
+	}
+
+	body, err := marshalBody(w, from.Diff(to))
+	if err != nil {
+		return
+	}
+	renderWithStatusOK(w, body)
+}
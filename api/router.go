@@ -1,12 +1,27 @@
 package api
 
 import (
+	"net/http"
+
 	"github.com/supergiant/supergiant/core"
 
+	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 )
 
-func NewRouter(core *core.Core) *mux.Router {
+// NewRouter returns the API handler. Every request to /v0 must be
+// authenticated, and every call that may change something is recorded in the
+// audit log. The time taken by every request is recorded in the metrics.
+func NewRouter(core *core.Core) http.Handler {
+	router := newRouter(core)
+
+	// NOTE the Principal is kept in the request context from authHandler on, so
+	// it is cleared here rather than by the router.
+	return &metricsHandler{router, context.ClearHandler(&authHandler{core, &auditHandler{core, &roleHandler{router}}})}
+}
+
+// newRouter returns the routes of the API.
+func newRouter(core *core.Core) *mux.Router {
 	r := mux.NewRouter()
 
 	s := r.PathPrefix("/v0").Subrouter()
@@ -22,6 +37,12 @@ func NewRouter(core *core.Core) *mux.Router {
 	instances := &InstanceController{core}
 	tasks := &TaskController{core}
 	nodes := &NodeController{core}
+	admin := &AdminController{core}
+	audit := &AuditController{core}
+	users := &UserController{core}
+	tokens := &APITokenController{core}
+	watch := &WatchController{core}
+	apply := &ApplyController{core}
 
 	s.HandleFunc("/registries/dockerhub/repos", imageRepos.Create).Methods("POST")
 	s.HandleFunc("/registries/dockerhub/repos", imageRepos.Index).Methods("GET")
@@ -59,16 +80,20 @@ func NewRouter(core *core.Core) *mux.Router {
 	s.HandleFunc("/apps/{app_name}/components/{comp_name}/releases/{release_timestamp}", releases.Show).Methods("GET")
 	s.HandleFunc("/apps/{app_name}/components/{comp_name}/releases/{release_timestamp}", releases.Update).Methods("PUT")
 	s.HandleFunc("/apps/{app_name}/components/{comp_name}/releases/{release_timestamp}", releases.Delete).Methods("DELETE")
+	s.HandleFunc("/apps/{app_name}/components/{comp_name}/releases/{release_timestamp}/diff/{other_timestamp}", releases.Diff).Methods("GET")
 
-	s.HandleFunc("/apps/{app_name}/components/{comp_name}/deploy", components.Deploy).Methods("POST")
+	s.HandleFunc("/apps/{app_name}/components/{comp_name}/deploy", auditAction("deploy", components.Deploy)).Methods("POST")
+	s.HandleFunc("/apps/{app_name}/components/{comp_name}/deploy/promote", auditAction("promote", components.Promote)).Methods("POST")
+	s.HandleFunc("/apps/{app_name}/components/{comp_name}/deploy/abort", auditAction("abort", components.Abort)).Methods("POST")
+	s.HandleFunc("/apps/{app_name}/components/{comp_name}/rollback", auditAction("rollback", components.Rollback)).Methods("POST")
 
 	// Integration
 
 	s.HandleFunc("/apps/{app_name}/components/{comp_name}/releases/{release_timestamp}/instances", instances.Index).Methods("GET")
 	s.HandleFunc("/apps/{app_name}/components/{comp_name}/releases/{release_timestamp}/instances/{instance_id}", instances.Show).Methods("GET")
 
-	s.HandleFunc("/apps/{app_name}/components/{comp_name}/releases/{release_timestamp}/instances/{instance_id}/start", instances.Start).Methods("POST")
-	s.HandleFunc("/apps/{app_name}/components/{comp_name}/releases/{release_timestamp}/instances/{instance_id}/stop", instances.Stop).Methods("POST")
+	s.HandleFunc("/apps/{app_name}/components/{comp_name}/releases/{release_timestamp}/instances/{instance_id}/start", auditAction("start", instances.Start)).Methods("POST")
+	s.HandleFunc("/apps/{app_name}/components/{comp_name}/releases/{release_timestamp}/instances/{instance_id}/stop", auditAction("stop", instances.Stop)).Methods("POST")
 
 	s.HandleFunc("/apps/{app_name}/components/{comp_name}/releases/{release_timestamp}/instances/{instance_id}/log", instances.Log).Methods("GET")
 
@@ -77,6 +102,40 @@ func NewRouter(core *core.Core) *mux.Router {
 	s.HandleFunc("/tasks", tasks.Index).Methods("GET")
 	s.HandleFunc("/tasks/{id}", tasks.Show).Methods("GET")
 	s.HandleFunc("/tasks/{id}", tasks.Delete).Methods("DELETE")
+	s.HandleFunc("/tasks/{id}/cancel", auditAction("cancel", tasks.Cancel)).Methods("POST")
+	s.HandleFunc("/tasks/{id}/retry", auditAction("retry", tasks.Retry)).Methods("POST")
+
+	// Admin
+
+	s.HandleFunc("/admin/export", admin.Export).Methods("GET")
+	s.HandleFunc("/admin/import", admin.Import).Methods("POST")
+
+	s.HandleFunc("/audit", audit.Index).Methods("GET")
+
+	s.HandleFunc("/users", users.Create).Methods("POST")
+	s.HandleFunc("/users", users.Index).Methods("GET")
+	s.HandleFunc("/users/{name}", users.Show).Methods("GET")
+	s.HandleFunc("/users/{name}", users.Update).Methods("PUT")
+	s.HandleFunc("/users/{name}", users.Delete).Methods("DELETE")
+
+	s.HandleFunc("/tokens", tokens.Create).Methods("POST")
+	s.HandleFunc("/tokens", tokens.Index).Methods("GET")
+	s.HandleFunc("/tokens/{id}", tokens.Show).Methods("GET")
+	s.HandleFunc("/tokens/{id}", tokens.Delete).Methods("DELETE")
+
+	s.HandleFunc("/watch", watch.Show).Methods("GET")
+
+	s.HandleFunc("/apply", apply.Apply).Methods("POST")
+
+	s.HandleFunc(openAPIPath, openAPIHandler(r)).Methods("GET")
+
+	// Probes and metrics, outside /v0
+
+	health := &HealthController{core}
+
+	r.HandleFunc("/healthz", health.Healthz).Methods("GET")
+	r.HandleFunc("/readyz", health.Readyz).Methods("GET")
+	r.HandleFunc("/metrics", health.Metrics).Methods("GET")
 
 	return r
 }
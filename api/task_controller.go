@@ -10,14 +10,38 @@ type TaskController struct {
 	core *core.Core
 }
 
+// Index lists Tasks. With ?status=FAILED or ?status=CANCELLED it lists the
+// FailedTasks with that status instead; any other status value filters the
+// active Tasks. Like every Index, it takes the tags, sort, limit and continue
+// params.
 func (c *TaskController) Index(w http.ResponseWriter, r *http.Request) {
-	tasks, err := c.core.Tasks().List()
+	status := r.URL.Query().Get("status")
+
+	opts, err := listOptions(w, r)
 	if err != nil {
-		renderError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	body, err := marshalBody(w, tasks)
+	var list interface{}
+	if status == "FAILED" || status == "CANCELLED" {
+		opts.Where = func(item core.Resource) bool {
+			return item.(*core.FailedTaskResource).Status == status
+		}
+		list, err = c.core.FailedTasks().ListWithOptions(opts)
+	} else {
+		if status != "" {
+			opts.Where = func(item core.Resource) bool {
+				return item.(*core.TaskResource).Status == status
+			}
+		}
+		list, err = c.core.Tasks().ListWithOptions(opts)
+	}
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	body, err := marshalBody(w, list)
 	if err != nil {
 		return
 	}
@@ -44,7 +68,46 @@ func (c *TaskController) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := task.Delete(); err != nil {
-		renderError(w, err, http.StatusInternalServerError)
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	body, err := marshalBody(w, task)
+	if err != nil {
+		return
+	}
+	renderWithStatusAccepted(w, body)
+}
+
+// Cancel requests cancellation of a queued or running Task.
+func (c *TaskController) Cancel(w http.ResponseWriter, r *http.Request) {
+	task, err := loadTask(c.core, w, r)
+	if err != nil {
+		return
+	}
+
+	if err := task.Cancel(); err != nil {
+		renderError(w, err, http.StatusConflict)
+		return
+	}
+
+	body, err := marshalBody(w, task)
+	if err != nil {
+		return
+	}
+	renderWithStatusAccepted(w, body)
+}
+
+// Retry requeues a FailedTask, and renders the new Task.
+func (c *TaskController) Retry(w http.ResponseWriter, r *http.Request) {
+	failedTask, err := loadFailedTask(c.core, w, r)
+	if err != nil {
+		return
+	}
+
+	task, err := failedTask.Retry()
+	if err != nil {
+		renderError(w, err, http.StatusConflict)
 		return
 	}
 
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"sync"
+)
+
+// TLSCertificates holds the certificate the API is served with, and the CA
+// certificates client certificates are verified against when mutual TLS is
+// required. The certificate is read again by Reload, so that a renewed one is
+// picked up without a restart.
+//
+// NOTE the client CA certificates are only read on start. Swapping them on a
+// running server needs tls.Config.GetConfigForClient, which is Go 1.8, and
+// supergiant is built with Go 1.6.
+type TLSCertificates struct {
+	certFile  string
+	keyFile   string
+	clientCAs *x509.CertPool // nil unless mutual TLS is required
+
+	mutex sync.RWMutex
+	cert  *tls.Certificate
+}
+
+// NewTLSCertificates reads a certificate and key, and the PEM encoded CA
+// certificates in clientCAFile if it is not empty.
+func NewTLSCertificates(certFile string, keyFile string, clientCAFile string) (*TLSCertificates, error) {
+	c := &TLSCertificates{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if clientCAFile != "" {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		c.clientCAs = x509.NewCertPool()
+		if !c.clientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No certificates found in " + clientCAFile)
+		}
+	}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the certificate and key again. If they cannot be read, the
+// certificate in use is kept.
+func (c *TLSCertificates) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cert = &cert
+	return nil
+}
+
+// Config returns the TLS config to serve the API with. Every connection uses
+// the certificate as of its handshake.
+func (c *TLSCertificates) Config() *tls.Config {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.getCertificate,
+	}
+	if c.clientCAs != nil {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = c.clientCAs
+	}
+	return config
+}
+
+func (c *TLSCertificates) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.cert, nil
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// writeTestCertificate writes a self-signed certificate for commonName, and
+// its key, to certFile and keyFile.
+func writeTestCertificate(certFile string, keyFile string, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		panic(err)
+	}
+}
+
+func servedCommonName(certs *TLSCertificates) string {
+	cert, err := certs.Config().GetCertificate(nil)
+	So(err, ShouldBeNil)
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	So(err, ShouldBeNil)
+	return parsed.Subject.CommonName
+}
+
+func TestTLSCertificates(t *testing.T) {
+	Convey("Given TLSCertificates read from files", t, func() {
+		dir, err := ioutil.TempDir("", "supergiant-tls")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		writeTestCertificate(certFile, keyFile, "first")
+		certs, err := NewTLSCertificates(certFile, keyFile, "")
+		So(err, ShouldBeNil)
+		So(servedCommonName(certs), ShouldEqual, "first")
+
+		Convey("Reload should serve the renewed certificate", func() {
+			writeTestCertificate(certFile, keyFile, "second")
+			So(certs.Reload(), ShouldBeNil)
+			So(servedCommonName(certs), ShouldEqual, "second")
+		})
+
+		Convey("Reload should keep the certificate in use if the files are broken", func() {
+			So(ioutil.WriteFile(keyFile, []byte("broken"), 0600), ShouldBeNil)
+			So(certs.Reload(), ShouldNotBeNil)
+			So(servedCommonName(certs), ShouldEqual, "first")
+		})
+
+		Convey("Without client CA certificates, none should be required", func() {
+			So(certs.Config().ClientCAs, ShouldBeNil)
+		})
+
+		Convey("With client CA certificates, they should be required", func() {
+			withCA, err := NewTLSCertificates(certFile, keyFile, certFile)
+			So(err, ShouldBeNil)
+			So(withCA.Config().ClientCAs, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/supergiant/supergiant/core"
+)
+
+type UserController struct {
+	core *core.Core
+}
+
+func (c *UserController) Create(w http.ResponseWriter, r *http.Request) {
+	user := c.core.Users().New()
+
+	if err := unmarshalBodyInto(w, r, user); err != nil {
+		return
+	}
+
+	core.ZeroReadonlyFields(user)
+
+	err := c.core.Users().Create(user)
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	setAuditLocation(r, user)
+
+	core.ZeroPrivateFields(user)
+
+	body, err := marshalBody(w, user)
+	if err != nil {
+		return
+	}
+	renderWithStatusCreated(w, body)
+}
+
+func (c *UserController) Index(w http.ResponseWriter, r *http.Request) {
+	opts, err := listOptions(w, r)
+	if err != nil {
+		return
+	}
+
+	users, err := c.core.Users().ListWithOptions(opts)
+	if err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	for _, user := range users.Items {
+		core.ZeroPrivateFields(user)
+	}
+
+	body, err := marshalBody(w, users)
+	if err != nil {
+		return
+	}
+	renderWithStatusOK(w, body)
+}
+
+func (c *UserController) Show(w http.ResponseWriter, r *http.Request) {
+	user, err := loadUser(c.core, w, r)
+	if err != nil {
+		return
+	}
+
+	core.ZeroPrivateFields(user)
+
+	body, err := marshalBody(w, user)
+	if err != nil {
+		return
+	}
+	renderWithStatusOK(w, body)
+}
+
+// Update changes the Roles of a User, and its password if a new one is given.
+// The Roles given replace the current ones, so "roles": [] removes them all.
+func (c *UserController) Update(w http.ResponseWriter, r *http.Request) {
+	user, err := loadUser(c.core, w, r)
+	if err != nil {
+		return
+	}
+	passwordHash, loadedRevision := user.PasswordHash, user.Revision
+
+	if err := unmarshalBodyInto(w, r, user); err != nil {
+		return
+	}
+
+	core.ZeroReadonlyFields(user)
+
+	// NOTE the User is updated rather than patched, since a merge would fill an
+	// empty list of Roles back in. The write is conditional on the revision
+	// loaded, unless another is given with If-Match.
+	user.PasswordHash = passwordHash
+	revision, err := ifMatchRevision(w, r)
+	if err != nil {
+		return
+	}
+	user.Revision = loadedRevision
+	if revision != "" {
+		user.Revision = revision
+	}
+
+	if err := user.Update(); err != nil {
+		err = ifMatchError(err, revision)
+		renderError(w, err, errorStatus(err))
+		return
+	}
+
+	core.ZeroPrivateFields(user)
+
+	body, err := marshalBody(w, user)
+	if err != nil {
+		return
+	}
+	renderWithStatusAccepted(w, body)
+}
+
+// Delete deletes a User, and revokes its APITokens.
+func (c *UserController) Delete(w http.ResponseWriter, r *http.Request) {
+	user, err := loadUser(c.core, w, r)
+	if err != nil {
+		return
+	}
+	if err = user.Delete(); err != nil {
+		renderError(w, err, errorStatus(err))
+		return
+	}
+}
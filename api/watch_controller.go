@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/supergiant/supergiant/common"
+	"github.com/supergiant/supergiant/core"
+)
+
+type WatchController struct {
+	core *core.Core
+}
+
+// Show streams a WatchEvent for every change to the Resources at ?path= (an
+// API path like /apps/search; / by default) and under it, until the client
+// disconnects. Events are newline-delimited JSON, or Server-Sent Events named
+// after the event type when the request accepts text/event-stream. Only
+// changes to Resources the Principal can read are sent.
+func (c *WatchController) Show(w http.ResponseWriter, r *http.Request) {
+	location := path.Clean("/" + r.URL.Query().Get("path"))
+	principal := requestPrincipal(r)
+	if role, app := requiredRole("GET", "/v0"+location); role != "" && !principal.Can(role, app) {
+		renderError(w, roleError(principal, role, app), http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := requestContext(w)
+	defer cancel()
+
+	watcher := c.core.Watch(location)
+	defer watcher.Close()
+
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		event, err := watcher.Next(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				core.Log.Errorf("Watch of %s failed: %s", location, err)
+			}
+			return
+		}
+		if !canWatch(principal, event) {
+			continue
+		}
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			core.Log.Errorf("Watch of %s failed: %s", location, err)
+			return
+		}
+		if sse {
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		} else {
+			_, err = fmt.Fprintf(w, "%s\n", data)
+		}
+		if err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// canWatch returns true if the Principal could GET the Resource of an event.
+func canWatch(principal *core.Principal, event *common.WatchEvent) bool {
+	if role, app := requiredRole("GET", "/v0"+event.Location); role != "" {
+		return principal.Can(role, app)
+	}
+
+	// APITokens, which only their User and install-wide admins can see. Deletes
+	// have no Resource to tell the User by, so only admins see them.
+	if principal.Can(core.RoleAdmin, nil) {
+		return true
+	}
+	token := new(common.APIToken)
+	return json.Unmarshal(event.Resource, token) == nil && token.User != nil && *token.User == principal.Name
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/supergiant/core"
+)
+
+func TestWatchDisconnect(t *testing.T) {
+	Convey("Given a watch served through the router", t, func() {
+		c := &core.Core{Store: "memory", AdminPassword: "secret"}
+		So(c.Open(), ShouldBeNil)
+
+		router := NewRouter(c)
+		served := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer close(served)
+			router.ServeHTTP(w, r)
+		}))
+
+		req, _ := http.NewRequest("GET", server.URL+"/v0/watch?path=/apps", nil)
+		req.SetBasicAuth("admin", "secret")
+		cancel := make(chan struct{})
+		req.Cancel = cancel
+		resp, err := http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+
+		Convey("Disconnecting should end the watch, closing its Watcher", func() {
+			close(cancel)
+			resp.Body.Close()
+
+			select {
+			case <-served:
+				server.Close()
+			case <-time.After(5 * time.Second):
+				// NOTE the server is left open, since closing it would wait for the
+				// watch forever.
+				So("the watch to end", ShouldBeEmpty)
+			}
+		})
+	})
+}
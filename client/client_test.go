@@ -1,11 +1,20 @@
 package client
 
 import (
+	"bufio"
 	"crypto/tls"
+	"encoding/pem"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
 )
 
 func TestNewClient(t *testing.T) {
@@ -32,3 +41,280 @@ func TestNewClient(t *testing.T) {
 		})
 	})
 }
+
+func TestClientAuth(t *testing.T) {
+	Convey("Given an API server that records the Authorization header", t, func() {
+		var header string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header.Get("Authorization")
+		}))
+		defer server.Close()
+
+		Convey("A Client with a token should send it as a Bearer token", func() {
+			So(NewWithToken(server.URL, "abc.def", true).Delete("apps/test"), ShouldBeNil)
+			So(header, ShouldEqual, "Bearer abc.def")
+		})
+
+		Convey("A Client with a username and password should use basic auth", func() {
+			So(New(server.URL, "user", "pass", true).Delete("apps/test"), ShouldBeNil)
+			So(header, ShouldStartWith, "Basic ")
+		})
+	})
+}
+
+func TestClientTLS(t *testing.T) {
+	Convey("Given an HTTPS API server", t, func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		Convey("A Client with its CA bundle should verify it", func() {
+			caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]})
+			client, err := NewWithCA(server.URL, "user", "pass", caBundle)
+			So(err, ShouldBeNil)
+			So(client.Delete("apps/test"), ShouldBeNil)
+		})
+
+		Convey("A Client verifying against the system roots should not", func() {
+			So(New(server.URL, "user", "pass", false).Delete("apps/test"), ShouldNotBeNil)
+		})
+
+		Convey("An empty CA bundle should be rejected", func() {
+			_, err := NewWithCA(server.URL, "user", "pass", nil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a local Client for an API handler", t, func() {
+		var path string
+		client := NewLocal(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			w.WriteHeader(http.StatusNotFound)
+		}), "abc.def")
+
+		Convey("It should call the handler directly", func() {
+			So(client.Delete("apps/test"), ShouldNotBeNil)
+			So(path, ShouldEqual, "/v0/apps/test")
+		})
+	})
+
+	Convey("Given a local Client for an API handler that renders JSON", t, func() {
+		client := NewLocal(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"name":"test"}`)
+		}), "abc.def")
+
+		Convey("It should read the body the handler wrote", func() {
+			app := new(App)
+			So(client.Get("apps/test", app), ShouldBeNil)
+			So(common.StringID(app.Name), ShouldEqual, "test")
+		})
+	})
+}
+
+func TestInstanceLog(t *testing.T) {
+	Convey("Given an API server that streams a log until told to stop", t, func() {
+		var query url.Values
+		stop := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			fmt.Fprintln(w, "first line")
+			w.(http.Flusher).Flush()
+			<-stop
+			fmt.Fprintln(w, "last line")
+		}))
+		defer server.Close()
+		defer close(stop)
+
+		client := New(server.URL+"/v0", "user", "pass", true)
+		app := client.Apps().New(&App{Name: common.IDString("test")})
+		component := app.Components().New(&Component{Name: common.IDString("web")})
+		release := component.Releases().New(&Release{Timestamp: common.IDString("20160412035456")})
+		instance := release.Instances().New(&Instance{ID: common.IDString("0")})
+
+		Convey("Log should return lines as they are sent", func() {
+			stream, err := instance.Log(context.Background(), &LogOptions{Container: "nginx", Tail: 10, Since: 5 * time.Minute, Follow: true})
+			So(err, ShouldBeNil)
+			defer stream.Close()
+
+			line, err := bufio.NewReader(stream).ReadString('\n')
+			So(err, ShouldBeNil)
+			So(line, ShouldEqual, "first line\n")
+			So(query.Get("container"), ShouldEqual, "nginx")
+			So(query.Get("tail"), ShouldEqual, "10")
+			So(query.Get("since"), ShouldEqual, "5m0s")
+			So(query.Get("follow"), ShouldEqual, "true")
+			So(query.Get("previous"), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestWatch(t *testing.T) {
+	Convey("Given an API server that streams two WatchEvents", t, func() {
+		var query url.Values
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			fmt.Fprintln(w, `{"type":"created","kind":"App","location":"/apps/test","resource":{"name":"test"}}`)
+			fmt.Fprintln(w, `{"type":"deleted","kind":"App","location":"/apps/test"}`)
+		}))
+		defer server.Close()
+
+		client := New(server.URL+"/v0", "user", "pass", true)
+
+		Convey("Watch should send them on the channel, and close it when the stream ends", func() {
+			events, err := client.Watch(context.Background(), "/apps/test")
+			So(err, ShouldBeNil)
+			So(query.Get("path"), ShouldEqual, "/apps/test")
+
+			event := <-events
+			So(event.Type, ShouldEqual, "created")
+			So(string(event.Resource), ShouldEqual, `{"name":"test"}`)
+			event = <-events
+			So(event.Type, ShouldEqual, "deleted")
+			_, open := <-events
+			So(open, ShouldBeFalse)
+		})
+	})
+}
+
+func TestApply(t *testing.T) {
+	Convey("Given an API server that applies Manifests", t, func() {
+		var path, query string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path, query = r.URL.Path, r.URL.RawQuery
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, `{"dry_run":true,"changes":[{"action":"create","kind":"App","location":"/apps/test"}]}`)
+		}))
+		defer server.Close()
+
+		client := New(server.URL+"/v0", "user", "pass", true)
+
+		Convey("A dry run of Apply should return the changes", func() {
+			result, err := client.Apply(&Manifest{App: &common.App{Name: common.IDString("test")}}, true)
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "/v0/apply")
+			So(query, ShouldEqual, "dry_run=true")
+			So(result.DryRun, ShouldBeTrue)
+			So(result.Changes[0].Location, ShouldEqual, "/apps/test")
+		})
+	})
+}
+
+func TestReleaseDiff(t *testing.T) {
+	Convey("Given an API server that diffs Releases", t, func() {
+		var path string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			fmt.Fprint(w, `{"from":"20160412035456","to":"20160413035456","changes":[{"field":"instance_count","from":2,"to":3,"effect":"scale"}],"restart":false,"scale_only":true}`)
+		}))
+		defer server.Close()
+
+		client := New(server.URL+"/v0", "user", "pass", true)
+		app := client.Apps().New(&App{Name: common.IDString("test")})
+		component := app.Components().New(&Component{Name: common.IDString("web")})
+		release := component.Releases().New(&Release{Timestamp: common.IDString("20160412035456")})
+
+		Convey("Diff should return the changes to the other Release", func() {
+			diff, err := release.Diff("target")
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "/v0/apps/test/components/web/releases/20160412035456/diff/target")
+			So(diff.ScaleOnly, ShouldBeTrue)
+			So(diff.Changes[0].Field, ShouldEqual, "instance_count")
+		})
+	})
+}
+
+func TestErrors(t *testing.T) {
+	Convey("Given an API server that rejects requests", t, func() {
+		var status int
+		var body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			fmt.Fprint(w, body)
+		}))
+		defer server.Close()
+
+		client := New(server.URL+"/v0", "user", "pass", true)
+
+		Convey("A validation error should be decoded with its fields", func() {
+			status = http.StatusBadRequest
+			body = `{"status":400,"code":"validation_failed","error":"Validation failed: name: regular expression mismatch","fields":[{"path":"name","error":"regular expression mismatch"}]}`
+
+			_, err := client.Apps().Create(&App{Name: common.IDString("Not Valid")})
+			So(ErrorCode(err), ShouldEqual, common.ErrorCodeValidation)
+			So(err.(*Error).Status, ShouldEqual, http.StatusBadRequest)
+			So(err.(*Error).Fields[0].Path, ShouldEqual, "name")
+			So(err.Error(), ShouldContainSubstring, "regular expression mismatch")
+		})
+
+		Convey("A not-found error should be told apart", func() {
+			status = http.StatusNotFound
+			body = `{"status":404,"code":"not_found","error":"App not found"}`
+
+			_, err := client.Apps().Get(common.IDString("missing"))
+			So(IsNotFoundErr(err), ShouldBeTrue)
+		})
+
+		Convey("A response without an error body should still have a code", func() {
+			status = http.StatusBadGateway
+			body = "Bad Gateway"
+
+			_, err := client.Apps().Get(common.IDString("test"))
+			So(ErrorCode(err), ShouldEqual, common.ErrorCodeInternal)
+			So(err.(*Error).Status, ShouldEqual, http.StatusBadGateway)
+		})
+	})
+}
+
+func TestComponentRollback(t *testing.T) {
+	Convey("Given an API server that rolls Components back", t, func() {
+		var path, query string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path, query = r.URL.Path, r.URL.RawQuery
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"timestamp":"20160414035456","rollback":{"source":"20160412035456","from":"20160413035456"}}`)
+		}))
+		defer server.Close()
+
+		client := New(server.URL+"/v0", "user", "pass", true)
+		app := client.Apps().New(&App{Name: common.IDString("test")})
+		component := app.Components().New(&Component{Name: common.IDString("web")})
+
+		Convey("Rollback should return the new Release", func() {
+			release, err := component.Rollback("20160412035456")
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "/v0/apps/test/components/web/rollback")
+			So(query, ShouldEqual, "release=20160412035456")
+			So(*release.Timestamp, ShouldEqual, "20160414035456")
+			So(*release.Rollback.Source, ShouldEqual, "20160412035456")
+		})
+	})
+}
+
+func TestComponentPromote(t *testing.T) {
+	Convey("Given an API server with a canary deploy", t, func() {
+		var path string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"timestamp":"20160414035456","canary":{"instances":1,"started":"Thu, 14 Apr 2016 03:55:00 UTC","promoted":"Thu, 14 Apr 2016 04:05:00 UTC"}}`)
+		}))
+		defer server.Close()
+
+		client := New(server.URL+"/v0", "user", "pass", true)
+		app := client.Apps().New(&App{Name: common.IDString("test")})
+		component := app.Components().New(&Component{Name: common.IDString("web")})
+
+		Convey("Promote should return the target Release with its canaries promoted", func() {
+			release, err := component.Promote()
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "/v0/apps/test/components/web/deploy/promote")
+			So(release.Canary.Instances, ShouldEqual, 1)
+			So(release.Canary.Promoted, ShouldNotBeNil)
+		})
+
+		Convey("Abort should post to the abort action of the Component", func() {
+			_, err := component.Abort()
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "/v0/apps/test/components/web/deploy/abort")
+		})
+	})
+}
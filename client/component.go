@@ -2,6 +2,7 @@ package client
 
 import (
 	"errors"
+	"net/url"
 	"path"
 
 	"github.com/supergiant/supergiant/common"
@@ -94,6 +95,40 @@ func (r *ComponentResource) Deploy() error {
 	return r.collection.client.Post(r.path()+"/deploy", nil, nil)
 }
 
+// Promote lets a canary deploy of the Component go on to the rest of the
+// Instances, without waiting out the pause.
+func (r *ComponentResource) Promote() (*ReleaseResource, error) {
+	release := r.Releases().New(new(Release))
+	if err := r.collection.client.Post(r.path()+"/deploy/promote", nil, release.Release); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// Abort ends a canary deploy of the Component, removing its canaries and
+// keeping the current Release.
+func (r *ComponentResource) Abort() (*ReleaseResource, error) {
+	release := r.Releases().New(new(Release))
+	if err := r.collection.client.Post(r.path()+"/deploy/abort", nil, release.Release); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// Rollback deploys a new Release cloned from a retired one, given by
+// timestamp, or the most recent one when timestamp is empty.
+func (r *ComponentResource) Rollback(timestamp string) (*ReleaseResource, error) {
+	path := r.path() + "/rollback"
+	if timestamp != "" {
+		path += "?release=" + url.QueryEscape(timestamp)
+	}
+	release := r.Releases().New(new(Release))
+	if err := r.collection.client.Post(path, nil, release.Release); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
 // Relations
 func (r *ComponentResource) Releases() *ReleaseCollection {
 	return &ReleaseCollection{
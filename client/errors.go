@@ -0,0 +1,59 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+// Error is an error response of the API. Code is one of the
+// common.ErrorCode values, which, unlike Message, can be relied on.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+
+	// Fields are the invalid fields of the request, when Code is
+	// common.ErrorCodeValidation.
+	Fields []*common.FieldError
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("Request failed with status %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("Request failed with status %d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// ErrorCode returns the code of an error response of the API, or an empty
+// string for other errors (e.g. the API being unreachable).
+func ErrorCode(err error) string {
+	if e, ok := err.(*Error); ok {
+		return e.Code
+	}
+	return ""
+}
+
+// IsNotFoundErr returns true if the error is a response of the API for
+// something that does not exist.
+func IsNotFoundErr(err error) bool {
+	return ErrorCode(err) == common.ErrorCodeNotFound
+}
+
+// responseError decodes the Error of a response that did not succeed, and
+// closes its body.
+func responseError(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	e := &Error{Status: resp.StatusCode, Code: common.ErrorCodeInternal}
+	body := new(common.Error)
+	if data, err := ioutil.ReadAll(resp.Body); err == nil && json.Unmarshal(data, body) == nil && body.Code != "" {
+		e.Code = body.Code
+		e.Message = body.Error
+		e.Fields = body.Fields
+	}
+	return e
+}
@@ -2,10 +2,14 @@ package client
 
 import (
 	"fmt"
+	"io"
+	"net/url"
 	"path"
+	"strconv"
 	"time"
 
 	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
 )
 
 type Instance common.Instance
@@ -101,13 +105,46 @@ func (r *InstanceResource) Stop() error {
 	return r.collection.client.Post(r.path()+"/stop", nil, nil)
 }
 
-func (r *InstanceResource) WaitForStarted() error {
+// LogOptions select the part of an Instance log that Log reads. See the
+// API docs of the log endpoint.
+type LogOptions struct {
+	Container  string
+	Tail       int
+	Since      time.Duration
+	Previous   bool
+	Follow     bool
+	Timestamps bool
+}
+
+// Log returns a reader of the log of the Instance, which the caller must
+// close. With Follow, reading only ends when the container stops, or ctx is
+// done.
+func (r *InstanceResource) Log(ctx context.Context, opts *LogOptions) (io.ReadCloser, error) {
+	query := url.Values{}
+	if opts.Container != "" {
+		query.Set("container", opts.Container)
+	}
+	if opts.Tail > 0 {
+		query.Set("tail", strconv.Itoa(opts.Tail))
+	}
+	if opts.Since > 0 {
+		query.Set("since", opts.Since.String())
+	}
+	for param, set := range map[string]bool{"previous": opts.Previous, "follow": opts.Follow, "timestamps": opts.Timestamps} {
+		if set {
+			query.Set(param, "true")
+		}
+	}
+	return r.collection.client.stream(ctx, r.path()+"/log", query)
+}
+
+func (r *InstanceResource) WaitForStarted(ctx context.Context) error {
 
 	// NOTE wait is set extremely high for instance start, since it can take a
 	// very long time for snapshots on large volumes (when resizing volumes).
 
 	desc := fmt.Sprintf("Instance start: %s", r.Name)
-	return common.WaitFor(desc, 4*time.Hour, 5*time.Second, func() (bool, error) {
+	return common.WaitFor(ctx, desc, 4*time.Hour, 5*time.Second, func() (bool, error) {
 		if err := r.Reload(); err != nil {
 			return false, err
 		}
@@ -115,13 +152,13 @@ func (r *InstanceResource) WaitForStarted() error {
 	})
 }
 
-func (r *InstanceResource) WaitForStopped() error {
+func (r *InstanceResource) WaitForStopped(ctx context.Context) error {
 
 	// TODO instead of an arbitrarily high timeout, this could maybe be adjusted
 	// dynamically based on the TerminationGracePeriod setting.
 
 	desc := fmt.Sprintf("Instance stop: %s", r.Name)
-	return common.WaitFor(desc, 10*time.Minute, 3*time.Second, func() (bool, error) {
+	return common.WaitFor(ctx, desc, 10*time.Minute, 3*time.Second, func() (bool, error) {
 		if err := r.Reload(); err != nil {
 			return false, err
 		}
@@ -0,0 +1,22 @@
+package client
+
+import "github.com/supergiant/supergiant/common"
+
+type Manifest common.Manifest
+
+type ManifestResult common.ManifestResult
+
+// Apply makes the App of a Manifest, and the Resources it uses, match it,
+// deploying the Components whose Release changed. With dryRun, the changes
+// are only returned.
+func (c *Client) Apply(m *Manifest, dryRun bool) (*ManifestResult, error) {
+	path := "apply"
+	if dryRun {
+		path += "?dry_run=true"
+	}
+	result := new(ManifestResult)
+	if err := c.Post(path, m, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -95,6 +95,18 @@ func (r *ReleaseResource) Delete() error {
 	return r.collection.client.Delete(r.path())
 }
 
+type ReleaseDiff common.ReleaseDiff
+
+// Diff returns what changes when the Component moves from this Release to
+// another one, given by timestamp, or as "current" or "target".
+func (r *ReleaseResource) Diff(to string) (*ReleaseDiff, error) {
+	diff := new(ReleaseDiff)
+	if err := r.collection.client.Get(path.Join(r.path(), "diff", to), diff); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
 // Relations
 func (r *ReleaseResource) Instances() *InstanceCollection {
 	return &InstanceCollection{
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+
+	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
+)
+
+type WatchEvent common.WatchEvent
+
+// Watch returns a channel of the changes to the Resources at location (an API
+// path like apps/search, or / for everything) and under it. The channel is
+// closed when ctx is done, or the connection is lost.
+func (c *Client) Watch(ctx context.Context, location string) (<-chan *WatchEvent, error) {
+	stream, err := c.stream(ctx, "watch", url.Values{"path": {location}})
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan *WatchEvent)
+	go func() {
+		defer close(events)
+		defer stream.Close()
+
+		decoder := json.NewDecoder(stream)
+		for {
+			event := new(WatchEvent)
+			if err := decoder.Decode(event); err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					Log.Errorf("Watch of %s ended: %s", location, err)
+				}
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
@@ -2,10 +2,16 @@ package common
 
 import (
 	"fmt"
+	"strconv"
 	"time"
+
+	"golang.org/x/net/context"
 )
 
-func WaitFor(desc string, d time.Duration, i time.Duration, fn func() (bool, error)) error {
+// WaitFor calls fn every interval i until it returns true, returns an error,
+// the duration d has passed, or ctx is done. When ctx is done, ctx.Err() is
+// returned.
+func WaitFor(ctx context.Context, desc string, d time.Duration, i time.Duration, fn func() (bool, error)) error {
 	started := time.Now()
 	for {
 		elapsed := time.Since(started)
@@ -17,7 +23,11 @@ func WaitFor(desc string, d time.Duration, i time.Duration, fn func() (bool, err
 		} else if err != nil {
 			return err
 		}
-		time.Sleep(i)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(i):
+		}
 	}
 }
 
@@ -37,3 +47,12 @@ func NewMeta() *Meta {
 		Tags: make(Tags),
 	}
 }
+
+// ETag returns the Revision as an HTTP entity tag, or an empty string if there
+// is no Revision.
+func (m *Meta) ETag() string {
+	if m == nil || m.Revision == "" {
+		return ""
+	}
+	return strconv.Quote(m.Revision)
+}
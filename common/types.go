@@ -1,5 +1,7 @@
 package common
 
+import "encoding/json"
+
 // App is the main top-level Resource within Supergiant, acting as a logical
 // namespace for Components and all of their controlled assets -- along with
 // provisioning an actual Kubernetes Namespace, it is used as a base name for
@@ -14,6 +16,18 @@ type Component struct {
 
 	CustomDeployScript *CustomDeployScript `json:"custom_deploy_script"`
 
+	// Strategy is how a deploy that restarts the Instances replaces them (unless
+	// there is a CustomDeployScript): DeployStrategyRolling, the default,
+	// DeployStrategyBlueGreen or DeployStrategyCanary.
+	Strategy string `json:"strategy,omitempty" validate:"regexp=^(rolling|bluegreen|canary)?$"`
+
+	// Canary configures deploys with DeployStrategyCanary.
+	Canary *CanaryOptions `json:"canary,omitempty"`
+
+	// Rolling configures how many Instances are replaced at a time by deploys
+	// with DeployStrategyRolling, and the rest of DeployStrategyCanary ones.
+	Rolling *RollingOptions `json:"rolling,omitempty"`
+
 	CurrentReleaseTimestamp ID `json:"current_release_id" sg:"readonly"`
 	TargetReleaseTimestamp  ID `json:"target_release_id" sg:"readonly"`
 
@@ -22,6 +36,40 @@ type Component struct {
 	*Meta
 }
 
+// CanaryOptions configure how long the canaries of a deploy run, and what
+// they may do, before the rest of the Instances are replaced.
+type CanaryOptions struct {
+	// Instances is how many Instances of the target Release are started as
+	// canaries (1 when 0).
+	Instances int `json:"instances" validate:"min=0"`
+
+	// Pause is how long, in seconds, the canaries run before the deploy goes on,
+	// unless promoted sooner. When 0, the deploy waits until they are promoted,
+	// or aborted, for at most a day.
+	Pause int `json:"pause" validate:"min=0"`
+
+	// MaxRestarts is how many times the containers of the canaries may restart
+	// before the deploy is aborted.
+	MaxRestarts int `json:"max_restarts" validate:"min=0"`
+}
+
+// RollingOptions configure how many Instances a rolling deploy replaces at a
+// time. With neither MaxUnavailable nor MaxSurge, it is one at a time.
+type RollingOptions struct {
+	// MaxUnavailable is how many Instances may be stopped at a time, each until
+	// the one replacing it is ready.
+	MaxUnavailable int `json:"max_unavailable" validate:"min=0"`
+
+	// MaxSurge is how many Instances may be started on top of the InstanceCount
+	// at a time, each stopping the one it replaces once ready. It is not used
+	// for Releases with volumes, which would be attached to both.
+	MaxSurge int `json:"max_surge" validate:"min=0"`
+
+	// MinReadySeconds is how long a new Instance must have been started before
+	// it counts as ready.
+	MinReadySeconds int `json:"min_ready_seconds" validate:"min=0"`
+}
+
 // NOTE the word Blueprint is used for Volumes and Containers, since they are
 // both "definitions" that create "instances" of the real thing
 type Release struct {
@@ -64,9 +112,82 @@ type Release struct {
 	// Committed defines whether or not a Release is being / has been deployed.
 	Committed bool `json:"committed" sg:"readonly"`
 
+	// Rollback is set on Releases created by rolling the Component back.
+	Rollback *ReleaseRollback `json:"rollback,omitempty" sg:"readonly"`
+
+	// Canary is set while the Release is deployed with DeployStrategyCanary,
+	// once its canaries are started.
+	Canary *ReleaseCanary `json:"canary,omitempty" sg:"readonly"`
+
 	*Meta
 }
 
+// ReleaseRollback records the rollback a Release was created by.
+type ReleaseRollback struct {
+	// Source is the Timestamp of the retired Release the blueprint was cloned
+	// from.
+	Source ID `json:"source"`
+
+	// From is the Timestamp of the Release the Component was rolled back from,
+	// i.e. its current Release at the time.
+	From ID `json:"from"`
+
+	// Timestamp is when the rollback was made.
+	Timestamp *Timestamp `json:"timestamp"`
+}
+
+// ReleaseCanary is the state of the canaries of a Release being deployed.
+type ReleaseCanary struct {
+	// Instances is how many of the Instances, from the first, are canaries.
+	Instances int `json:"instances"`
+
+	// Started is when the canaries were started.
+	Started *Timestamp `json:"started"`
+
+	// Promoted is when the canaries were promoted, if they were.
+	Promoted *Timestamp `json:"promoted,omitempty"`
+
+	// Aborted is when the deploy was aborted, if it was. The canaries are
+	// removed (along with this state) by the deploy once it sees it.
+	Aborted *Timestamp `json:"aborted,omitempty"`
+}
+
+// ReleaseDiff is what changes when a Component moves from one Release to
+// another.
+type ReleaseDiff struct {
+	From ID `json:"from"`
+	To   ID `json:"to"`
+
+	Changes []*ReleaseChange `json:"changes"`
+
+	// Restart is true when the Instances are restarted on deploy, which is when
+	// the Releases have different InstanceGroups.
+	Restart bool `json:"restart"`
+
+	// ScaleOnly and PortsOnly are true when the only changes are to the
+	// instance count, or to the ports (which are added to and removed from the
+	// Services without touching the Instances).
+	ScaleOnly bool `json:"scale_only"`
+	PortsOnly bool `json:"ports_only"`
+
+	// Warnings are about changes that will not reach running Instances, since
+	// they are not restarted.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ReleaseChange is a change to one field of a Release, e.g.
+// containers[web].env[PORT]. Containers are keyed by name (or index), volumes
+// and env vars by name, and ports by protocol and number.
+type ReleaseChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from,omitempty"`
+	To    json.RawMessage `json:"to,omitempty"`
+
+	// Effect is restart when the change needs the Instances restarted, scale
+	// when it changes their count, and ports when it changes the Services.
+	Effect string `json:"effect"`
+}
+
 // NOTE Instances are not stored in etcd, so the json tags here apply to HTTP
 type Instance struct {
 	ID ID `json:"id"` // actually just the number (starting w/ 1) of the instance order in the release
@@ -78,6 +199,9 @@ type Instance struct {
 
 	Status string `json:"status"`
 
+	// Restarts is how many times the containers of the Instance have restarted.
+	Restarts int `json:"restarts"`
+
 	CPU *ResourceMetrics `json:"cpu"`
 	RAM *ResourceMetrics `json:"ram"`
 }
@@ -107,6 +231,103 @@ type Task struct {
 	Attempts int    `json:"attempts" sg:"readonly"`
 	Error    string `json:"error" sg:"readonly"`
 
+	// Errors holds the error of every failed attempt, oldest first. Error above
+	// is always the most recent one.
+	Errors []*TaskError `json:"errors,omitempty" sg:"readonly"`
+
+	*Meta
+}
+
+// FailedTask is the record of a Task which exceeded its MaxAttempts. It is
+// stored apart from Tasks, with its own ID, because a Task's ID is derived from
+// its Action -- keeping the failed Task in place would prevent the same Action
+// from ever being run again.
+type FailedTask struct {
+	ID ID `json:"id"`
+
+	// TaskID is the ID of the Task which failed.
+	TaskID ID `json:"task_id"`
+
+	// The originating Action, decoded from ActionData for readability.
+	ActionName       string `json:"action_name"`
+	ResourceLocation string `json:"resource_location"`
+	ActionData       string `json:"action_data" validate:"nonzero"`
+
+	MaxAttempts int          `json:"max_attempts"`
+	Attempts    int          `json:"attempts"`
+	Errors      []*TaskError `json:"errors"`
+
+	Status string `json:"status" sg:"readonly"`
+
+	*Meta
+}
+
+type TaskError struct {
+	Attempt   int        `json:"attempt"`
+	Error     string     `json:"error"`
+	Timestamp *Timestamp `json:"timestamp"`
+}
+
+// AuditEntry records a change made through the API, or a step of a Task
+// performed by the Supervisor. Meta.Created is the time it happened.
+type AuditEntry struct {
+	ID ID `json:"id"`
+
+	// Actor is the API user, or "supervisor" for Tasks.
+	Actor string `json:"actor"`
+
+	// ResourceLocation is the API path (without /v0) of the Resource, or the
+	// ResourceLocation of the Task Action.
+	ResourceLocation string `json:"resource_location"`
+
+	// ActionName is the HTTP method, the action called through the API (e.g.
+	// deploy), or the name of the Task Action.
+	ActionName string `json:"action"`
+
+	// BodyDigest is the SHA-256 of the request body, if there was one, except
+	// for Resources with private fields (Users, APITokens and ImageRepos).
+	BodyDigest string `json:"body_digest,omitempty"`
+
+	// Result is "succeeded" or "failed" for API calls, and "started",
+	// "succeeded", "failed" or "cancelled" for Tasks.
+	Result string `json:"result"`
+	Status int    `json:"status,omitempty"` // the HTTP status of API calls
+	Error  string `json:"error,omitempty"`
+
+	*Meta
+}
+
+// User is someone who can use the API. They authenticate with HTTP basic auth,
+// with their Name and Password, or with one of their APITokens.
+type User struct {
+	Name ID `json:"name" validate:"nonzero"`
+
+	// Password is only given to set it; PasswordHash is stored instead.
+	Password     string `json:"password,omitempty" sg:"nostore,private"`
+	PasswordHash string `json:"password_hash,omitempty" sg:"readonly,private"`
+
+	Roles []*RoleBinding `json:"roles"`
+
+	*Meta
+}
+
+// RoleBinding grants a Role (admin, deployer or viewer) on a single App, or on
+// the whole install when App is nil.
+type RoleBinding struct {
+	Role string `json:"role" validate:"nonzero"`
+	App  ID     `json:"app,omitempty"`
+}
+
+// APIToken lets a User authenticate with "Authorization: Bearer <token>"
+// instead of a password. The token is only returned when it is created.
+type APIToken struct {
+	ID          ID     `json:"id" sg:"readonly"`
+	User        ID     `json:"user"`
+	Description string `json:"description"`
+
+	Token      string `json:"token,omitempty" sg:"readonly,nostore"`
+	SecretHash string `json:"secret_hash,omitempty" sg:"readonly,private"`
+
 	*Meta
 }
 
@@ -160,6 +381,11 @@ type Meta struct {
 	Created *Timestamp `json:"created" sg:"readonly"`
 	Updated *Timestamp `json:"updated" sg:"readonly"`
 	Tags    Tags       `json:"tags"`
+
+	// Revision changes on every write of the Resource. It is also returned as
+	// the ETag header, and can be sent back with If-Match to fail the write
+	// when the Resource has changed since it was read.
+	Revision string `json:"revision,omitempty" sg:"readonly,nostore"`
 }
 
 type PortAddress struct {
@@ -193,6 +419,45 @@ type ContainerBlueprint struct {
 	CPU     *CpuAllocation `json:"cpu" validate:"nonzero"`
 	RAM     *RamAllocation `json:"ram" validate:"nonzero"`
 	Mounts  []*Mount       `json:"mounts,omitempty"`
+
+	// LivenessProbe restarts the container when it fails.
+	LivenessProbe *Probe `json:"liveness_probe,omitempty"`
+
+	// ReadinessProbe has to pass before the container (and its Instance) counts
+	// as started, and takes it out of its Services while it fails.
+	ReadinessProbe *Probe `json:"readiness_probe,omitempty"`
+}
+
+// Probe checks the health of a container, with exactly one of an HTTP GET, a
+// TCP connection or a command. Times are in seconds; zero values are left to
+// the Kubernetes defaults.
+type Probe struct {
+	HTTP *HTTPProbe `json:"http,omitempty"`
+	TCP  *TCPProbe  `json:"tcp,omitempty"`
+	Exec *ExecProbe `json:"exec,omitempty"`
+
+	InitialDelay     int `json:"initial_delay,omitempty" validate:"min=0"`
+	Period           int `json:"period,omitempty" validate:"min=0"`
+	Timeout          int `json:"timeout,omitempty" validate:"min=0"`
+	SuccessThreshold int `json:"success_threshold,omitempty" validate:"min=0"`
+	FailureThreshold int `json:"failure_threshold,omitempty" validate:"min=0"`
+}
+
+// HTTPProbe passes when a GET of Path on Port responds with a status from 200
+// to 399.
+type HTTPProbe struct {
+	Path string `json:"path"`
+	Port int    `json:"port" validate:"min=1,max=65535"`
+}
+
+// TCPProbe passes when a connection to Port can be opened.
+type TCPProbe struct {
+	Port int `json:"port" validate:"min=1,max=65535"`
+}
+
+// ExecProbe passes when Command, run in the container, exits with 0.
+type ExecProbe struct {
+	Command []string `json:"command" validate:"min=1"`
 }
 
 type EnvVar struct {
@@ -237,6 +502,25 @@ type RamAllocation struct {
 	Max *BytesValue `json:"max"`
 }
 
+const (
+	// DeployStrategyRolling stops the Instances of the current Release and starts
+	// those of the target one, one at a time.
+	DeployStrategyRolling = "rolling"
+
+	// DeployStrategyBlueGreen starts every Instance of the target Release
+	// alongside the current ones, and once they are all ready, switches the
+	// Services of the Component to them in one step, before stopping the current
+	// ones. It cannot be used with volumes.
+	DeployStrategyBlueGreen = "bluegreen"
+
+	// DeployStrategyCanary starts some Instances of the target Release alongside
+	// all of the current ones, behind the same Services. Once they have run for
+	// the pause of the Component's CanaryOptions, or are promoted, and are
+	// healthy, the rest are replaced one at a time. It cannot be used with
+	// volumes.
+	DeployStrategyCanary = "canary"
+)
+
 const (
 	InstanceStatusStopped = "STOPPED"
 	InstanceStatusStarted = "STARTED"
@@ -248,3 +532,103 @@ type ResourceMetrics struct {
 	Usage int `json:"usage"`
 	Limit int `json:"limit"`
 }
+
+// Archive is a full export of the stored Supergiant state, as produced by
+// /v0/admin/export and restored by /v0/admin/import.
+type Archive struct {
+	FormatVersion int        `json:"format_version"`
+	SchemaVersion int        `json:"schema_version"`
+	Created       *Timestamp `json:"created"`
+
+	// Salt is set when private fields (such as an ImageRepo Key) are encrypted
+	// with a passphrase, which is then needed to import the Archive.
+	Salt string `json:"salt,omitempty"`
+
+	Records []*ArchiveRecord `json:"records"`
+}
+
+type ArchiveRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// WatchEvent is a change to a Resource, as streamed by /v0/watch.
+type WatchEvent struct {
+	Type     string `json:"type"`     // created, updated, or deleted
+	Kind     string `json:"kind"`     // the Resource type, e.g. Component
+	Location string `json:"location"` // e.g. /apps/search/components/web
+
+	// Resource is the Resource as saved, without private fields. It is not set
+	// on deletes.
+	Resource json.RawMessage `json:"resource,omitempty"`
+}
+
+// Manifest describes an App as it should be, for /v0/apply: its Components,
+// the Release each should run, and the Entrypoints and ImageRepos they use
+// (which are shared with other Apps).
+type Manifest struct {
+	App         *App                 `json:"app" validate:"nonzero"`
+	Components  []*ManifestComponent `json:"components"`
+	Entrypoints []*Entrypoint        `json:"entrypoints,omitempty"`
+	ImageRepos  []*ImageRepo         `json:"image_repos,omitempty"`
+}
+
+// ManifestComponent is a Component in a Manifest, with how it is deployed,
+// and the blueprint of the Release it should run.
+type ManifestComponent struct {
+	Name               ID                  `json:"name" validate:"nonzero"`
+	CustomDeployScript *CustomDeployScript `json:"custom_deploy_script"`
+	Strategy           string              `json:"strategy,omitempty" validate:"regexp=^(rolling|bluegreen|canary)?$"`
+	Canary             *CanaryOptions      `json:"canary,omitempty"`
+	Rolling            *RollingOptions     `json:"rolling,omitempty"`
+	Tags               Tags                `json:"tags,omitempty"`
+	Release            *Release            `json:"release" validate:"nonzero"`
+}
+
+// ManifestChange is a change made (or, on a dry run, that would be made) to
+// apply a Manifest.
+type ManifestChange struct {
+	// Action is create, update, release (merge-create a Release), or deploy.
+	Action   string `json:"action"`
+	Kind     string `json:"kind"`
+	Location string `json:"location"`
+
+	// Fields are the ones that differ, on updates and releases.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// ManifestResult lists the changes made to apply a Manifest.
+type ManifestResult struct {
+	DryRun  bool              `json:"dry_run"`
+	Changes []*ManifestChange `json:"changes"`
+}
+
+// Codes of Errors. Unlike messages, they do not change between versions.
+const (
+	ErrorCodeInvalidRequest     = "invalid_request"
+	ErrorCodeValidation         = "validation_failed"
+	ErrorCodeUnauthenticated    = "unauthenticated"
+	ErrorCodeForbidden          = "forbidden"
+	ErrorCodeNotFound           = "not_found"
+	ErrorCodeConflict           = "conflict"
+	ErrorCodePreconditionFailed = "precondition_failed"
+	ErrorCodeUpstream           = "upstream_failed"
+	ErrorCodeInternal           = "internal"
+)
+
+// Error is the body of every error response of the API.
+type Error struct {
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	Error  string `json:"error"`
+
+	// Fields are the invalid fields, when Code is validation_failed.
+	Fields []*FieldError `json:"fields,omitempty"`
+}
+
+// FieldError is a field that failed validation. Path is its JSON path in the
+// request body, e.g. containers or instance_count.
+type FieldError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
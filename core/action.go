@@ -6,9 +6,12 @@ import (
 	"fmt"
 
 	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
 )
 
-type ActionPerformer func(r Resource) error
+// ActionPerformer performs an Action on a Resource. Performers are expected to
+// return early, with ctx.Err(), when ctx is cancelled.
+type ActionPerformer func(ctx context.Context, r Resource) error
 
 type Action struct {
 	ResourceLocation string `json:"resource_location"`
@@ -40,8 +43,8 @@ func (a *Action) ID() common.ID {
 }
 
 // Perform performs the Action by calling the performer func.
-func (a *Action) Perform() error {
-	return a.performer(a.resource)
+func (a *Action) Perform(ctx context.Context) error {
+	return a.performer(ctx, a.resource)
 }
 
 // Supervise sets the ResourceLocation of the resource and creates a Task from
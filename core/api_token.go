@@ -0,0 +1,166 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+// APITokensInterface has no Update, since a token cannot be changed once it
+// is created; it is deleted and created again instead.
+type APITokensInterface interface {
+	List() (*APITokenList, error)
+	ListWithOptions(*ListOptions) (*APITokenList, error)
+	New() *APITokenResource
+	Create(*APITokenResource) error
+	Get(common.ID) (*APITokenResource, error)
+	Delete(*APITokenResource) error
+}
+
+type APITokenCollection struct {
+	core *Core
+}
+
+type APITokenResource struct {
+	core       *Core
+	collection APITokensInterface
+	*common.APIToken
+}
+
+type APITokenList struct {
+	Items    []*APITokenResource `json:"items"`
+	Continue string              `json:"continue,omitempty"`
+}
+
+// initializeResource implements the Collection interface.
+func (c *APITokenCollection) initializeResource(in Resource) {
+	r := in.(*APITokenResource)
+	r.collection = c
+	r.core = c.core
+}
+
+// List returns an APITokenList.
+func (c *APITokenCollection) List() (*APITokenList, error) {
+	return c.ListWithOptions(nil)
+}
+
+// ListWithOptions returns an APITokenList with opts applied (see ListOptions).
+func (c *APITokenCollection) ListWithOptions(opts *ListOptions) (*APITokenList, error) {
+	list := new(APITokenList)
+	err := c.core.db.list(c, list, opts)
+	return list, err
+}
+
+// New initializes an APIToken with a pointer to the Collection.
+func (c *APITokenCollection) New() *APITokenResource {
+	r := &APITokenResource{
+		APIToken: &common.APIToken{
+			Meta: common.NewMeta(),
+		},
+	}
+	c.initializeResource(r)
+	return r
+}
+
+// Create takes an APIToken for an existing User, and creates it in etcd with a
+// new ID and secret. Token is only set on the Resource returned here; only a
+// hash of the secret is stored.
+func (c *APITokenCollection) Create(r *APITokenResource) error {
+	if r.User == nil {
+		return fmt.Errorf("APIToken user is required")
+	}
+	if _, err := c.core.Users().Get(r.User); err != nil {
+		return err
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+	r.ID = common.IDString(id)
+	r.SecretHash = hashTokenSecret(secret)
+
+	if err := c.core.db.create(c, r.ID, r); err != nil {
+		return err
+	}
+	r.Token = id + "." + secret
+	return nil
+}
+
+// Get takes an id and returns an APITokenResource if it exists.
+func (c *APITokenCollection) Get(id common.ID) (*APITokenResource, error) {
+	r := c.New()
+	if err := c.core.db.get(c, id, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Delete deletes the APIToken in etcd, revoking it.
+func (c *APITokenCollection) Delete(r *APITokenResource) error {
+	return c.core.db.delete(c, r.ID)
+}
+
+//------------------------------------------------------------------------------
+
+// Key implements the Locatable interface.
+func (c *APITokenCollection) locationKey() string {
+	return "tokens"
+}
+
+// Parent implements the Locatable interface. It returns nil here because Core
+// is the parent, and it is the root, which we exclude from paths.
+func (c *APITokenCollection) parent() (l Locatable) {
+	return
+}
+
+// Child implements the Locatable interface.
+func (c *APITokenCollection) child(key string) Locatable {
+	token, err := c.Get(common.IDString(key))
+	if err != nil {
+		panic(fmt.Errorf("No child with key %s for %T", key, c))
+	}
+	return token
+}
+
+// Key implements the Locatable interface.
+func (r *APITokenResource) locationKey() string {
+	return common.StringID(r.ID)
+}
+
+// Parent implements the Locatable interface.
+func (r *APITokenResource) parent() Locatable {
+	return r.collection.(Locatable)
+}
+
+// Child implements the Locatable interface.
+func (r *APITokenResource) child(key string) (l Locatable) {
+	switch key {
+	default:
+		panic(fmt.Errorf("No child with key %s for %T", key, r))
+	}
+}
+
+// Action implements the Resource interface.
+func (r *APITokenResource) Action(name string) *Action {
+	switch name {
+	default:
+		panic(fmt.Errorf("No action %s for APIToken", name))
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// decorate implements the Resource interface
+func (r *APITokenResource) decorate() (err error) {
+	return
+}
+
+// Delete is a proxy method to APITokenCollection's Delete.
+func (r *APITokenResource) Delete() error {
+	return r.collection.Delete(r)
+}
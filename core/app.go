@@ -5,16 +5,18 @@ import (
 
 	"github.com/supergiant/guber"
 	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
 )
 
 type AppsInterface interface {
 	List() (*AppList, error)
+	ListWithOptions(*ListOptions) (*AppList, error)
 	New() *AppResource
 	Create(*AppResource) error
 	Get(common.ID) (*AppResource, error)
 	Update(common.ID, *AppResource) error
 	Patch(common.ID, *AppResource) error
-	Delete(Resource) error
+	Delete(context.Context, Resource) error
 }
 
 type AppCollection struct {
@@ -33,7 +35,8 @@ type AppResource struct {
 // NOTE this does not inherit from common like model does; all we need is a List
 // object, internally, that has a slice of our composed model above.
 type AppList struct {
-	Items []*AppResource `json:"items"`
+	Items    []*AppResource `json:"items"`
+	Continue string         `json:"continue,omitempty"`
 }
 
 // initializeResource implements the Collection interface.
@@ -49,8 +52,13 @@ func (c *AppCollection) initializeResource(in Resource) {
 
 // List returns an AppList.
 func (c *AppCollection) List() (*AppList, error) {
+	return c.ListWithOptions(nil)
+}
+
+// ListWithOptions returns an AppList with opts applied (see ListOptions).
+func (c *AppCollection) ListWithOptions(opts *ListOptions) (*AppList, error) {
 	list := new(AppList)
-	err := c.core.db.list(c, list)
+	err := c.core.db.list(c, list, opts)
 	return list, err
 }
 
@@ -74,7 +82,7 @@ func (c *AppCollection) Create(r *AppResource) error {
 	// TODO for error handling and retries, we may want to do this in a task and
 	// utilize a Status field
 	if err := r.createNamespace(); err != nil {
-		return err
+		return upstreamErr("Kubernetes", err)
 	}
 	return nil
 }
@@ -111,7 +119,7 @@ func (c *AppCollection) Patch(name common.ID, r *AppResource) error {
 // It is difficult to approach mocking Resources, because if they are returned
 // as interfaces from methods like collection.Get(), we no longer have access
 // to the attributes of the Resource without type casting.
-func (c *AppCollection) Delete(ri Resource) error {
+func (c *AppCollection) Delete(ctx context.Context, ri Resource) error {
 	r := ri.(*AppResource)
 	components, err := r.Components().List()
 	if err != nil {
@@ -121,7 +129,7 @@ func (c *AppCollection) Delete(ri Resource) error {
 		return err
 	}
 	for _, component := range components.Items {
-		if err := component.Delete(); err != nil {
+		if err := r.Components().Delete(ctx, component); err != nil {
 			return err
 		}
 	}
@@ -207,7 +215,7 @@ func (r *AppResource) Patch() error {
 
 // Delete is a proxy method to AppCollection's Delete.
 func (r *AppResource) Delete() error {
-	return r.collection.Delete(r)
+	return r.collection.Delete(context.Background(), r)
 }
 
 // Components returns a ComponentsInterface with a pointer to the AppResource.
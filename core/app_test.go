@@ -8,6 +8,7 @@ import (
 	"github.com/supergiant/guber"
 	"github.com/supergiant/supergiant/common"
 	"github.com/supergiant/supergiant/core/mock"
+	"golang.org/x/net/context"
 )
 
 func TestAppList(t *testing.T) {
@@ -86,7 +87,8 @@ func TestAppCreate(t *testing.T) {
 			err := apps.Create(app)
 
 			Convey("A validation error should be returned", func() {
-				So(err.Error(), ShouldEqual, "App.Name: regular expression mismatch")
+				So(err.Error(), ShouldEqual, "Validation failed: name: regular expression mismatch")
+				So(err.(*ValidationError).Fields[0].Path, ShouldEqual, "name")
 			})
 		})
 	})
@@ -206,9 +208,7 @@ func TestAppDelete(t *testing.T) {
 // TODO move to shared folder
 func newMockCore(fakeEtcd *mock.FakeEtcd) *Core {
 	return &Core{
-		db: &database{
-			&etcdClient{fakeEtcd},
-		},
+		db: newDB(&etcdStore{fakeEtcd}),
 	}
 }
 
@@ -255,6 +255,14 @@ func (f *FakeComponentCollection) List() (*ComponentList, error) {
 	return f.ListFn()
 }
 
+func (f *FakeComponentCollection) ListWithOptions(opts *ListOptions) (*ComponentList, error) {
+	list, err := f.ListFn()
+	if err != nil || opts == nil {
+		return list, err
+	}
+	return list, opts.Apply(list)
+}
+
 func (f *FakeComponentCollection) New() *ComponentResource {
 	return f.NewFn()
 }
@@ -275,10 +283,10 @@ func (f *FakeComponentCollection) Patch(common.ID, *ComponentResource) error {
 	return f.PatchFn()
 }
 
-func (f *FakeComponentCollection) Delete(r Resource) error {
+func (f *FakeComponentCollection) Delete(ctx context.Context, r Resource) error {
 	return f.DeleteFn(r)
 }
 
-func (f *FakeComponentCollection) Deploy(r Resource) error {
+func (f *FakeComponentCollection) Deploy(ctx context.Context, r Resource) error {
 	return f.DeployFn(r)
 }
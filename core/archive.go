@@ -0,0 +1,290 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/supergiant/supergiant/common"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	archiveFormatVersion = 1
+
+	// The number of PBKDF2 rounds used to derive the key for private fields
+	// from the passphrase.
+	archiveKeyIterations = 100000
+
+	// NOTE the same prefix is used for private fields encrypted at rest, which
+	// also have the ID of the key. See keyring.
+	encryptedValuePrefix = "encrypted:"
+)
+
+// mergedOnImport are the Collections that may already have records when
+// importing: the audit log, since the API records failed imports in it too,
+// and the Users and APITokens needed to call the API at all. Records of these
+// that exist in both the store and the Archive are left as they are.
+var mergedOnImport = map[string]bool{
+	"audit":  true,
+	"users":  true,
+	"tokens": true,
+}
+
+var (
+	ErrStoreNotEmpty = errors.New("An Archive can only be imported into an empty store")
+	ErrBadPassphrase = errors.New("Archive passphrase is missing or wrong")
+)
+
+// invalidArchiveError is returned by Import for an Archive that cannot be
+// restored as is, before anything is written.
+type invalidArchiveError string
+
+func (e invalidArchiveError) Error() string {
+	return string(e)
+}
+
+// IsInvalidArchiveErr returns true if Import rejected the Archive itself.
+func IsInvalidArchiveErr(err error) bool {
+	_, yes := err.(invalidArchiveError)
+	return yes || err == ErrBadPassphrase
+}
+
+// Export returns every stored record, upgraded to the current schema version.
+// If passphrase is not empty, private fields are encrypted with it; otherwise
+// they are included decrypted.
+func (c *Core) Export(passphrase string) (*common.Archive, error) {
+	values, err := c.db.store.listAll("")
+	if err != nil && !isNotFoundErr(err) {
+		return nil, err
+	}
+
+	archive := &common.Archive{
+		FormatVersion: archiveFormatVersion,
+		SchemaVersion: schemaVersion(),
+		Created:       common.NewTimestamp(),
+		Records:       []*common.ArchiveRecord{},
+	}
+
+	var gcm cipher.AEAD // nil when private fields are included decrypted
+	if passphrase != "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		archive.Salt = base64.StdEncoding.EncodeToString(salt)
+
+		if gcm, err = archiveCipher(passphrase, salt); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, value := range values {
+		collection := recordCollection(value.Key)
+		if collection == "" {
+			continue
+		}
+
+		_, record, err := migrateRecord(collection, value.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", value.Key, err)
+		}
+		if record, err = c.db.keys.decryptRecord(value.Key, record); err != nil {
+			return nil, fmt.Errorf("%s: %s", value.Key, err)
+		}
+		if gcm != nil {
+			record, err = mapPrivateFields(collection, record, func(name string, v interface{}) (interface{}, error) {
+				return sealValue(gcm, v, privateFieldAAD(value.Key, name))
+			})
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", value.Key, err)
+			}
+		}
+
+		archive.Records = append(archive.Records, &common.ArchiveRecord{
+			Key:   value.Key,
+			Value: json.RawMessage(record),
+		})
+	}
+	return archive, nil
+}
+
+// Import restores the records of an Archive into an empty store (see
+// mergedOnImport), returning the number of records restored. With provision, the Kubernetes Namespaces,
+// Services, and Secrets of every App are created afterwards, where missing.
+//
+// NOTE records are written one at a time. If Import fails part way, the store
+// has to be cleared before trying again.
+func (c *Core) Import(archive *common.Archive, passphrase string, provision bool) (int, error) {
+	if archive.FormatVersion != archiveFormatVersion {
+		return 0, invalidArchiveError(fmt.Sprintf("Unsupported Archive format version %d", archive.FormatVersion))
+	}
+	if archive.SchemaVersion > schemaVersion() {
+		return 0, invalidArchiveError(fmt.Sprintf("Archive has schema version %d, but this supergiant-api only supports up to %d", archive.SchemaVersion, schemaVersion()))
+	}
+
+	var gcm cipher.AEAD // nil when private fields are included decrypted
+	if archive.Salt != "" {
+		if passphrase == "" {
+			return 0, ErrBadPassphrase
+		}
+		salt, err := base64.StdEncoding.DecodeString(archive.Salt)
+		if err != nil {
+			return 0, invalidArchiveError(fmt.Sprintf("Invalid Archive salt: %s", err))
+		}
+		if gcm, err = archiveCipher(passphrase, salt); err != nil {
+			return 0, err
+		}
+	}
+
+	existing, err := c.db.store.listAll("")
+	if err != nil && !isNotFoundErr(err) {
+		return 0, err
+	}
+	for _, value := range existing {
+		if collection := recordCollection(value.Key); collection != "" && !mergedOnImport[collection] {
+			return 0, ErrStoreNotEmpty
+		}
+	}
+
+	// Everything is decoded up front, so that a wrong passphrase or a broken
+	// record does not leave a partial import behind.
+	records := make([]string, len(archive.Records))
+	for i, r := range archive.Records {
+		collection := recordCollection(r.Key)
+		if collection == "" {
+			return 0, invalidArchiveError(fmt.Sprintf("Invalid Archive record key %q", r.Key))
+		}
+
+		record := string(r.Value)
+		if gcm != nil {
+			record, err = mapPrivateFields(collection, record, func(name string, v interface{}) (interface{}, error) {
+				return openValue(gcm, v, privateFieldAAD(r.Key, name))
+			})
+			if err != nil {
+				if err == ErrBadPassphrase {
+					return 0, err
+				}
+				return 0, invalidArchiveError(fmt.Sprintf("%s: %s", r.Key, err))
+			}
+		}
+		if _, record, err = migrateRecord(collection, record); err != nil {
+			return 0, invalidArchiveError(fmt.Sprintf("%s: %s", r.Key, err))
+		}
+		if record, err = c.db.keys.encryptRecord(r.Key, record); err != nil {
+			return 0, fmt.Errorf("%s: %s", r.Key, err)
+		}
+		records[i] = record
+	}
+
+	restored := 0
+	err = c.db.batch(func() error {
+		for i, r := range archive.Records {
+			_, err := c.db.store.create(r.Key, records[i])
+			if isKeyExistsErr(err) && mergedOnImport[recordCollection(r.Key)] {
+				continue // the record in the store is kept
+			}
+			if err != nil {
+				return err
+			}
+			restored++
+		}
+		return nil
+	})
+	if err != nil {
+		return restored, err
+	}
+
+	if provision {
+		if err := c.provisionImported(); err != nil {
+			return restored, err
+		}
+	}
+	return restored, nil
+}
+
+// provisionImported creates the Kubernetes assets of every App, and of the
+// current and target Release of each Component, unless they already exist.
+// Instances and volumes are left to the usual start and deploy actions.
+func (c *Core) provisionImported() error {
+	apps, err := c.Apps().List()
+	if err != nil {
+		return err
+	}
+	for _, app := range apps.Items {
+		if _, err := c.k8s.Namespaces().Get(common.StringID(app.Name)); isKubeNotFoundErr(err) {
+			Log.Infof("Creating Namespace %s", common.StringID(app.Name))
+			if err := app.createNamespace(); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		components, err := app.Components().List()
+		if err != nil {
+			return err
+		}
+		for _, component := range components.Items {
+			for _, timestamp := range []common.ID{component.CurrentReleaseTimestamp, component.TargetReleaseTimestamp} {
+				if timestamp == nil {
+					continue
+				}
+				release, err := component.Releases().Get(timestamp)
+				if err != nil {
+					return err
+				}
+				if err := release.provisionSecrets(); err != nil {
+					return err
+				}
+				if err := release.provisionInternalService(); err != nil {
+					return err
+				}
+				if err := release.provisionExternalService(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// archiveCipher derives an AES-256 key from the passphrase with PBKDF2
+// (HMAC-SHA256), and returns an AES-GCM cipher using it.
+func archiveCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := pbkdf2.Key([]byte(passphrase), salt, archiveKeyIterations, 32, sha256.New)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealValue encrypts a private field of a record for an Archive.
+func sealValue(gcm cipher.AEAD, v interface{}, aad []byte) (interface{}, error) {
+	sealed, err := sealJSON(gcm, v, aad)
+	if err != nil {
+		return nil, err
+	}
+	return encryptedValuePrefix + sealed, nil
+}
+
+// openValue reverses sealValue.
+func openValue(gcm cipher.AEAD, v interface{}, aad []byte) (interface{}, error) {
+	str, ok := v.(string)
+	if !ok || !strings.HasPrefix(str, encryptedValuePrefix) {
+		return nil, errors.New("Private field is not encrypted")
+	}
+	out, err := openJSON(gcm, strings.TrimPrefix(str, encryptedValuePrefix), aad)
+	if err == errDecrypt {
+		return nil, ErrBadPassphrase
+	}
+	return out, err
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+func TestArchive(t *testing.T) {
+	Convey("Given a store with an ImageRepo and an App", t, func() {
+		core := &Core{db: newDB(newMemoryStore())}
+
+		repo := core.ImageRepos().New()
+		repo.Name = common.IDString("private")
+		repo.Key = "secret-key"
+		So(core.ImageRepos().Create(repo), ShouldBeNil)
+
+		// A record written before schema versioning
+		_, err := core.db.store.create("/apps/test", `{"name":"test","tags":{}}`)
+		So(err, ShouldBeNil)
+
+		Convey("When exported without a passphrase", func() {
+			archive, err := core.Export("")
+			So(err, ShouldBeNil)
+
+			Convey("It should include every record at the current schema version", func() {
+				So(archive.SchemaVersion, ShouldEqual, schemaVersion())
+				So(archive.Salt, ShouldBeEmpty)
+				So(archive.Records, ShouldHaveLength, 2)
+				for _, record := range archive.Records {
+					So(string(record.Value), ShouldContainSubstring, `"schema_version":1`)
+				}
+				So(string(archive.Records[1].Value), ShouldContainSubstring, "secret-key")
+			})
+		})
+
+		Convey("When exported with a passphrase", func() {
+			archive, err := core.Export("hunter2")
+			So(err, ShouldBeNil)
+
+			// Round trip through JSON, as through the API.
+			data, err := json.Marshal(archive)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldNotContainSubstring, "secret-key")
+			archive = new(common.Archive)
+			So(json.Unmarshal(data, archive), ShouldBeNil)
+
+			Convey("It should be restored into an empty store with the passphrase", func() {
+				restored := &Core{db: newDB(newMemoryStore())}
+				n, err := restored.Import(archive, "hunter2", false)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+
+				repo, err := restored.ImageRepos().Get(common.IDString("private"))
+				So(err, ShouldBeNil)
+				So(repo.Key, ShouldEqual, "secret-key")
+
+				val, err := restored.db.store.get("/apps/test")
+				So(err, ShouldBeNil)
+				So(val.Value, ShouldContainSubstring, `"name":"test"`)
+			})
+
+			Convey("It should not be restored with a wrong or missing passphrase", func() {
+				restored := &Core{db: newDB(newMemoryStore())}
+				_, err := restored.Import(archive, "wrong", false)
+				So(err, ShouldEqual, ErrBadPassphrase)
+				_, err = restored.Import(archive, "", false)
+				So(err, ShouldEqual, ErrBadPassphrase)
+
+				values, err := restored.db.store.listAll("")
+				So(err, ShouldBeNil)
+				So(values, ShouldBeEmpty)
+			})
+
+			Convey("It should be restored into a store that only has the admin User", func() {
+				restored := &Core{db: newDB(newMemoryStore()), AdminPassword: "admin-pass"}
+				So(restored.initializeAuth(), ShouldBeNil)
+
+				n, err := restored.Import(archive, "hunter2", false)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+
+				_, err = restored.Authenticate("admin", "admin-pass")
+				So(err, ShouldBeNil)
+			})
+
+			Convey("It should not be restored into a store that has records", func() {
+				_, err := core.Import(archive, "hunter2", false)
+				So(err, ShouldEqual, ErrStoreNotEmpty)
+			})
+		})
+
+		Convey("When an Archive is from a newer schema version", func() {
+			archive, err := core.Export("")
+			So(err, ShouldBeNil)
+			archive.SchemaVersion = schemaVersion() + 1
+
+			_, err = (&Core{db: newDB(newMemoryStore())}).Import(archive, "", false)
+
+			Convey("It should be rejected", func() {
+				So(IsInvalidArchiveErr(err), ShouldBeTrue)
+				So(strings.Contains(err.Error(), "schema version"), ShouldBeTrue)
+			})
+		})
+	})
+}
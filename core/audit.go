@@ -0,0 +1,170 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+const (
+	AuditResultStarted   = "started"
+	AuditResultSucceeded = "succeeded"
+	AuditResultFailed    = "failed"
+	AuditResultCancelled = "cancelled"
+
+	// auditActorSupervisor is the Actor of the entries for Tasks.
+	auditActorSupervisor = "supervisor"
+)
+
+// AuditEntriesInterface has no Update or Delete, since the audit log is
+// append-only.
+type AuditEntriesInterface interface {
+	List() (*AuditEntryList, error)
+	ListWithOptions(*ListOptions) (*AuditEntryList, error)
+	New() *AuditEntryResource
+	Create(*AuditEntryResource) error
+	Get(common.ID) (*AuditEntryResource, error)
+}
+
+type AuditEntryCollection struct {
+	core *Core
+}
+
+type AuditEntryResource struct {
+	core       *Core
+	collection AuditEntriesInterface
+	*common.AuditEntry
+}
+
+type AuditEntryList struct {
+	Items    []*AuditEntryResource `json:"items"`
+	Continue string                `json:"continue,omitempty"`
+}
+
+// initializeResource implements the Collection interface.
+func (c *AuditEntryCollection) initializeResource(in Resource) {
+	r := in.(*AuditEntryResource)
+	r.collection = c
+	r.core = c.core
+}
+
+// List returns an AuditEntryList, oldest first.
+func (c *AuditEntryCollection) List() (*AuditEntryList, error) {
+	return c.ListWithOptions(nil)
+}
+
+// ListWithOptions returns an AuditEntryList with opts applied (see ListOptions).
+func (c *AuditEntryCollection) ListWithOptions(opts *ListOptions) (*AuditEntryList, error) {
+	list := new(AuditEntryList)
+	err := c.core.db.list(c, list, opts)
+	return list, err
+}
+
+// New initializes an AuditEntry with a pointer to the Collection, and a new
+// ID.
+func (c *AuditEntryCollection) New() *AuditEntryResource {
+	r := &AuditEntryResource{
+		AuditEntry: &common.AuditEntry{
+			ID:   newAuditEntryID(),
+			Meta: common.NewMeta(),
+		},
+	}
+	c.initializeResource(r)
+	return r
+}
+
+// Create takes an AuditEntry and creates it in etcd.
+func (c *AuditEntryCollection) Create(r *AuditEntryResource) error {
+	return c.core.db.create(c, r.ID, r)
+}
+
+// Get takes an id and returns an AuditEntryResource if it exists.
+func (c *AuditEntryCollection) Get(id common.ID) (*AuditEntryResource, error) {
+	r := c.New()
+	if err := c.core.db.get(c, id, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//------------------------------------------------------------------------------
+
+// Key implements the Locatable interface.
+func (c *AuditEntryCollection) locationKey() string {
+	return "audit"
+}
+
+// Parent implements the Locatable interface. It returns nil here because Core
+// is the parent, and it is the root, which we exclude from paths.
+func (c *AuditEntryCollection) parent() (l Locatable) {
+	return
+}
+
+// Child implements the Locatable interface.
+func (c *AuditEntryCollection) child(key string) Locatable {
+	entry, err := c.Get(common.IDString(key))
+	if err != nil {
+		panic(fmt.Errorf("No child with key %s for %T", key, c))
+	}
+	return entry
+}
+
+// Key implements the Locatable interface.
+func (r *AuditEntryResource) locationKey() string {
+	return common.StringID(r.ID)
+}
+
+// Parent implements the Locatable interface.
+func (r *AuditEntryResource) parent() Locatable {
+	return r.collection.(Locatable)
+}
+
+// Child implements the Locatable interface.
+func (r *AuditEntryResource) child(key string) (l Locatable) {
+	switch key {
+	default:
+		panic(fmt.Errorf("No child with key %s for %T", key, r))
+	}
+}
+
+// Action implements the Resource interface.
+func (r *AuditEntryResource) Action(name string) *Action {
+	switch name {
+	default:
+		panic(fmt.Errorf("No action %s for AuditEntry", name))
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// decorate implements the Resource interface
+func (r *AuditEntryResource) decorate() (err error) {
+	return
+}
+
+// newAuditEntryID returns an ID that sorts by time, so that entries are listed
+// in the order they were recorded.
+func newAuditEntryID() common.ID {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return common.IDString(fmt.Sprintf("%019d-%s", time.Now().UnixNano(), hex.EncodeToString(suffix)))
+}
+
+// auditTask records a step of a Task performed by the Supervisor. Failing to
+// record it is logged, but does not affect the Task.
+func (c *Core) auditTask(action *Action, result string, err error) {
+	entry := c.AuditEntries().New()
+	entry.Actor = auditActorSupervisor
+	entry.ResourceLocation = action.ResourceLocation
+	entry.ActionName = action.ActionName
+	entry.Result = result
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if err := c.AuditEntries().Create(entry); err != nil {
+		Log.Errorf("Could not record audit entry for Task %s : %s: %s", action.ActionName, action.ResourceLocation, err)
+	}
+}
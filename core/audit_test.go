@@ -0,0 +1,35 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuditEntries(t *testing.T) {
+	Convey("Given an empty audit log", t, func() {
+		core := &Core{db: newDB(newMemoryStore())}
+
+		Convey("When steps of a Task are recorded", func() {
+			action := &Action{ResourceLocation: "/apps/test", ActionName: "delete"}
+			core.auditTask(action, AuditResultStarted, nil)
+			core.auditTask(action, AuditResultFailed, errors.New("Namespace still terminating"))
+
+			Convey("They should be listed in the order they were recorded", func() {
+				list, err := core.AuditEntries().List()
+				So(err, ShouldBeNil)
+				So(list.Items, ShouldHaveLength, 2)
+
+				So(list.Items[0].Actor, ShouldEqual, "supervisor")
+				So(list.Items[0].ResourceLocation, ShouldEqual, "/apps/test")
+				So(list.Items[0].ActionName, ShouldEqual, "delete")
+				So(list.Items[0].Result, ShouldEqual, AuditResultStarted)
+				So(list.Items[0].Created, ShouldNotBeNil)
+
+				So(list.Items[1].Result, ShouldEqual, AuditResultFailed)
+				So(list.Items[1].Error, ShouldEqual, "Namespace still terminating")
+			})
+		})
+	})
+}
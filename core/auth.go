@@ -0,0 +1,263 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/supergiant/supergiant/common"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	RoleAdmin    = "admin"    // everything, including Users and APITokens when install-wide
+	RoleDeployer = "deployer" // Components, Releases, deploys and Tasks
+	RoleViewer   = "viewer"   // read-only
+
+	// adminUserName is the User created or updated with Core.AdminPassword.
+	adminUserName = "admin"
+
+	// The number of PBKDF2 rounds used to hash passwords.
+	passwordHashIterations = 100000
+
+	// credentialCacheTTL is how long a verified password is remembered, so that
+	// clients using basic auth do not pay for PBKDF2 on every request.
+	credentialCacheTTL = time.Minute
+)
+
+// dummyPasswordHash is checked against for unknown Users, so that they take as
+// long to reject as a wrong password, and do not give away which Users exist.
+var dummyPasswordHash = fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordHashIterations, base64.StdEncoding.EncodeToString(make([]byte, 16)), base64.StdEncoding.EncodeToString(make([]byte, 32)))
+
+// ErrUnauthenticated is returned for unknown Users and APITokens, and wrong
+// passwords. It does not say which, on purpose.
+var ErrUnauthenticated = errors.New("Invalid credentials")
+
+// roleRanks orders Roles, so that a Role includes those ranked below it.
+var roleRanks = map[string]int{
+	RoleViewer:   1,
+	RoleDeployer: 2,
+	RoleAdmin:    3,
+}
+
+// Principal is who an API request is made by: a User, or the Supervisor
+// when deploying with the service token.
+type Principal struct {
+	Name  string
+	Roles []*common.RoleBinding
+}
+
+// Can returns true if the Principal has role (or a higher one) on the App
+// named app, or on the whole install when app is nil. Install-wide Roles apply
+// to every App.
+func (p *Principal) Can(role string, app common.ID) bool {
+	for _, binding := range p.Roles {
+		if roleRanks[binding.Role] < roleRanks[role] {
+			continue
+		}
+		if binding.App == nil || (app != nil && *binding.App == *app) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate returns the Principal for a User name and password.
+func (c *Core) Authenticate(name string, password string) (*Principal, error) {
+	user, err := c.Users().Get(common.IDString(name))
+	if isNotFoundErr(err) {
+		checkPassword(dummyPasswordHash, password)
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !c.credentials.verified(name, user.PasswordHash, password) {
+		if !checkPassword(user.PasswordHash, password) {
+			return nil, ErrUnauthenticated
+		}
+		c.credentials.add(name, user.PasswordHash, password)
+	}
+	return &Principal{Name: name, Roles: user.Roles}, nil
+}
+
+// AuthenticateToken returns the Principal for an APIToken, which has the Roles
+// of its User. The service token authenticates the Supervisor, as an
+// install-wide deployer.
+func (c *Core) AuthenticateToken(token string) (*Principal, error) {
+	if c.serviceToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.serviceToken)) == 1 {
+		return &Principal{
+			Name:  auditActorSupervisor,
+			Roles: []*common.RoleBinding{{Role: RoleDeployer}},
+		}, nil
+	}
+
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, ErrUnauthenticated
+	}
+	apiToken, err := c.APITokens().Get(common.IDString(parts[0]))
+	if isNotFoundErr(err) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(apiToken.SecretHash), []byte(hashTokenSecret(parts[1]))) {
+		return nil, ErrUnauthenticated
+	}
+
+	user, err := c.Users().Get(apiToken.User)
+	if isNotFoundErr(err) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Name: common.StringID(user.Name), Roles: user.Roles}, nil
+}
+
+// ServiceToken returns the API token the Supervisor deploys with. It is
+// generated by Initialize, and only valid for the life of the process.
+func (c *Core) ServiceToken() string {
+	return c.serviceToken
+}
+
+// ensureAdminUser creates the admin User with an install-wide admin Role and
+// the given password, or resets the password and Role if it exists.
+func (c *Core) ensureAdminUser(password string) error {
+	user, err := c.Users().Get(common.IDString(adminUserName))
+	if isNotFoundErr(err) {
+		user = c.Users().New()
+		user.Name = common.IDString(adminUserName)
+		user.Password = password
+		user.Roles = []*common.RoleBinding{{Role: RoleAdmin}}
+		return c.Users().Create(user)
+	}
+	if err != nil {
+		return err
+	}
+
+	isAdmin := (&Principal{Roles: user.Roles}).Can(RoleAdmin, nil)
+	if checkPassword(user.PasswordHash, password) && isAdmin {
+		return nil
+	}
+	user.Password = password
+	if !isAdmin {
+		user.Roles = append(user.Roles, &common.RoleBinding{Role: RoleAdmin})
+	}
+	return user.Update()
+}
+
+// credentialCache remembers the passwords of Users that were verified
+// recently, as an HMAC with a key random to the process. An entry only matches
+// the password hash it was verified against, so changing the password of a
+// User invalidates it. A nil credentialCache remembers nothing.
+type credentialCache struct {
+	mu      sync.Mutex
+	key     []byte
+	entries map[string]*cachedCredential // by User name
+}
+
+type cachedCredential struct {
+	passwordHash string
+	mac          []byte
+	expires      time.Time
+}
+
+func newCredentialCache() (*credentialCache, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &credentialCache{key: key, entries: make(map[string]*cachedCredential)}, nil
+}
+
+func (c *credentialCache) mac(name string, password string) []byte {
+	h := hmac.New(sha256.New, c.key)
+	fmt.Fprintf(h, "%s\x00%s", name, password)
+	return h.Sum(nil)
+}
+
+// verified returns true if the password of the User was verified against
+// passwordHash within credentialCacheTTL.
+func (c *credentialCache) verified(name string, passwordHash string, password string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	entry := c.entries[name]
+	c.mu.Unlock()
+
+	if entry == nil || entry.passwordHash != passwordHash || time.Now().After(entry.expires) {
+		return false
+	}
+	return hmac.Equal(entry.mac, c.mac(name, password))
+}
+
+// add remembers a password just verified against passwordHash.
+func (c *credentialCache) add(name string, passwordHash string, password string) {
+	if c == nil {
+		return
+	}
+	entry := &cachedCredential{passwordHash, c.mac(name, password), time.Now().Add(credentialCacheTTL)}
+	c.mu.Lock()
+	c.entries[name] = entry
+	c.mu.Unlock()
+}
+
+// hashPassword returns "pbkdf2-sha256$<iterations>$<salt>$<hash>", with the
+// salt and hash base64 encoded.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := pbkdf2.Key([]byte(password), salt, passwordHashIterations, 32, sha256.New)
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordHashIterations, base64.StdEncoding.EncodeToString(salt), base64.StdEncoding.EncodeToString(key)), nil
+}
+
+// checkPassword returns true if password matches a hash from hashPassword.
+func checkPassword(hash string, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	key, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(key, pbkdf2.Key([]byte(password), salt, iterations, 32, sha256.New))
+}
+
+// hashTokenSecret hashes the secret of an APIToken. Unlike passwords, secrets
+// are random and long, so a single round of SHA-256 is enough.
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+func TestAuth(t *testing.T) {
+	Convey("Given a User with a password and an App-scoped Role", t, func() {
+		core := &Core{db: newDB(newMemoryStore())}
+
+		user := core.Users().New()
+		user.Name = common.IDString("ci")
+		user.Password = "hunter2"
+		user.Roles = []*common.RoleBinding{{Role: RoleDeployer, App: common.IDString("search")}}
+		So(core.Users().Create(user), ShouldBeNil)
+
+		Convey("The password should be stored hashed", func() {
+			val, err := core.db.store.get("/users/ci")
+			So(err, ShouldBeNil)
+			So(val.Value, ShouldNotContainSubstring, "hunter2")
+			So(val.Value, ShouldContainSubstring, "pbkdf2-sha256$")
+		})
+
+		Convey("It should authenticate with the right password only", func() {
+			principal, err := core.Authenticate("ci", "hunter2")
+			So(err, ShouldBeNil)
+			So(principal.Name, ShouldEqual, "ci")
+
+			_, err = core.Authenticate("ci", "hunter3")
+			So(err, ShouldEqual, ErrUnauthenticated)
+			_, err = core.Authenticate("nobody", "hunter2")
+			So(err, ShouldEqual, ErrUnauthenticated)
+		})
+
+		Convey("Its Role should only apply to its App, and to lower Roles", func() {
+			principal, _ := core.Authenticate("ci", "hunter2")
+			So(principal.Can(RoleDeployer, common.IDString("search")), ShouldBeTrue)
+			So(principal.Can(RoleViewer, common.IDString("search")), ShouldBeTrue)
+			So(principal.Can(RoleAdmin, common.IDString("search")), ShouldBeFalse)
+			So(principal.Can(RoleViewer, common.IDString("billing")), ShouldBeFalse)
+			So(principal.Can(RoleViewer, nil), ShouldBeFalse)
+		})
+
+		Convey("Updating it without a Password should keep the old one", func() {
+			user.PasswordHash = ""
+			user.Roles = []*common.RoleBinding{{Role: RoleViewer}}
+			So(user.Patch(), ShouldBeNil)
+
+			principal, err := core.Authenticate("ci", "hunter2")
+			So(err, ShouldBeNil)
+			So(principal.Can(RoleViewer, nil), ShouldBeTrue)
+		})
+
+		Convey("Updating it with no Roles should remove them all", func() {
+			user.Roles = []*common.RoleBinding{}
+			So(user.Update(), ShouldBeNil)
+
+			principal, err := core.Authenticate("ci", "hunter2")
+			So(err, ShouldBeNil)
+			So(principal.Roles, ShouldBeEmpty)
+		})
+
+		Convey("The name supervisor should be reserved", func() {
+			other := core.Users().New()
+			other.Name = common.IDString("supervisor")
+			So(ErrorCode(core.Users().Create(other)), ShouldEqual, common.ErrorCodeValidation)
+		})
+
+		Convey("An invalid Role should be rejected", func() {
+			other := core.Users().New()
+			other.Name = common.IDString("other")
+			other.Roles = []*common.RoleBinding{{Role: "owner"}}
+			So(core.Users().Create(other), ShouldNotBeNil)
+		})
+
+		Convey("When an APIToken is created for it", func() {
+			token := core.APITokens().New()
+			token.User = user.Name
+			So(core.APITokens().Create(token), ShouldBeNil)
+			So(token.Token, ShouldStartWith, *token.ID+".")
+
+			Convey("The token should authenticate as the User", func() {
+				principal, err := core.AuthenticateToken(token.Token)
+				So(err, ShouldBeNil)
+				So(principal.Name, ShouldEqual, "ci")
+				So(principal.Can(RoleDeployer, common.IDString("search")), ShouldBeTrue)
+			})
+
+			Convey("The secret should not be stored", func() {
+				saved, err := core.APITokens().Get(token.ID)
+				So(err, ShouldBeNil)
+				So(saved.Token, ShouldBeEmpty)
+				So(token.Token, ShouldNotContainSubstring, saved.SecretHash)
+			})
+
+			Convey("A wrong secret should not authenticate", func() {
+				_, err := core.AuthenticateToken(*token.ID + ".wrong")
+				So(err, ShouldEqual, ErrUnauthenticated)
+			})
+
+			Convey("Deleting the User should revoke the token", func() {
+				So(user.Delete(), ShouldBeNil)
+				_, err := core.AuthenticateToken(token.Token)
+				So(err, ShouldEqual, ErrUnauthenticated)
+				_, err = core.APITokens().Get(token.ID)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a Core started with an admin password", t, func() {
+		core := &Core{db: newDB(newMemoryStore()), AdminPassword: "first"}
+		So(core.initializeAuth(), ShouldBeNil)
+
+		Convey("The admin User should be an install-wide admin", func() {
+			principal, err := core.Authenticate("admin", "first")
+			So(err, ShouldBeNil)
+			So(principal.Can(RoleAdmin, nil), ShouldBeTrue)
+		})
+
+		Convey("The service token should authenticate the Supervisor as a deployer", func() {
+			principal, err := core.AuthenticateToken(core.ServiceToken())
+			So(err, ShouldBeNil)
+			So(principal.Name, ShouldEqual, "supervisor")
+			So(principal.Can(RoleDeployer, common.IDString("search")), ShouldBeTrue)
+			So(principal.Can(RoleAdmin, nil), ShouldBeFalse)
+		})
+
+		Convey("A verified password should be remembered until it is changed", func() {
+			_, err := core.Authenticate("admin", "first")
+			So(err, ShouldBeNil)
+			So(core.credentials.entries, ShouldContainKey, "admin")
+
+			_, err = core.Authenticate("admin", "wrong")
+			So(err, ShouldEqual, ErrUnauthenticated)
+
+			admin, err := core.Users().Get(common.IDString("admin"))
+			So(err, ShouldBeNil)
+			admin.Password = "changed"
+			So(admin.Update(), ShouldBeNil)
+			_, err = core.Authenticate("admin", "first")
+			So(err, ShouldEqual, ErrUnauthenticated)
+		})
+
+		Convey("Restarting with a new admin password should reset it", func() {
+			restarted := &Core{db: core.db, AdminPassword: "second"}
+			So(restarted.initializeAuth(), ShouldBeNil)
+
+			admin, err := restarted.Users().Get(common.IDString("admin"))
+			So(err, ShouldBeNil)
+			So(admin.Roles, ShouldHaveLength, 1)
+
+			_, err = restarted.Authenticate("admin", "first")
+			So(err, ShouldEqual, ErrUnauthenticated)
+			_, err = restarted.Authenticate("admin", "second")
+			So(err, ShouldBeNil)
+
+			_, err = restarted.AuthenticateToken(core.ServiceToken())
+			So(err, ShouldEqual, ErrUnauthenticated)
+		})
+	})
+}
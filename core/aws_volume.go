@@ -2,8 +2,10 @@ package core
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
@@ -95,7 +97,7 @@ func (m *AwsVolume) createAwsVolume(snapshotID *string) error {
 	return nil
 }
 
-func (m *AwsVolume) createSnapshot() (*ec2.Snapshot, error) {
+func (m *AwsVolume) createSnapshot(ctx context.Context) (*ec2.Snapshot, error) {
 	vol, err := m.awsVolume()
 	if err != nil {
 		return nil, err
@@ -112,7 +114,26 @@ func (m *AwsVolume) createSnapshot() (*ec2.Snapshot, error) {
 	waitInput := &ec2.DescribeSnapshotsInput{
 		SnapshotIds: []*string{snapshot.SnapshotId},
 	}
-	if err := m.core.ec2.WaitUntilSnapshotCompleted(waitInput); err != nil {
+
+	// NOTE we poll here instead of using WaitUntilSnapshotCompleted, since the
+	// AWS waiters can not be cancelled.
+	desc := fmt.Sprintf("EBS snapshot of %s to complete", m.name())
+	err = common.WaitFor(ctx, desc, 4*time.Hour, 15*time.Second, func() (bool, error) {
+		resp, err := m.core.ec2.DescribeSnapshots(waitInput)
+		if err != nil {
+			return false, err
+		}
+		for _, snap := range resp.Snapshots {
+			if *snap.State == "error" {
+				return false, fmt.Errorf("EBS snapshot %s failed", *snap.SnapshotId)
+			}
+			if *snap.State != "completed" {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
 		return snapshot, err // TODO
 	}
 	return snapshot, nil
@@ -139,7 +160,7 @@ func (m *AwsVolume) Create() error {
 	return m.createAwsVolume(nil)
 }
 
-func (m *AwsVolume) waitForAvailable() error {
+func (m *AwsVolume) waitForAvailable(ctx context.Context) error {
 	vol, err := m.awsVolume()
 	if err != nil {
 		return err
@@ -156,11 +177,26 @@ func (m *AwsVolume) waitForAvailable() error {
 		},
 	}
 	Log.Infof("Waiting for EBS volume %s to be available", m.name())
-	return m.core.ec2.WaitUntilVolumeAvailable(input)
+
+	// NOTE we poll here instead of using WaitUntilVolumeAvailable, since the AWS
+	// waiters can not be cancelled.
+	desc := fmt.Sprintf("EBS volume %s to be available", m.name())
+	return common.WaitFor(ctx, desc, 10*time.Minute, 5*time.Second, func() (bool, error) {
+		resp, err := m.core.ec2.DescribeVolumes(input)
+		if err != nil {
+			return false, err
+		}
+		for _, vol := range resp.Volumes {
+			if *vol.State != "available" {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
 }
 
 // Delete deletes the EBS volume on AWS.
-func (m *AwsVolume) Delete() error {
+func (m *AwsVolume) Delete(ctx context.Context) error {
 	vol, err := m.awsVolume()
 	if err != nil {
 		return err
@@ -168,7 +204,7 @@ func (m *AwsVolume) Delete() error {
 	if vol == nil {
 		return nil
 	}
-	if err := m.waitForAvailable(); err != nil {
+	if err := m.waitForAvailable(ctx); err != nil {
 		return err
 	}
 	input := &ec2.DeleteVolumeInput{
@@ -193,13 +229,13 @@ func (m *AwsVolume) needsResize() bool {
 
 //resize snapshots the volume, creates a new volume from the snapshot, deletes
 // the old volume, and renames the new volume to have the old name.
-func (m *AwsVolume) resize() error {
+func (m *AwsVolume) resize(ctx context.Context) error {
 	Log.Infof("Resizing EBS volume %s", m.name())
-	snapshot, err := m.createSnapshot()
+	snapshot, err := m.createSnapshot(ctx)
 	if err != nil {
 		return err
 	}
-	if err := m.Delete(); err != nil {
+	if err := m.Delete(ctx); err != nil {
 		return err
 	}
 	if err := m.createAwsVolume(snapshot.SnapshotId); err != nil {
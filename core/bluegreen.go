@@ -0,0 +1,173 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
+)
+
+// instanceGroupLabel labels pods with the InstanceGroup of their Release, for
+// the Services of blue-green deploys to select one group at a time.
+const instanceGroupLabel = "instance_group"
+
+// blueGreenReadyTimeout is how long a blue-green deploy waits for every
+// Instance of the target Release to be ready, before aborting.
+var blueGreenReadyTimeout = 10 * time.Minute
+
+// errBlueGreenVolumes is returned for blue-green deploys of Releases with
+// volumes, which can only be attached to one Instance at a time.
+var errBlueGreenVolumes = conflictError("Blue-green deploys cannot be used with volumes")
+
+// deployBlueGreen starts every Instance of target alongside those of current,
+// and once they are all ready, switches the Services from the InstanceGroup of
+// current to that of target, before stopping the Instances of current. If the
+// target Instances do not become ready in time, they are stopped again, and
+// the deploy is aborted with the Services still on current.
+func deployBlueGreen(ctx context.Context, current *ReleaseResource, target *ReleaseResource) error {
+	if len(current.Volumes) > 0 || len(target.Volumes) > 0 {
+		return abortError{errBlueGreenVolumes}
+	}
+
+	// Pin the Services to the current pods, so they do not also send traffic to
+	// the target ones as they start.
+	if err := current.labelInstanceGroup(ctx); err != nil {
+		return err
+	}
+	if err := target.selectInstanceGroup(ctx, common.StringID(current.InstanceGroup)); err != nil {
+		return err
+	}
+
+	if err := target.startAll(ctx); err != nil {
+		// NOTE the target Instances are stopped with a new context, since ctx may
+		// be what ended the deploy.
+		if stopErr := target.stopAll(context.Background()); stopErr != nil {
+			Log.Errorf("Could not stop Instances of aborted deploy: %s", stopErr)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return abortError{fmt.Errorf("Aborted blue-green deploy, keeping the current Release: %s", err)}
+	}
+
+	if err := target.selectInstanceGroup(ctx, common.StringID(target.InstanceGroup)); err != nil {
+		return err
+	}
+	return current.stopAll(ctx)
+}
+
+// startAll starts every Instance of the Release, and waits until they are all
+// ready.
+func (r *ReleaseResource) startAll(ctx context.Context) error {
+	instances := r.Instances()
+	for _, instance := range instances.List().Items {
+		if err := instances.Start(ctx, instance); err != nil {
+			return err
+		}
+	}
+	desc := fmt.Sprintf("Instances of Release %s to be ready", common.StringID(r.Timestamp))
+	return common.WaitFor(ctx, desc, blueGreenReadyTimeout, 5*time.Second, func() (bool, error) {
+		return r.IsStarted(), nil
+	})
+}
+
+func (r *ReleaseResource) stopAll(ctx context.Context) error {
+	instances := r.Instances()
+	for _, instance := range instances.List().Items {
+		if err := instances.Stop(ctx, instance); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labelInstanceGroup labels the pods of the Release, and the templates of
+// their ReplicationControllers, with its InstanceGroup, which those created
+// before the label was added lack.
+func (r *ReleaseResource) labelInstanceGroup(ctx context.Context) error {
+	namespace := common.StringID(r.App().Name)
+	group := common.StringID(r.InstanceGroup)
+	labels := map[string]interface{}{
+		"labels": map[string]string{instanceGroupLabel: group},
+	}
+
+	for _, instance := range r.Instances().List().Items {
+		rc, err := instance.replicationController()
+		if isKubeNotFoundErr(err) {
+			continue
+		} else if err != nil {
+			return upstreamErr("Kubernetes", err)
+		}
+		if rc.Spec.Template.Metadata.Labels[instanceGroupLabel] != group {
+			Log.Infof("Labeling ReplicationController %s with InstanceGroup %s", instance.Name, group)
+			patch := map[string]interface{}{
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{"metadata": labels},
+				},
+			}
+			if err := r.core.k8sMergePatch(ctx, path.Join("api/v1/namespaces", namespace, "replicationcontrollers", instance.Name), patch); err != nil {
+				return err
+			}
+		}
+
+		pod, err := instance.pod()
+		if err != nil {
+			return err
+		}
+		if pod != nil && pod.Metadata.Labels[instanceGroupLabel] != group {
+			Log.Infof("Labeling pod %s with InstanceGroup %s", pod.Metadata.Name, group)
+			patch := map[string]interface{}{"metadata": labels}
+			if err := r.core.k8sMergePatch(ctx, path.Join("api/v1/namespaces", namespace, "pods", pod.Metadata.Name), patch); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// selectInstanceGroup points the Services of the Component at the pods of one
+// InstanceGroup, or at those of all of them when group is empty. Each Service
+// is switched in one step.
+func (r *ReleaseResource) selectInstanceGroup(ctx context.Context, group string) error {
+	// NOTE a nil value removes the label from the selectors.
+	var value interface{}
+	if group != "" {
+		value = group
+	}
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{instanceGroupLabel: value},
+		},
+	}
+
+	for _, name := range []string{r.InternalServiceName(), r.ExternalServiceName()} {
+		svc, err := r.getService(name)
+		if isKubeNotFoundErr(err) {
+			continue
+		} else if err != nil {
+			return upstreamErr("Kubernetes", err)
+		}
+		if svc.Spec.Selector[instanceGroupLabel] == group {
+			continue
+		}
+
+		Log.Infof("Switching Service %s to InstanceGroup %q", name, group)
+		if err := r.core.k8sMergePatch(ctx, path.Join("api/v1/namespaces", common.StringID(r.App().Name), "services", name), patch); err != nil {
+			return err
+		}
+
+		// NOTE the Services are reloaded, so the later port changes of the deploy
+		// do not send back the old selector.
+		if svc, err = r.getService(name); err != nil {
+			return upstreamErr("Kubernetes", err)
+		}
+		if name == r.InternalServiceName() {
+			r.InternalService = svc
+		} else {
+			r.ExternalService = svc
+		}
+	}
+	return nil
+}
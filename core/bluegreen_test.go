@@ -0,0 +1,230 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/guber"
+	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
+)
+
+// fakeKube is just enough of the Kubernetes API for deploys: the pod labels
+// and Service selectors, by name, and one pod for each ReplicationController.
+type fakeKube struct {
+	mu        sync.Mutex
+	rcs       map[string]map[string]string // template labels
+	pods      map[string]map[string]string // labels, by instance name
+	services  map[string]map[string]string // selectors
+	notReady  string                       // pods of this InstanceGroup never become ready
+	restarts  map[string]int               // container restarts, by instance name
+	rcPatches int
+}
+
+func (k *fakeKube) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/test/"), "/")
+	kind, name := parts[0], ""
+	if len(parts) > 1 {
+		name = parts[1]
+	}
+
+	write := func(v interface{}) {
+		body, _ := json.Marshal(v)
+		w.Write(body)
+	}
+	patchLabels := func(labels map[string]string, patch map[string]interface{}) {
+		for key, value := range patch {
+			if value == nil {
+				delete(labels, key)
+			} else {
+				labels[key] = value.(string)
+			}
+		}
+	}
+
+	switch {
+	case kind == "services" && r.Method == "GET" && k.services[name] != nil:
+		write(&guber.Service{Metadata: &guber.Metadata{Name: name}, Spec: &guber.ServiceSpec{Selector: k.services[name]}})
+
+	case kind == "services" && r.Method == "PATCH" && k.services[name] != nil:
+		patch := new(struct {
+			Spec struct {
+				Selector map[string]interface{} `json:"selector"`
+			} `json:"spec"`
+		})
+		json.NewDecoder(r.Body).Decode(patch)
+		patchLabels(k.services[name], patch.Spec.Selector)
+		write(map[string]interface{}{})
+
+	case kind == "replicationcontrollers" && r.Method == "POST":
+		rc := new(guber.ReplicationController)
+		json.NewDecoder(r.Body).Decode(rc)
+		name = rc.Metadata.Name
+		k.rcs[name] = rc.Spec.Template.Metadata.Labels
+		k.pods[name] = make(map[string]string)
+		for key, value := range rc.Spec.Template.Metadata.Labels {
+			k.pods[name][key] = value
+		}
+		write(rc)
+
+	case kind == "replicationcontrollers" && r.Method == "GET" && k.rcs[name] != nil:
+		write(&guber.ReplicationController{
+			Metadata: &guber.Metadata{Name: name},
+			Spec:     &guber.ReplicationControllerSpec{Replicas: 1, Template: &guber.PodTemplate{Metadata: &guber.Metadata{Labels: k.rcs[name]}}},
+			Status:   &guber.ReplicationControllerStatus{Replicas: 1},
+		})
+
+	case kind == "replicationcontrollers" && r.Method == "PATCH" && k.rcs[name] != nil:
+		patch := new(struct {
+			Spec struct {
+				Template struct {
+					Metadata struct {
+						Labels map[string]interface{} `json:"labels"`
+					} `json:"metadata"`
+				} `json:"template"`
+			} `json:"spec"`
+		})
+		json.NewDecoder(r.Body).Decode(patch)
+		patchLabels(k.rcs[name], patch.Spec.Template.Metadata.Labels)
+		k.rcPatches++
+		write(map[string]interface{}{})
+
+	case kind == "replicationcontrollers" && r.Method == "DELETE" && k.rcs[name] != nil:
+		delete(k.rcs, name)
+		write(map[string]interface{}{})
+
+	case kind == "pods" && r.Method == "GET" && name == "":
+		instance := strings.TrimPrefix(r.URL.Query().Get("labelSelector"), "instance=")
+		list := &guber.PodList{Items: []*guber.Pod{}}
+		if labels, ok := k.pods[instance]; ok {
+			ready := "True"
+			if k.notReady != "" && strings.HasSuffix(instance, k.notReady) {
+				ready = "False"
+			}
+			list.Items = append(list.Items, &guber.Pod{
+				Metadata: &guber.Metadata{Name: instance + "-pod", Labels: labels},
+				Status: &guber.PodStatus{
+					Conditions:        []*guber.PodStatusCondition{{Type: "Ready", Status: ready}},
+					ContainerStatuses: []*guber.ContainerStatus{{Ready: ready == "True", RestartCount: k.restarts[instance]}},
+				},
+			})
+		}
+		write(list)
+
+	case kind == "pods" && (r.Method == "PATCH" || r.Method == "DELETE") && k.pods[strings.TrimSuffix(name, "-pod")] != nil:
+		instance := strings.TrimSuffix(name, "-pod")
+		if r.Method == "DELETE" {
+			delete(k.pods, instance)
+		} else {
+			patch := new(struct {
+				Metadata struct {
+					Labels map[string]interface{} `json:"labels"`
+				} `json:"metadata"`
+			})
+			json.NewDecoder(r.Body).Decode(patch)
+			patchLabels(k.pods[instance], patch.Metadata.Labels)
+		}
+		write(map[string]interface{}{})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestDeployBlueGreen(t *testing.T) {
+	Convey("Given a Component running a Release with 2 Instances created before the instance_group label", t, func() {
+		kube := &fakeKube{
+			rcs: map[string]map[string]string{
+				"web-0v1": {"service": "web", "instance": "web-0v1"},
+				"web-1v1": {"service": "web", "instance": "web-1v1"},
+			},
+			pods: map[string]map[string]string{
+				"web-0v1": {"service": "web", "instance": "web-0v1"},
+				"web-1v1": {"service": "web", "instance": "web-1v1"},
+			},
+			services: map[string]map[string]string{
+				"web":        {"service": "web"},
+				"web-public": {"service": "web"},
+			},
+		}
+		server := httptest.NewTLSServer(kube)
+		defer server.Close()
+
+		host := strings.TrimPrefix(server.URL, "https://")
+		core := &Core{db: newDB(newMemoryStore()), K8sHost: host, K8sUser: "u", K8sPass: "p", k8sHTTP: newK8sHTTPClient(true)}
+		core.k8s = guber.NewClient(host, "u", "p", true)
+
+		app := core.Apps().New()
+		app.Name = common.IDString("test")
+		component := app.Components().New()
+		component.Name = common.IDString("web")
+		component.Strategy = common.DeployStrategyBlueGreen
+
+		newRelease := func(instanceGroup string) *ReleaseResource {
+			release := component.Releases().New()
+			release.Timestamp = common.IDString(instanceGroup)
+			release.InstanceGroup = common.IDString(instanceGroup)
+			release.InstanceCount = 2
+			release.Containers = []*common.ContainerBlueprint{{Image: "nginx"}}
+			return release
+		}
+		current := newRelease("v1")
+		target := newRelease("v2")
+
+		Convey("Once the target Instances are ready, the Services should be switched to them and the current ones stopped", func() {
+			err := deployBlueGreen(context.Background(), current, target)
+			So(err, ShouldBeNil)
+
+			So(kube.services["web"], ShouldResemble, map[string]string{"service": "web", "instance_group": "v2"})
+			So(kube.services["web-public"], ShouldResemble, map[string]string{"service": "web", "instance_group": "v2"})
+			So(kube.rcs, ShouldContainKey, "web-0v2")
+			So(kube.rcs, ShouldContainKey, "web-1v2")
+			So(kube.rcs, ShouldNotContainKey, "web-0v1")
+			So(kube.pods, ShouldNotContainKey, "web-1v1")
+			So(kube.pods["web-0v2"]["instance_group"], ShouldEqual, "v2")
+			So(kube.rcPatches, ShouldEqual, 2)
+		})
+
+		Convey("When the target Instances do not become ready, the deploy should abort and keep the current ones", func() {
+			kube.notReady = "v2"
+			defer func(timeout time.Duration) { blueGreenReadyTimeout = timeout }(blueGreenReadyTimeout)
+			blueGreenReadyTimeout = 0
+
+			err := deployBlueGreen(context.Background(), current, target)
+			So(err, ShouldHaveSameTypeAs, abortError{})
+			So(err.Error(), ShouldStartWith, "Aborted blue-green deploy")
+
+			So(kube.services["web"], ShouldResemble, map[string]string{"service": "web", "instance_group": "v1"})
+			So(kube.rcs, ShouldNotContainKey, "web-0v2")
+			So(kube.pods, ShouldNotContainKey, "web-1v2")
+			So(kube.pods["web-0v1"]["instance_group"], ShouldEqual, "v1")
+			So(kube.rcs["web-1v1"]["instance_group"], ShouldEqual, "v1")
+		})
+
+		Convey("A Release with volumes should be aborted before starting anything", func() {
+			target.Volumes = []*common.VolumeBlueprint{{Name: common.IDString("data")}}
+
+			err := deployBlueGreen(context.Background(), current, target)
+			So(err, ShouldResemble, abortError{errBlueGreenVolumes})
+			So(kube.rcs, ShouldHaveLength, 2)
+			So(kube.services["web"], ShouldNotContainKey, "instance_group")
+		})
+
+		Convey("Unpinning should remove the InstanceGroup from the Service selectors", func() {
+			kube.services["web"]["instance_group"] = "v1"
+
+			So(target.selectInstanceGroup(context.Background(), ""), ShouldBeNil)
+			So(kube.services["web"], ShouldResemble, map[string]string{"service": "web"})
+		})
+	})
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/supergiant/supergiant/common"
+	"github.com/supergiant/supergiant/deploy"
+	"golang.org/x/net/context"
+)
+
+// canaryPollInterval is how often a canary deploy checks the health of the
+// canaries, and whether they have been promoted or aborted.
+var canaryPollInterval = 5 * time.Second
+
+// canaryPromoteTimeout is how long a canary deploy with no pause waits to be
+// promoted before it is aborted, so that a forgotten deploy does not hold the
+// Component (and a Supervisor worker) forever.
+var canaryPromoteTimeout = 24 * time.Hour
+
+// errCanaryVolumes is returned for canary deploys of Releases with volumes,
+// which the canaries would have to share with the Instances they replace.
+var errCanaryVolumes = conflictError("Canary deploys cannot be used with volumes")
+
+// deployCanary starts the first Instances of target as canaries, alongside
+// all of those of current and behind the same Services. Once they have run
+// for the pause of the Component's CanaryOptions, or are promoted, the rest
+// of the Instances are replaced one at a time. The deploy is aborted, and the
+// canaries stopped, if any of them restarts too often, or is not started by
+// then, or if the deploy is aborted through the API. With no pause, it is
+// aborted if not promoted within canaryPromoteTimeout.
+func (c *ComponentCollection) deployCanary(ctx context.Context, r *ComponentResource, current *ReleaseResource, target *ReleaseResource) error {
+	if len(current.Volumes) > 0 || len(target.Volumes) > 0 {
+		return abortError{errCanaryVolumes}
+	}
+
+	opts := r.Canary
+	if opts == nil {
+		opts = new(common.CanaryOptions)
+	}
+
+	// NOTE when the deploy is retried, the canaries keep the time they were
+	// first started at.
+	if target.Canary == nil {
+		count := opts.Instances
+		if count < 1 {
+			count = 1
+		}
+		if count > target.InstanceCount {
+			count = target.InstanceCount
+		}
+		err := c.core.db.retryUpdate(target.collection.(Collection), target.Timestamp, target, func() error {
+			target.Canary = &common.ReleaseCanary{Instances: count, Started: common.NewTimestamp()}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	instances := target.Instances()
+	canaries := instances.List().Items[:target.Canary.Instances]
+	for _, instance := range canaries {
+		if err := instances.Start(ctx, instance); err != nil {
+			return c.abortCanary(ctx, target, err)
+		}
+	}
+
+	var deadline, promoteDeadline time.Time
+	if opts.Pause > 0 {
+		deadline = target.Canary.Started.Add(time.Duration(opts.Pause) * time.Second)
+	} else {
+		promoteDeadline = target.Canary.Started.Add(canaryPromoteTimeout)
+	}
+
+	for {
+		started := true
+		for _, canary := range canaries {
+			// NOTE Get loads the status of the pod again.
+			instance, err := instances.Get(canary.ID)
+			if err != nil {
+				return err
+			}
+			if instance.Restarts > opts.MaxRestarts {
+				return c.abortCanary(ctx, target, fmt.Errorf("Canary Instance %s restarted %d times", instance.Name, instance.Restarts))
+			}
+			started = started && instance.IsStarted()
+		}
+
+		latest := newResourceLike(target).(*ReleaseResource)
+		if err := c.core.db.get(target.collection.(Collection), target.Timestamp, latest); err != nil {
+			return err
+		}
+		if latest.Canary != nil && latest.Canary.Aborted != nil {
+			return c.abortCanary(ctx, target, fmt.Errorf("Canary deploy of Release %s was aborted", common.StringID(target.Timestamp)))
+		}
+		promoted := latest.Canary != nil && latest.Canary.Promoted != nil
+
+		if !promoted && !promoteDeadline.IsZero() && time.Now().After(promoteDeadline) {
+			return c.abortCanary(ctx, target, fmt.Errorf("Canaries of Release %s were not promoted within %s", common.StringID(target.Timestamp), canaryPromoteTimeout))
+		}
+		if promoted || (!deadline.IsZero() && time.Now().After(deadline)) {
+			if !started {
+				return c.abortCanary(ctx, target, fmt.Errorf("Canary Instances of Release %s were not started", common.StringID(target.Timestamp)))
+			}
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return c.abortCanary(ctx, target, ctx.Err())
+		case <-time.After(canaryPollInterval):
+		}
+	}
+
+	// This goes to the deploy/ folder which uses the client package.
+	return deploy.Deploy(ctx, c.core.apiClient(), c.app.Name, r.Name)
+}
+
+// abortCanary stops the canaries of target, and returns the error of the
+// aborted deploy, which is not retried (unless it was cancelled).
+func (c *ComponentCollection) abortCanary(ctx context.Context, target *ReleaseResource, err error) error {
+	// NOTE the canaries are stopped with a new context, since ctx may be what
+	// ended the deploy.
+	instances := target.Instances()
+	for _, instance := range instances.List().Items[:target.Canary.Instances] {
+		if stopErr := instances.Stop(context.Background(), instance); stopErr != nil {
+			Log.Errorf("Could not stop canary Instance %s: %s", instance.Name, stopErr)
+		}
+	}
+
+	// The canaries are gone, so the next deploy starts them again.
+	updateErr := c.core.db.retryUpdate(target.collection.(Collection), target.Timestamp, target, func() error {
+		target.Canary = nil
+		return nil
+	})
+	if updateErr != nil {
+		Log.Errorf("Could not clear canaries of Release %s: %s", common.StringID(target.Timestamp), updateErr)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return abortError{fmt.Errorf("Aborted canary deploy, keeping the current Release: %s", err)}
+}
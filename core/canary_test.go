@@ -0,0 +1,172 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/guber"
+	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
+)
+
+func TestDeployCanary(t *testing.T) {
+	Convey("Given a canary deploy of a Component from a Release with 2 Instances", t, func() {
+		kube := &fakeKube{
+			rcs: map[string]map[string]string{
+				"web-0v1": {"service": "web", "instance": "web-0v1", "instance_group": "v1"},
+				"web-1v1": {"service": "web", "instance": "web-1v1", "instance_group": "v1"},
+			},
+			pods: map[string]map[string]string{
+				"web-0v1": {"service": "web", "instance": "web-0v1", "instance_group": "v1"},
+				"web-1v1": {"service": "web", "instance": "web-1v1", "instance_group": "v1"},
+			},
+			services: map[string]map[string]string{
+				"web": {"service": "web"},
+			},
+			restarts: make(map[string]int),
+		}
+		server := httptest.NewTLSServer(kube)
+		defer server.Close()
+
+		host := strings.TrimPrefix(server.URL, "https://")
+		core := &Core{db: newDB(newMemoryStore()), K8sHost: host, K8sUser: "u", K8sPass: "p", k8sHTTP: newK8sHTTPClient(true)}
+		core.k8s = guber.NewClient(host, "u", "p", true)
+		// NOTE the rolling deploy after the canaries goes through the API.
+		core.APIHandler = http.NotFoundHandler()
+
+		defer func(interval time.Duration) { canaryPollInterval = interval }(canaryPollInterval)
+		canaryPollInterval = 10 * time.Millisecond
+
+		storeRelease := func(timestamp string) {
+			_, err := core.db.store.create("/releases/test/web/"+timestamp, `{"timestamp":"`+timestamp+`","instance_group":"`+timestamp+`","committed":true,"instance_count":2,"containers":[{"image":"nginx","cpu":{},"ram":{}}],"termination_grace_period":10,"tags":{}}`)
+			So(err, ShouldBeNil)
+		}
+		_, err := core.db.store.create("/apps/test", `{"name":"test","tags":{}}`)
+		So(err, ShouldBeNil)
+		_, err = core.db.store.create("/components/test/web", `{"name":"web","strategy":"canary","canary":{"instances":1,"pause":0,"max_restarts":1},"current_release_id":"v1","target_release_id":"v2","tags":{}}`)
+		So(err, ShouldBeNil)
+		storeRelease("v1")
+		storeRelease("v2")
+
+		app, err := core.Apps().Get(common.IDString("test"))
+		So(err, ShouldBeNil)
+		component, err := app.Components().Get(common.IDString("web"))
+		So(err, ShouldBeNil)
+		current, err := component.CurrentRelease()
+		So(err, ShouldBeNil)
+		target, err := component.TargetRelease()
+		So(err, ShouldBeNil)
+
+		deployCanary := func() <-chan error {
+			done := make(chan error, 1)
+			go func() {
+				done <- component.collection.(*ComponentCollection).deployCanary(context.Background(), component, current, target)
+			}()
+			return done
+		}
+		storedCanary := func() *common.ReleaseCanary {
+			release, err := component.TargetRelease()
+			So(err, ShouldBeNil)
+			return release.Canary
+		}
+
+		Convey("Promoting before the canaries are started should conflict", func() {
+			_, err := component.Promote()
+			So(ErrorCode(err), ShouldEqual, common.ErrorCodeConflict)
+		})
+
+		Convey("Once promoted, the deploy should go on from the canaries to the rest of the Instances", func() {
+			done := deployCanary()
+			for storedCanary() == nil {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(kube.rcs, ShouldContainKey, "web-0v2")
+			So(kube.rcs, ShouldNotContainKey, "web-1v2")
+			So(kube.rcs, ShouldContainKey, "web-0v1")
+
+			release, err := component.Promote()
+			So(err, ShouldBeNil)
+			So(release.Canary.Promoted, ShouldNotBeNil)
+
+			select {
+			case err := <-done:
+				// The rolling deploy was reached, and failed on the API faked here.
+				So(err, ShouldNotBeNil)
+				So(err, ShouldNotHaveSameTypeAs, abortError{})
+			case <-time.After(5 * time.Second):
+				So("the deploy to go on", ShouldBeEmpty)
+			}
+			So(kube.rcs, ShouldContainKey, "web-0v2")
+			So(storedCanary().Instances, ShouldEqual, 1)
+		})
+
+		Convey("Once aborted, the deploy should fail and remove the canaries", func() {
+			done := deployCanary()
+			for storedCanary() == nil {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			release, err := component.Abort()
+			So(err, ShouldBeNil)
+			So(release.Canary.Aborted, ShouldNotBeNil)
+
+			_, err = component.Promote()
+			So(ErrorCode(err), ShouldEqual, common.ErrorCodeConflict)
+
+			select {
+			case err := <-done:
+				So(err, ShouldHaveSameTypeAs, abortError{})
+				So(err.Error(), ShouldContainSubstring, "Canary deploy of Release v2 was aborted")
+			case <-time.After(5 * time.Second):
+				So("the deploy to be aborted", ShouldBeEmpty)
+			}
+			So(kube.rcs, ShouldNotContainKey, "web-0v2")
+			So(kube.rcs, ShouldContainKey, "web-0v1")
+			So(storedCanary(), ShouldBeNil)
+		})
+
+		Convey("Canaries not promoted within canaryPromoteTimeout should abort the deploy", func() {
+			defer func(timeout time.Duration) { canaryPromoteTimeout = timeout }(canaryPromoteTimeout)
+			canaryPromoteTimeout = 50 * time.Millisecond
+
+			err := <-deployCanary()
+			So(err, ShouldHaveSameTypeAs, abortError{})
+			So(err.Error(), ShouldContainSubstring, "were not promoted within")
+			So(kube.rcs, ShouldNotContainKey, "web-0v2")
+		})
+
+		Convey("A canary restarting more than MaxRestarts should abort the deploy, and be removed", func() {
+			kube.restarts["web-0v2"] = 2
+
+			err := <-deployCanary()
+			So(err, ShouldHaveSameTypeAs, abortError{})
+			So(err.Error(), ShouldContainSubstring, "Canary Instance web-0v2 restarted 2 times")
+			So(kube.rcs, ShouldNotContainKey, "web-0v2")
+			So(kube.rcs, ShouldContainKey, "web-0v1")
+			So(storedCanary(), ShouldBeNil)
+		})
+
+		Convey("Canaries not started by the end of the pause should abort the deploy", func() {
+			kube.notReady = "v2"
+			component.Canary.Pause = 1
+
+			err := <-deployCanary()
+			So(err, ShouldHaveSameTypeAs, abortError{})
+			So(err.Error(), ShouldContainSubstring, "were not started")
+			So(kube.pods, ShouldNotContainKey, "web-0v2")
+		})
+
+		Convey("A Release with volumes should not be deployed with canaries", func() {
+			target.Volumes = []*common.VolumeBlueprint{{Name: common.IDString("data")}}
+
+			err := <-deployCanary()
+			So(err, ShouldResemble, abortError{errCanaryVolumes})
+			So(kube.rcs, ShouldHaveLength, 2)
+		})
+	})
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/supergiant/guber"
 	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
 )
 
 type instanceType struct {
@@ -240,14 +241,24 @@ func (s *capacityService) incomingPods() (incomingPods []*guber.Pod, err error)
 	return incomingPods, nil
 }
 
-func (s *capacityService) Run() {
-	for _ = range time.NewTicker(1 * time.Second).C {
+// Run adds and removes Nodes to meet requested capacity until ctx is done.
+func (s *capacityService) Run(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 
 		// Log.Debug("Capacity service loop")
 
 		incomingPods, err := s.incomingPods()
 		if err != nil {
 			Log.Errorf("Capacity service error when fetching incoming pods: %s", err)
+			capacityErrors.inc("incoming_pods")
 			continue
 		}
 
@@ -338,6 +349,8 @@ func (s *capacityService) Run() {
 		existingNodes, err := s.core.Nodes().List()
 		if err != nil {
 			Log.Errorf("Capacity service error when fetching existing Nodes: %s", err)
+			capacityErrors.inc("list_nodes")
+			continue
 		}
 
 		for _, node := range existingNodes.Items {
@@ -350,14 +363,17 @@ func (s *capacityService) Run() {
 			hasPods, err := node.hasPodsWithReservedResources()
 			if err != nil {
 				Log.Errorf("Capacity service error when fetching Pods for Node: %s", err)
+				capacityErrors.inc("node_pods")
 			}
 
 			if !hasPods && time.Since(node.ProviderCreationTimestamp.Time) > minAgeToExist {
 
 				Log.Infof("Terminating node %s", node.Name)
+				capacityDecisions.inc("terminate_node", node.Class)
 
 				if err := node.Delete(); err != nil {
 					Log.Errorf("Capacity service error when deleting Node: %s", err)
+					capacityErrors.inc("terminate_node")
 				}
 			}
 		}
@@ -384,11 +400,14 @@ func (s *capacityService) Run() {
 				}
 			}
 			if alreadySpinningUp {
+				capacityDecisions.inc("wait_for_node", node.Class)
 				continue
 			}
 
+			capacityDecisions.inc("create_node", node.Class)
 			if err := s.core.Nodes().Create(node); err != nil {
 				Log.Errorf("Capacity service error when creating Node: %s", err)
+				capacityErrors.inc("create_node")
 			}
 		}
 	}
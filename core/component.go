@@ -1,10 +1,12 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/supergiant/supergiant/common"
 	"github.com/supergiant/supergiant/deploy"
+	"golang.org/x/net/context"
 )
 
 type ComponentsInterface interface {
@@ -12,13 +14,14 @@ type ComponentsInterface interface {
 	App() *AppResource
 
 	List() (*ComponentList, error)
+	ListWithOptions(*ListOptions) (*ComponentList, error)
 	New() *ComponentResource
 	Create(*ComponentResource) error
 	Get(common.ID) (*ComponentResource, error)
 	Update(common.ID, *ComponentResource) error
 	Patch(common.ID, *ComponentResource) error
-	Deploy(Resource) error
-	Delete(Resource) error
+	Deploy(context.Context, Resource) error
+	Delete(context.Context, Resource) error
 }
 
 // ComponentCollection implements ComponentsInterface.
@@ -37,7 +40,8 @@ type ComponentResource struct {
 }
 
 type ComponentList struct {
-	Items []*ComponentResource `json:"items"`
+	Items    []*ComponentResource `json:"items"`
+	Continue string               `json:"continue,omitempty"`
 }
 
 // initializeResource implements the Collection interface.
@@ -57,8 +61,13 @@ func (c *ComponentCollection) App() *AppResource {
 
 // List returns an ComponentList.
 func (c *ComponentCollection) List() (*ComponentList, error) {
+	return c.ListWithOptions(nil)
+}
+
+// ListWithOptions returns a ComponentList with opts applied (see ListOptions).
+func (c *ComponentCollection) ListWithOptions(opts *ListOptions) (*ComponentList, error) {
 	list := new(ComponentList)
-	err := c.core.db.list(c, list)
+	err := c.core.db.list(c, list, opts)
 	return list, err
 }
 
@@ -101,7 +110,8 @@ func (c *ComponentCollection) Patch(name common.ID, r *ComponentResource) error
 // Component in etcd.
 //
 // TODO this should somehow stop any ongoing tasks related to the Component.
-func (c *ComponentCollection) Delete(ri Resource) error {
+// They can be cancelled manually through the Task cancel endpoint for now.
+func (c *ComponentCollection) Delete(ctx context.Context, ri Resource) error {
 	r := ri.(*ComponentResource)
 
 	releases, err := r.Releases().List()
@@ -128,7 +138,12 @@ func (c *ComponentCollection) Delete(ri Resource) error {
 	return c.core.db.delete(c, r.Name)
 }
 
-func (c *ComponentCollection) Deploy(ri Resource) (err error) {
+// Deploy moves the Component from its current Release to its target Release.
+//
+// If ctx is cancelled part way, Deploy returns before retiring the current
+// Release, so the Component keeps both its current and target Release and the
+// deploy can be retried.
+func (c *ComponentCollection) Deploy(ctx context.Context, ri Resource) (err error) {
 	r := ri.(*ComponentResource)
 
 	var currentRelease *ReleaseResource
@@ -146,7 +161,7 @@ func (c *ComponentCollection) Deploy(ri Resource) (err error) {
 
 	// This sets up all the necessary dependencies (the only thing needed past the
 	// first release is volumes for new instances)
-	if err := targetRelease.Provision(); err != nil {
+	if err := targetRelease.Provision(ctx); err != nil {
 		return err
 	}
 
@@ -154,13 +169,31 @@ func (c *ComponentCollection) Deploy(ri Resource) (err error) {
 		targetRelease.AddNewPorts(currentRelease)
 	}
 
+	// NOTE scaling in the same InstanceGroup is the same for both strategies.
+	blueGreen := r.CustomDeployScript == nil && r.Strategy == common.DeployStrategyBlueGreen
+	if !blueGreen {
+		// A blue-green deploy leaves the Services on its InstanceGroup, which the
+		// Instances started by any other deploy are not in.
+		if err := targetRelease.selectInstanceGroup(ctx, ""); err != nil {
+			return err
+		}
+	}
+
 	if customDeploy := r.CustomDeployScript; customDeploy != nil {
-		if err := RunCustomDeployment(c.core, r); err != nil {
+		if err := RunCustomDeployment(ctx, c.core, r); err != nil {
+			return err
+		}
+	} else if blueGreen && currentRelease != nil && targetRelease.restartsFrom(currentRelease) {
+		if err := deployBlueGreen(ctx, currentRelease, targetRelease); err != nil {
+			return err
+		}
+	} else if r.Strategy == common.DeployStrategyCanary && currentRelease != nil && targetRelease.restartsFrom(currentRelease) {
+		if err := c.deployCanary(ctx, r, currentRelease, targetRelease); err != nil {
 			return err
 		}
 	} else {
 		// This goes to the deploy/ folder which uses the client package.
-		if err := deploy.Deploy(c.app.Name, r.Name); err != nil {
+		if err := deploy.Deploy(ctx, c.core.apiClient(), c.app.Name, r.Name); err != nil {
 			return err
 		}
 	}
@@ -168,7 +201,7 @@ func (c *ComponentCollection) Deploy(ri Resource) (err error) {
 	// Make sure old release (current) has been fully stopped, and the new release
 	// (target) has been fully started.
 	// It doesn't matter on the first deploy, though.
-	if currentRelease != nil && *currentRelease.InstanceGroup != *targetRelease.InstanceGroup {
+	if currentRelease != nil && targetRelease.restartsFrom(currentRelease) {
 		if !currentRelease.IsStopped() {
 			return fmt.Errorf("Current Release for Component %s:%s is not completely stopped.", common.StringID(c.app.Name), common.StringID(r.Name))
 		}
@@ -184,21 +217,27 @@ func (c *ComponentCollection) Deploy(ri Resource) (err error) {
 		instancesRemoving := currentRelease.InstanceCount - targetRelease.InstanceCount
 		instances := currentRelease.Instances().List().Items
 		for _, instance := range instances[len(instances)-instancesRemoving:] { // TODO test that this works correctly
-			instance.DeleteVolumes()
+			instance.DeleteVolumes(ctx)
 		}
 	}
 
 	if currentRelease != nil {
 		targetRelease.RemoveOldPorts(currentRelease)
 
-		currentRelease.Retired = true
-		currentRelease.Update()
+		c.core.db.retryUpdate(currentRelease.collection.(Collection), currentRelease.Timestamp, currentRelease, func() error {
+			currentRelease.Retired = true
+			return nil
+		})
 	}
 
 	// If we're all good, we set target to current, and remove target.
-	r.CurrentReleaseTimestamp = r.TargetReleaseTimestamp
-	r.TargetReleaseTimestamp = nil
-	return c.core.db.update(c, r.Name, r)
+	// NOTE the Component may have been changed while deploying, in which case we
+	// retry on top of the latest Component.
+	return c.core.db.retryUpdate(c, r.Name, r, func() error {
+		r.CurrentReleaseTimestamp = targetRelease.Timestamp
+		r.TargetReleaseTimestamp = nil
+		return nil
+	})
 }
 
 //------------------------------------------------------------------------------
@@ -299,7 +338,154 @@ func (r *ComponentResource) Patch() error {
 
 // Delete is a proxy method to ComponentCollection's Delete.
 func (r *ComponentResource) Delete() error {
-	return r.collection.Delete(r)
+	return r.collection.Delete(context.Background(), r)
+}
+
+// StartDeploy commits the target Release, and queues the deploy of the
+// Component to it.
+func (r *ComponentResource) StartDeploy() error {
+	if r.TargetReleaseTimestamp == nil {
+		return errors.New("Component does not have target Release")
+	}
+	release, err := r.TargetRelease()
+	if err != nil {
+		return err
+	}
+	if r.CustomDeployScript == nil && len(release.Volumes) > 0 {
+		switch r.Strategy {
+		case common.DeployStrategyBlueGreen:
+			return errBlueGreenVolumes
+		case common.DeployStrategyCanary:
+			return errCanaryVolumes
+		}
+	}
+	release.Committed = true
+	if err := release.Update(); err != nil {
+		return err
+	}
+	return r.Action("deploy").Supervise()
+}
+
+// Promote lets the deploy of the Component go on from its canaries to the
+// rest of the Instances, without waiting out the pause of its CanaryOptions.
+func (r *ComponentResource) Promote() (*ReleaseResource, error) {
+	return r.updateCanary(func(canary *common.ReleaseCanary) error {
+		if canary == nil {
+			return conflictError("Target Release does not have canaries to promote")
+		}
+		if canary.Aborted != nil {
+			return conflictError("Canary deploy of the target Release has been aborted")
+		}
+		if canary.Promoted == nil {
+			canary.Promoted = common.NewTimestamp()
+		}
+		return nil
+	})
+}
+
+// Abort ends the canary deploy of the Component, which removes the canaries
+// and fails without being retried, keeping the current Release. It cannot be
+// used once the canaries are promoted.
+func (r *ComponentResource) Abort() (*ReleaseResource, error) {
+	return r.updateCanary(func(canary *common.ReleaseCanary) error {
+		if canary == nil {
+			return conflictError("Target Release does not have canaries to abort")
+		}
+		if canary.Promoted != nil {
+			return conflictError("Canaries of the target Release have already been promoted")
+		}
+		if canary.Aborted == nil {
+			canary.Aborted = common.NewTimestamp()
+		}
+		return nil
+	})
+}
+
+// updateCanary applies mark to the canary state of the target Release, which
+// is nil when it has no canaries, and saves it.
+func (r *ComponentResource) updateCanary(mark func(*common.ReleaseCanary) error) (*ReleaseResource, error) {
+	if r.TargetReleaseTimestamp == nil {
+		return nil, conflictError("Component does not have target Release")
+	}
+	release, err := r.TargetRelease()
+	if err != nil {
+		return nil, err
+	}
+	err = r.core.db.retryUpdate(release.collection.(Collection), release.Timestamp, release, func() error {
+		return mark(release.Canary)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// Rollback creates a target Release cloned from the blueprint of a retired
+// Release (the most recent one when timestamp is nil), and queues the deploy
+// of the Component to it. The new Release records the rollback.
+func (r *ComponentResource) Rollback(timestamp common.ID) (*ReleaseResource, error) {
+	if r.TargetReleaseTimestamp != nil {
+		return nil, errTargetReleaseExists
+	}
+	if r.CurrentReleaseTimestamp == nil {
+		return nil, conflictError("Component has no current Release to roll back from")
+	}
+
+	source, err := r.rollbackSource(timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE the InstanceGroup is not cloned, since the Instances of the source
+	// Release are gone; the rollback starts new ones.
+	release := r.Releases().New()
+	release.InstanceCount = source.InstanceCount
+	release.Volumes = source.Volumes
+	release.Containers = source.Containers
+	release.TerminationGracePeriod = source.TerminationGracePeriod
+	release.Rollback = &common.ReleaseRollback{
+		Source:    source.Timestamp,
+		From:      r.CurrentReleaseTimestamp,
+		Timestamp: common.NewTimestamp(),
+	}
+
+	if err := r.Releases().Create(release); err != nil {
+		return nil, err
+	}
+	if err := r.StartDeploy(); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// rollbackSource returns the retired Release with the timestamp, or the most
+// recent retired Release when timestamp is nil.
+func (r *ComponentResource) rollbackSource(timestamp common.ID) (*ReleaseResource, error) {
+	if timestamp != nil {
+		release, err := r.Releases().Get(timestamp)
+		if err != nil {
+			return nil, err
+		}
+		if !release.Retired {
+			return nil, conflictError(fmt.Sprintf("Release %s is not retired, so it cannot be rolled back to", *timestamp))
+		}
+		return release, nil
+	}
+
+	list, err := r.Releases().List()
+	if err != nil {
+		return nil, err
+	}
+	var source *ReleaseResource
+	for _, release := range list.Items {
+		if release.Retired && (source == nil || *release.Timestamp > *source.Timestamp) {
+			source = release
+		}
+	}
+	if source == nil {
+		return nil, notFoundError("Component has no retired Release to roll back to")
+	}
+	return source, nil
 }
 
 func (r *ComponentResource) App() *AppResource {
@@ -1,10 +1,14 @@
 package core
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
 
+	"github.com/supergiant/guber"
 	"github.com/supergiant/supergiant/common"
 	"github.com/supergiant/supergiant/core/mock"
 )
@@ -231,6 +235,14 @@ func (f *FakeReleaseCollection) List() (*ReleaseList, error) {
 	return f.ListFn()
 }
 
+func (f *FakeReleaseCollection) ListWithOptions(opts *ListOptions) (*ReleaseList, error) {
+	list, err := f.ListFn()
+	if err != nil || opts == nil {
+		return list, err
+	}
+	return list, opts.Apply(list)
+}
+
 func (f *FakeReleaseCollection) New() *ReleaseResource {
 	return f.NewFn()
 }
@@ -258,3 +270,66 @@ func (f *FakeReleaseCollection) Patch(common.ID, *ReleaseResource) error {
 func (f *FakeReleaseCollection) Delete(r *ReleaseResource) error {
 	return f.DeleteFn(r)
 }
+
+func TestComponentRollback(t *testing.T) {
+	Convey("Given a Component with a current Release and two retired ones", t, func() {
+		server := httptest.NewTLSServer(http.NotFoundHandler())
+		defer server.Close()
+
+		core := &Core{db: newDB(newMemoryStore())}
+		core.k8s = guber.NewClient(strings.TrimPrefix(server.URL, "https://"), "u", "p", true)
+
+		storeRelease := func(timestamp string, image string, retired bool) {
+			_, err := core.db.store.create("/releases/test/web/"+timestamp, `{"timestamp":"`+timestamp+`","instance_group":"`+timestamp+`","committed":true,"retired":`+map[bool]string{true: "true", false: "false"}[retired]+`,"instance_count":2,"containers":[{"image":"`+image+`","cpu":{},"ram":{}}],"termination_grace_period":10,"tags":{}}`)
+			So(err, ShouldBeNil)
+		}
+		_, err := core.db.store.create("/apps/test", `{"name":"test","tags":{}}`)
+		So(err, ShouldBeNil)
+		_, err = core.db.store.create("/components/test/web", `{"name":"web","current_release_id":"20160414035456","tags":{}}`)
+		So(err, ShouldBeNil)
+		storeRelease("20160412035456", "nginx:1.9", true)
+		storeRelease("20160413035456", "nginx:1.10", true)
+		storeRelease("20160414035456", "nginx:1.11", false)
+
+		app, err := core.Apps().Get(common.IDString("test"))
+		So(err, ShouldBeNil)
+		component, err := app.Components().Get(common.IDString("web"))
+		So(err, ShouldBeNil)
+
+		Convey("Rollback should deploy a clone of the most recent retired Release by default", func() {
+			release, err := component.Rollback(nil)
+			So(err, ShouldBeNil)
+			So(release.Containers[0].Image, ShouldEqual, "nginx:1.10")
+			So(*release.InstanceGroup, ShouldEqual, *release.Timestamp)
+			So(*release.Rollback.Source, ShouldEqual, "20160413035456")
+			So(*release.Rollback.From, ShouldEqual, "20160414035456")
+
+			target, err := component.TargetRelease()
+			So(err, ShouldBeNil)
+			So(target.Committed, ShouldBeTrue)
+			So(*target.Rollback.Source, ShouldEqual, "20160413035456")
+
+			tasks, err := core.Tasks().List()
+			So(err, ShouldBeNil)
+			So(tasks.Items, ShouldHaveLength, 1)
+		})
+
+		Convey("Rollback should clone the retired Release given", func() {
+			release, err := component.Rollback(common.IDString("20160412035456"))
+			So(err, ShouldBeNil)
+			So(release.Containers[0].Image, ShouldEqual, "nginx:1.9")
+		})
+
+		Convey("Rolling back to a Release that is not retired should conflict", func() {
+			_, err := component.Rollback(common.IDString("20160414035456"))
+			So(ErrorCode(err), ShouldEqual, common.ErrorCodeConflict)
+		})
+
+		Convey("Rolling back while another Release is the target should conflict", func() {
+			_, err := component.Rollback(nil)
+			So(err, ShouldBeNil)
+			_, err = component.Rollback(nil)
+			So(ErrorCode(err), ShouldEqual, common.ErrorCodeConflict)
+		})
+	})
+}
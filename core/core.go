@@ -1,10 +1,18 @@
 package core
 
 import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/supergiant/guber"
+	"github.com/supergiant/supergiant/client"
 	"github.com/supergiant/supergiant/common"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -15,10 +23,17 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/elb"
 	"github.com/aws/aws-sdk-go/service/elb/elbiface"
+	"golang.org/x/net/context"
 )
 
 type Core struct {
+	Store                  string // one of etcd (the default), file, memory
+	StoreFile              string
 	EtcdEndpoints          []string
+	EncryptionKey          string // base64, 32 bytes; encrypts sg:"private" fields in the store
+	EncryptionKeyFile      string // read EncryptionKey from a file instead
+	PreviousEncryptionKeys []string
+	AdminPassword          string // creates (or resets) the admin User on start
 	K8sHost                string
 	K8sUser                string
 	K8sPass                string
@@ -31,11 +46,24 @@ type Core struct {
 	AwsSecretKey           string
 	CapacityServiceEnabled bool
 
-	db          *database
-	k8s         guber.Client
-	ec2         *ec2.EC2
-	elb         elbiface.ELBAPI
-	autoscaling autoscalingiface.AutoScalingAPI
+	// APIHandler is the API router, which the Supervisor calls to deploy. When
+	// nil, it calls the API at http://localhost:8080 instead.
+	APIHandler http.Handler
+
+	db           *database
+	serviceToken string
+	credentials  *credentialCache
+	election     *leaderElection
+	k8s          guber.Client
+	k8sHTTP      *http.Client // for the Kubernetes requests Guber cannot make
+	ec2          *ec2.EC2
+	elb          elbiface.ELBAPI
+	autoscaling  autoscalingiface.AutoScalingAPI
+
+	// NOTE the probes and metrics need no authentication, so what they read
+	// from the store and Kubernetes is cached.
+	readiness   cachedResult
+	taskMetrics cachedResult
 }
 
 var (
@@ -57,8 +85,11 @@ func SetLogLevel(level string) {
 // cli package, I needed to first actually initialize a Core struct and then
 // configure.
 func (c *Core) Initialize() {
-	c.db = newDB(c.EtcdEndpoints)
+	if err := c.Open(); err != nil {
+		panic(err)
+	}
 	c.k8s = guber.NewClient(c.K8sHost, c.K8sUser, c.K8sPass, c.K8sInsecureHTTPS)
+	c.k8sHTTP = newK8sHTTPClient(c.K8sInsecureHTTPS)
 
 	checkForAWSMeta(c)
 	// If you're working with temporary security credentials,
@@ -80,16 +111,216 @@ func (c *Core) Initialize() {
 	c.elb = elb.New(awsSession, awsConf)
 	c.autoscaling = autoscaling.New(awsSession, awsConf)
 
-	// TODO expose as worker num option in main
-	go NewSupervisor(c, 4).Run()
+	// Every replica serves the API, but only the elected leader runs the
+	// background services below.
+	c.election = newLeaderElection(c, c.lead)
+	go c.election.Run()
+}
 
-	if c.CapacityServiceEnabled {
-		go newCapacityService(c).Run()
+// Open opens the store and sets up authentication, which is all the API needs
+// to serve the Resources in the store. Initialize calls it before connecting
+// to Kubernetes and AWS, and starting the background services.
+func (c *Core) Open() error {
+	if err := c.openDB(); err != nil {
+		return err
+	}
+	return c.initializeAuth()
+}
+
+func (c *Core) openDB() error {
+	key := c.EncryptionKey
+	if c.EncryptionKeyFile != "" {
+		var err error
+		if key, err = readKeyFile(c.EncryptionKeyFile); err != nil {
+			return err
+		}
+	}
+	keys, err := newKeyring(key, c.PreviousEncryptionKeys)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		Log.Warn("No encryption key given, private fields (such as ImageRepo keys) are stored unencrypted")
+	}
+
+	s, err := newStore(c)
+	if err != nil {
+		return err
+	}
+	c.db = newDB(s)
+	c.db.keys = keys
+	return nil
+}
+
+// initializeAuth generates the service token, and sets up the admin User if
+// AdminPassword is given.
+func (c *Core) initializeAuth() (err error) {
+	if c.serviceToken, err = randomHex(32); err != nil {
+		return err
+	}
+	if c.credentials, err = newCredentialCache(); err != nil {
+		return err
+	}
+	if c.AdminPassword != "" {
+		return c.ensureAdminUser(c.AdminPassword)
+	}
+	users, err := c.Users().List()
+	if err != nil {
+		return err
+	}
+	if len(users.Items) == 0 {
+		Log.Warn("No Users exist, so no one can use the API; set --admin-password to create the admin User")
+	}
+	return nil
+}
+
+// apiClient returns a Client for the API, authenticated as the Supervisor.
+func (c *Core) apiClient() *client.Client {
+	if c.APIHandler != nil {
+		return client.NewLocal(c.APIHandler, c.serviceToken)
+	}
+	return client.NewWithToken("http://localhost:8080/v0", c.serviceToken, true)
+}
+
+// k8sStream GETs a path of the Kubernetes API, returning the response body as
+// it is read, for responses Guber would read whole (such as followed logs).
+// The request is cancelled when ctx is done.
+func (c *Core) k8sStream(ctx context.Context, path string, query url.Values) (io.ReadCloser, error) {
+	resp, err := c.k8sDo(ctx, "GET", path, query, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// k8sMergePatch applies a JSON merge patch to the object at a path of the
+// Kubernetes API. Unlike Guber's updates, the patch can remove fields, by
+// setting them to nil.
+func (c *Core) k8sMergePatch(ctx context.Context, path string, patch interface{}) error {
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	resp, err := c.k8sDo(ctx, "PATCH", path, nil, "application/merge-patch+json", body)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// k8sCreate POSTs an object to a collection path of the Kubernetes API, for
+// objects with fields Guber does not have.
+func (c *Core) k8sCreate(ctx context.Context, path string, obj interface{}) error {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return err
 	}
+	resp, err := c.k8sDo(ctx, "POST", path, nil, "application/json", body)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// newK8sHTTPClient returns the client k8sDo sends requests with. It is shared
+// by every request, so that connections to Kubernetes are reused.
+func newK8sHTTPClient(insecureHTTPS bool) *http.Client {
+	if !insecureHTTPS {
+		return http.DefaultClient
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+}
+
+// k8sDo sends a request to a path of the Kubernetes API, returning any
+// response other than a 2xx as an error. The request is cancelled when ctx is
+// done.
+func (c *Core) k8sDo(ctx context.Context, method string, path string, query url.Values, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, "https://"+c.K8sHost+"/"+path+"?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.K8sUser, c.K8sPass)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Cancel = ctx.Done()
 
+	resp, err := c.k8sHTTP.Do(req)
+	if err != nil {
+		return nil, upstreamErr("Kubernetes", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		status := new(struct {
+			Message string `json:"message"`
+		})
+		if body, err := ioutil.ReadAll(resp.Body); err == nil && json.Unmarshal(body, status) == nil && status.Message != "" {
+			return nil, upstreamErr("Kubernetes", fmt.Errorf("responded with %s: %s", resp.Status, status.Message))
+		}
+		return nil, upstreamErr("Kubernetes", fmt.Errorf("responded with %s", resp.Status))
+	}
+	return resp, nil
+}
+
+// Migrate upgrades every stored record to the current schema version, printing
+// each record migrated to w. With dryRun, nothing is saved, and the upgraded
+// records are printed instead.
+//
+// NOTE Migrate only needs the store configured, not a call to Initialize.
+func (c *Core) Migrate(w io.Writer, dryRun bool) error {
+	if c.db == nil {
+		if err := c.openDB(); err != nil {
+			return err
+		}
+	}
+	return c.db.migrate(w, dryRun)
+}
+
+// RotateEncryptionKey re-encrypts the private fields of every stored record with
+// EncryptionKey, printing each record re-encrypted to w. The keys they are
+// currently encrypted with must be in PreviousEncryptionKeys.
+//
+// NOTE like Migrate, it only needs the store configured.
+func (c *Core) RotateEncryptionKey(w io.Writer) error {
+	if c.db == nil {
+		if err := c.openDB(); err != nil {
+			return err
+		}
+	}
+	return c.db.reencrypt(w)
+}
+
+// lead starts the services that must only run on a single replica. They are
+// stopped when ctx is cancelled, i.e. when leadership is lost.
+func (c *Core) lead(ctx context.Context) {
 	// TODO
 	if err := c.Nodes().populate(); err != nil {
-		panic(err)
+		Log.Errorf("Error populating Nodes: %s", err)
+	}
+
+	// TODO expose as worker num option in main
+	go NewSupervisor(c, 4).Run(ctx)
+
+	if c.CapacityServiceEnabled {
+		go newCapacityService(c).Run(ctx)
+	}
+}
+
+// IsLeader returns true if this replica is the elected leader, running the
+// Supervisor and capacity service.
+func (c *Core) IsLeader() bool {
+	return c.election != nil && c.election.IsLeader()
+}
+
+// Shutdown gives up leadership (if held), so that another replica can take
+// over right away instead of waiting for the leader key to expire.
+func (c *Core) Shutdown() {
+	if c.election != nil {
+		c.election.Resign()
 	}
 }
 
@@ -115,6 +346,14 @@ func (c *Core) child(key string) (l Locatable) {
 		l = c.Nodes().(Locatable)
 	case "tasks":
 		l = c.Tasks().(Locatable)
+	case "failed_tasks":
+		l = c.FailedTasks().(Locatable)
+	case "audit":
+		l = c.AuditEntries().(Locatable)
+	case "users":
+		l = c.Users().(Locatable)
+	case "tokens":
+		l = c.APITokens().(Locatable)
 	default:
 		panic(fmt.Errorf("No child with key %s for %T", key, c))
 	}
@@ -149,3 +388,19 @@ func (c *Core) Nodes() NodesInterface {
 func (c *Core) Tasks() TasksInterface {
 	return &TaskCollection{c}
 }
+
+func (c *Core) FailedTasks() FailedTasksInterface {
+	return &FailedTaskCollection{c}
+}
+
+func (c *Core) AuditEntries() AuditEntriesInterface {
+	return &AuditEntryCollection{c}
+}
+
+func (c *Core) Users() UsersInterface {
+	return &UserCollection{c}
+}
+
+func (c *Core) APITokens() APITokensInterface {
+	return &APITokenCollection{c}
+}
@@ -7,9 +7,13 @@ import (
 
 	"github.com/supergiant/guber"
 	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
 )
 
-func RunCustomDeployment(core *Core, component *ComponentResource) error {
+// RunCustomDeployment runs the Component's CustomDeployScript in a pod and waits
+// for it to finish. The pod is deleted when it finishes, or when ctx is
+// cancelled.
+func RunCustomDeployment(ctx context.Context, core *Core, component *ComponentResource) error {
 	cd := component.CustomDeployScript
 	name := fmt.Sprintf("supergiant-custom-deploy-%s-%s-%s", common.StringID(component.App().Name), common.StringID(component.Name), *component.TargetReleaseTimestamp)
 	podDef := &guber.Pod{
@@ -44,7 +48,7 @@ func RunCustomDeployment(core *Core, component *ComponentResource) error {
 
 	// Wait for pod to start
 	msg := fmt.Sprintf("%s (pod start)", name)
-	err = common.WaitFor(msg, time.Minute*2, time.Second*5, func() (bool, error) {
+	err = common.WaitFor(ctx, msg, time.Minute*2, time.Second*5, func() (bool, error) {
 		pod, err = pod.Reload()
 		if err != nil {
 			return false, err
@@ -66,7 +70,7 @@ func RunCustomDeployment(core *Core, component *ComponentResource) error {
 
 	var log string
 
-	err = common.WaitFor(name, timeout, time.Second*5, func() (bool, error) {
+	err = common.WaitFor(ctx, name, timeout, time.Second*5, func() (bool, error) {
 		pod, err = pod.Reload()
 		if err != nil {
 			if isKubeNotFoundErr(err) {
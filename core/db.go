@@ -2,47 +2,57 @@ package core
 
 import (
 	"encoding/json"
+	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/imdario/mergo"
 	"github.com/supergiant/supergiant/common"
-
-	etcd "github.com/coreos/etcd/client"
 )
 
+// maxConflictRetries is how many times a read-modify-write is attempted before
+// giving up on a Resource that keeps changing underneath it.
+const maxConflictRetries = 5
+
 type database struct {
-	keys *etcdClient
-}
+	store store
 
-func newDB(etcdEndpoints []string) *database {
-	return &database{newEtcdClient(etcdEndpoints)}
+	// keys encrypts private fields. When nil, they are stored as is.
+	keys *keyring
 }
 
-// TODO this is weird
-func (db *database) setKeysAPI(kapi etcd.KeysAPI) {
-	db.keys.kapi = kapi
+func newDB(s store) *database {
+	return &database{store: s}
 }
 
-func (db *database) list(r Collection, out interface{}) error {
+// list decodes every Resource of a Collection into out, a pointer to a List,
+// and then applies opts (if not nil) to it.
+func (db *database) list(r Collection, out interface{}, opts *ListOptions) error {
 	key := etcdKey(r.(Locatable))
-	resp, err := db.keys.get(key)
-	if err != nil && !isEtcdNotFoundErr(err) {
+	values, err := db.store.list(key)
+	if err != nil && !isNotFoundErr(err) {
 		// When listing, if it's key not found, it just means the dir has not been
 		// created yet (which happens automatically when creating the first child
 		// key). Here we return err ONLY if it's not that error
 		return err
 	}
-	return decodeList(r, resp, out)
+	if err := db.decodeList(r, values, out); err != nil {
+		return err
+	}
+	if opts != nil {
+		return opts.Apply(out)
+	}
+	return nil
 }
 
 func (db *database) get(r Collection, id common.ID, out Resource) error {
 	key := etcdKey(r.(Locatable)) + "/" + common.StringID(id) // TODO
-	resp, err := db.keys.get(key)
+	value, err := db.store.get(key)
 	if err != nil {
 		return err
 	}
-	return unmarshalNodeInto(r, resp.Node, out)
+	return db.unmarshalValueInto(r, value, out)
 }
 
 func (db *database) create(r Collection, id common.ID, m Resource) error {
@@ -56,17 +66,18 @@ func (db *database) create(r Collection, id common.ID, m Resource) error {
 		return err
 	}
 
-	val, err := marshalResource(m)
+	key := etcdKey(m.(Locatable))
+
+	val, err := db.marshalResource(key, m)
 	if err != nil {
 		return err
 	}
 
-	key := etcdKey(m.(Locatable))
-
-	_, err = db.keys.create(key, val)
+	revision, err := db.store.create(key, val)
 	if err != nil {
 		return err
 	}
+	setRevision(m, revision)
 
 	// NOTE on create/update, we must explicitly call decorate() since we do not
 	// unmarshal
@@ -83,17 +94,24 @@ func (db *database) update(r Collection, id common.ID, m Resource) error {
 		return err
 	}
 
-	val, err := marshalResource(m)
+	key := etcdKey(m.(Locatable))
+
+	val, err := db.marshalResource(key, m)
 	if err != nil {
 		return err
 	}
 
-	key := etcdKey(m.(Locatable))
-
-	_, err = db.keys.update(key, val)
+	// NOTE the write is conditional whenever the Resource has a revision, i.e.
+	// when it was loaded from the store, or given with If-Match.
+	prevRevision, err := revisionOf(m)
+	if err != nil {
+		return err
+	}
+	revision, err := db.store.update(key, val, prevRevision)
 	if err != nil {
 		return err
 	}
+	setRevision(m, revision)
 
 	// NOTE on create/update, we must explicitly call decorate() since we do not
 	// unmarshal
@@ -101,59 +119,227 @@ func (db *database) update(r Collection, id common.ID, m Resource) error {
 }
 
 // This works like a typical RESTful PATCH operation, a merge-update
+//
+// If r has a revision, the patch fails if the Resource has changed since.
+// Otherwise, the merge is retried on top of the latest Resource until it is
+// written without conflict.
 func (db *database) patch(c Collection, id common.ID, r Resource) error {
-	oldR := reflect.New(reflect.ValueOf(r).Elem().Type()).Interface().(Resource)
-	if err := db.get(c, id, oldR); err != nil {
+	// NOTE mergo fills in the zero fields of the Resource it merges into, so
+	// every attempt starts from a fresh copy of the changes.
+	changes, err := json.Marshal(r)
+	if err != nil {
 		return err
 	}
+	retry := getFieldValue(r, "Revision").String() == ""
 
-	if err := mergo.Merge(r, oldR); err != nil {
-		return err
+	for attempt := 1; ; attempt++ {
+		oldR := newResourceLike(r)
+		if err := db.get(c, id, oldR); err != nil {
+			return err
+		}
+
+		newR := newResourceLike(r)
+		if err := json.Unmarshal(changes, newR); err != nil {
+			return err
+		}
+		if err := mergo.Merge(newR, oldR); err != nil {
+			return err
+		}
+
+		err := db.update(c, id, newR)
+		if isCompareFailedErr(err) && retry && attempt < maxConflictRetries {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		setResource(c, r, newR)
+		return nil
 	}
+}
 
-	return db.update(c, id, r)
+// retryUpdate applies mutate to r and saves it, re-loading r and applying
+// mutate again whenever r has been changed by another write in the meantime.
+// mutate should check any precondition on r and return an error if it no longer
+// holds.
+func (db *database) retryUpdate(c Collection, id common.ID, r Resource, mutate func() error) error {
+	for attempt := 1; ; attempt++ {
+		if err := mutate(); err != nil {
+			return err
+		}
+
+		err := db.update(c, id, r)
+		if !isCompareFailedErr(err) || attempt == maxConflictRetries {
+			return err
+		}
+
+		latest := newResourceLike(r)
+		if err := db.get(c, id, latest); err != nil {
+			return err
+		}
+		setResource(c, r, latest)
+	}
 }
 
 func (db *database) delete(r Collection, id common.ID) error {
 	key := etcdKey(r.(Locatable)) + "/" + common.StringID(id) // TODO
-	_, err := db.keys.delete(key)
-	return err
+	return db.store.delete(key)
+}
+
+// batch runs fn, which writes many keys directly to the store, as a single
+// batch if the store supports it (see batchStore).
+func (db *database) batch(fn func() error) error {
+	if b, ok := db.store.(batchStore); ok {
+		return b.batch(fn)
+	}
+	return fn()
 }
 
+// watch returns a storeWatcher on the directory of the Collection, which will
+// emit an event for any change to a Resource in the Collection.
+func (db *database) watch(r Collection) storeWatcher {
+	return db.store.watch(etcdKey(r.(Locatable)))
+}
+
+// compareAndSwap saves new only if the stored Resource has not changed since
+// old was loaded.
 func (db *database) compareAndSwap(r Collection, id common.ID, old Resource, new Resource) error {
 	key := etcdKey(old.(Locatable))
 
-	oldVal, err := marshalResource(old)
+	newVal, err := db.marshalResource(key, new)
 	if err != nil {
 		return err
 	}
-	newVal, err := marshalResource(new)
+
+	prevRevision, err := revisionOf(old)
 	if err != nil {
 		return err
 	}
 
-	_, err = db.keys.compareAndSwap(key, oldVal, newVal)
-	return err
+	// NOTE comparing revisions does not depend on old being marshalled exactly
+	// as it is stored (which is not the case for records of an older schema
+	// version). We only compare values if old has no revision.
+	if prevRevision == 0 {
+		if len(privateFieldNames(r.(Locatable).locationKey())) == 0 {
+			oldVal, err := encodeRecord(old)
+			if err != nil {
+				return err
+			}
+			revision, err := db.store.compareAndSwap(key, oldVal, newVal)
+			if err != nil {
+				return err
+			}
+			setRevision(new, revision)
+			return nil
+		}
+
+		// Private fields are encrypted with a random nonce, so the stored value
+		// is decrypted to be compared, and the write is conditional on its
+		// revision instead.
+		value, err := db.store.get(key)
+		if err != nil {
+			return err
+		}
+		stored := newResourceLike(old)
+		if err := db.unmarshalValueInto(r, value, stored); err != nil {
+			return err
+		}
+		storedRecord, err := encodeRecord(stored)
+		if err != nil {
+			return err
+		}
+		oldRecord, err := encodeRecord(old)
+		if err != nil {
+			return err
+		}
+		if storedRecord != oldRecord {
+			return &storeError{storeErrCompareFailed, key}
+		}
+		prevRevision = value.Revision
+	}
+
+	revision, err := db.store.update(key, newVal, prevRevision)
+	if err != nil {
+		return err
+	}
+	setRevision(new, revision)
+	return nil
 }
 
-func marshalResource(m Resource) (string, error) {
-	t := copyWithoutNoStoreFields(m)
+// marshalResource returns the record of a Resource to store at key, with its
+// private fields encrypted.
+func (db *database) marshalResource(key string, m Resource) (string, error) {
+	record, err := encodeRecord(m)
+	if err != nil {
+		return "", err
+	}
+	return db.keys.encryptRecord(key, record)
+}
 
-	out, err := json.Marshal(t)
+// encodeRecord returns the record of a Resource as it is stored, before its
+// private fields are encrypted.
+func encodeRecord(m Resource) (string, error) {
+	out, err := json.Marshal(copyWithoutNoStoreFields(m))
 	if err != nil {
 		return "", err
 	}
-	return string(out), nil
+	return stampSchemaVersion(out), nil
 }
 
-func unmarshalNodeInto(r Collection, node *etcd.Node, m Resource) error {
-	if err := json.Unmarshal([]byte(node.Value), m); err != nil {
+func (db *database) unmarshalValueInto(r Collection, value *storeValue, m Resource) error {
+	collection := r.(Locatable).locationKey()
+
+	// NOTE records of an older schema version are only upgraded in memory here.
+	// They are saved on the next write, or by the migrate command.
+	_, record, err := migrateRecord(collection, value.Value)
+	if err != nil {
+		return err
+	}
+	if record, err = db.keys.decryptRecord(value.Key, record); err != nil {
+		return fmt.Errorf("%s: %s", value.Key, err)
+	}
+	if err := json.Unmarshal([]byte(record), m); err != nil {
 		return err
 	}
+	setRevision(m, value.Revision)
 	r.initializeResource(m)
 	return m.decorate()
 }
 
+func newResourceLike(r Resource) Resource {
+	return reflect.New(reflect.ValueOf(r).Elem().Type()).Interface().(Resource)
+}
+
+// setResource overwrites dst with src, which must be of the same type.
+func setResource(c Collection, dst Resource, src Resource) {
+	reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(src).Elem())
+	// NOTE relations of src point back to src, so we re-initialize them
+	c.initializeResource(dst)
+}
+
+func revisionOf(r Resource) (uint64, error) {
+	revision := getFieldValue(r, "Revision").String()
+	if revision == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(revision, 10, 64)
+}
+
+func setRevision(r Resource, revision uint64) {
+	value := ""
+	if revision != 0 {
+		value = strconv.FormatUint(revision, 10)
+	}
+	getFieldValue(r, "Revision").SetString(value)
+}
+
+// IsConflictErr returns true if the error is from writing a Resource that has
+// been changed since its revision.
+func IsConflictErr(err error) bool {
+	return isCompareFailedErr(err)
+}
+
 // CreateInOrder stuff...
 // Was going to use "base" as a word here, like with file names. But it seems
 // entirely weird to me that people inventing filesystems looked at:
@@ -167,25 +353,14 @@ func lastKeySegment(key string) common.ID {
 	return &segment
 }
 
-func isEtcdNotFoundErr(err error) bool {
-	etcdErr, ok := err.(etcd.Error)
-	return ok && etcdErr.Code == etcd.ErrorCodeKeyNotFound
-}
-
-func decodeList(r Collection, resp *etcd.Response, out interface{}) error {
+func (db *database) decodeList(r Collection, values []*storeValue, out interface{}) error {
 	itemsPtr, itemType := getItemsPtrAndItemType(out)
 
-	// TODO we do this here, because the above method will initialize the Items
-	// slice for us. Needs work.
-	if resp == nil {
-		return nil
-	}
-
-	for _, node := range resp.Node.Nodes {
+	for _, value := range values {
 		// Interface() is called to convert the new item Value into an interface
 		// (that we can unmarshal to. The interface{} is then cast to ResourceList type.
 		obj := reflect.New(itemType).Interface().(Resource)
-		if err := unmarshalNodeInto(r, node, obj); err != nil {
+		if err := db.unmarshalValueInto(r, value, obj); err != nil {
 			return err
 		}
 
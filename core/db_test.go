@@ -0,0 +1,84 @@
+package core
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+func TestDatabaseRevisions(t *testing.T) {
+	Convey("Given an ImageRepo that was loaded twice", t, func() {
+		core := &Core{db: newDB(newMemoryStore())}
+
+		repo := core.ImageRepos().New()
+		repo.Name = common.IDString("test")
+		repo.Key = "secret"
+		So(core.ImageRepos().Create(repo), ShouldBeNil)
+		So(repo.Revision, ShouldNotBeEmpty)
+
+		first, err := core.ImageRepos().Get(repo.Name)
+		So(err, ShouldBeNil)
+		second, err := core.ImageRepos().Get(repo.Name)
+		So(err, ShouldBeNil)
+		So(first.Revision, ShouldEqual, repo.Revision)
+
+		first.Tags["first"] = "yes"
+		So(first.Update(), ShouldBeNil)
+
+		Convey("When the stale copy is updated", func() {
+			second.Key = "changed"
+			err := second.Update()
+
+			Convey("It should fail with a conflict", func() {
+				So(IsConflictErr(err), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the stale copy is patched with its revision", func() {
+			patch := core.ImageRepos().New()
+			patch.Name = repo.Name
+			patch.Key = "changed"
+			patch.Revision = second.Revision
+			err := patch.Patch()
+
+			Convey("It should fail with a conflict", func() {
+				So(IsConflictErr(err), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the stale copy is patched without a revision", func() {
+			patch := core.ImageRepos().New()
+			patch.Name = repo.Name
+			patch.Key = "changed"
+			err := patch.Patch()
+
+			Convey("It should be merged on top of the latest ImageRepo", func() {
+				So(err, ShouldBeNil)
+				So(patch.Revision, ShouldNotEqual, first.Revision)
+
+				latest, err := core.ImageRepos().Get(repo.Name)
+				So(err, ShouldBeNil)
+				So(latest.Key, ShouldEqual, "changed")
+				So(latest.Tags["first"], ShouldEqual, "yes")
+			})
+		})
+
+		Convey("When retryUpdate() is called with the stale copy", func() {
+			attempts := 0
+			err := core.db.retryUpdate(second.collection.(Collection), second.Name, second, func() error {
+				attempts++
+				second.Key = "changed"
+				return nil
+			})
+
+			Convey("It should re-load the ImageRepo and try again", func() {
+				So(err, ShouldBeNil)
+				So(attempts, ShouldEqual, 2)
+				So(second.Key, ShouldEqual, "changed")
+				So(second.Tags["first"], ShouldEqual, "yes")
+			})
+		})
+	})
+}
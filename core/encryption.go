@@ -0,0 +1,349 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+// recordTypes maps the etcd directory of a Collection to the type it stores,
+// so the private fields of its records can be found.
+var recordTypes = map[string]interface{}{
+	"apps":         common.App{},
+	"components":   common.Component{},
+	"releases":     common.Release{},
+	"entrypoints":  common.Entrypoint{},
+	"repos":        common.ImageRepo{},
+	"nodes":        common.Node{},
+	"tasks":        common.Task{},
+	"failed_tasks": common.FailedTask{},
+	"audit":        common.AuditEntry{},
+	"users":        common.User{},
+	"tokens":       common.APIToken{},
+}
+
+var errDecrypt = errors.New("Could not decrypt")
+
+// keyring encrypts the sg:"private" fields of records before they are stored,
+// and decrypts them when they are read.
+//
+// An encrypted field is stored as the string "encrypted:<key id>:<data>", so
+// that records encrypted with a previous key can still be read while keys are
+// being rotated. Fields stored before encryption was enabled are read as is,
+// and encrypted on the next write.
+type keyring struct {
+	current  *encryptionKey // nil when no key is given, and fields are stored as is
+	previous []*encryptionKey
+}
+
+type encryptionKey struct {
+	id  string
+	gcm cipher.AEAD
+}
+
+// newKeyring takes base64-encoded 256-bit keys. current may be empty.
+func newKeyring(current string, previous []string) (*keyring, error) {
+	k := new(keyring)
+	if current != "" {
+		key, err := newEncryptionKey(current)
+		if err != nil {
+			return nil, err
+		}
+		k.current = key
+	}
+	for _, encoded := range previous {
+		key, err := newEncryptionKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("Previous encryption key: %s", err)
+		}
+		k.previous = append(k.previous, key)
+	}
+	return k, nil
+}
+
+func newEncryptionKey(encoded string) (*encryptionKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("Encryption key must be 32 bytes, base64 encoded (e.g. from `openssl rand -base64 32`)")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return &encryptionKey{hex.EncodeToString(sum[:4]), gcm}, nil
+}
+
+// readKeyFile returns the key in a file, for the --encryption-key-file flag.
+func readKeyFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (k *keyring) find(id string) *encryptionKey {
+	if k.current != nil && k.current.id == id {
+		return k.current
+	}
+	for _, key := range k.previous {
+		if key.id == id {
+			return key
+		}
+	}
+	return nil
+}
+
+// encryptRecord encrypts the private fields of the record stored at key with
+// the current key. Without a current key, the record is returned as is.
+func (k *keyring) encryptRecord(key string, record string) (string, error) {
+	if k == nil || k.current == nil {
+		return record, nil
+	}
+	return mapPrivateFields(recordCollection(key), record, func(name string, v interface{}) (interface{}, error) {
+		if str, ok := v.(string); ok && strings.HasPrefix(str, encryptedValuePrefix) {
+			return nil, errors.New("Private field is already encrypted")
+		}
+		sealed, err := sealJSON(k.current.gcm, v, privateFieldAAD(key, name))
+		if err != nil {
+			return nil, err
+		}
+		return encryptedValuePrefix + k.current.id + ":" + sealed, nil
+	})
+}
+
+// decryptRecord reverses encryptRecord, with whichever key the fields were
+// encrypted with.
+func (k *keyring) decryptRecord(key string, record string) (string, error) {
+	return mapPrivateFields(recordCollection(key), record, func(name string, v interface{}) (interface{}, error) {
+		str, ok := v.(string)
+		if !ok || !strings.HasPrefix(str, encryptedValuePrefix) {
+			return v, nil // stored before encryption was enabled
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(str, encryptedValuePrefix), ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid encrypted private field")
+		}
+		var encKey *encryptionKey
+		if k != nil {
+			encKey = k.find(parts[0])
+		}
+		if encKey == nil {
+			return nil, fmt.Errorf("Private field is encrypted with key %s, which was not given; set --encryption-key (or --previous-encryption-key while rotating)", parts[0])
+		}
+
+		out, err := openJSON(encKey.gcm, parts[1], privateFieldAAD(key, name))
+		if err == errDecrypt {
+			return nil, fmt.Errorf("Private field could not be decrypted with key %s", parts[0])
+		}
+		return out, err
+	})
+}
+
+// isEncryptedWithCurrent returns true if every private field of the record
+// stored at key is already encrypted with the current key.
+func (k *keyring) isEncryptedWithCurrent(key string, record string) (bool, error) {
+	current := true
+	_, err := mapPrivateFields(recordCollection(key), record, func(name string, v interface{}) (interface{}, error) {
+		str, _ := v.(string)
+		if !strings.HasPrefix(str, encryptedValuePrefix+k.current.id+":") {
+			current = false
+		}
+		return v, nil
+	})
+	return current, err
+}
+
+// privateFieldAAD returns the additional data a private field is sealed with,
+// which binds its ciphertext to the record key and field, so that it cannot be
+// copied into another record or field and still be decrypted.
+func privateFieldAAD(key string, name string) []byte {
+	return []byte(key + "#" + name)
+}
+
+// reencrypt re-encrypts the private fields of every stored record with the
+// current key, writing a line to w for each one that changes. Records already
+// encrypted with the current key are left as they are.
+func (db *database) reencrypt(w io.Writer) error {
+	if db.keys == nil || db.keys.current == nil {
+		return errors.New("No encryption key given to re-encrypt with; set --encryption-key")
+	}
+
+	values, err := db.store.listAll("")
+	if err != nil && !isNotFoundErr(err) {
+		return err
+	}
+
+	changed, failed := 0, 0
+	err = db.batch(func() error {
+		for _, value := range values {
+			collection := recordCollection(value.Key)
+			if collection == "" || len(privateFieldNames(collection)) == 0 {
+				continue
+			}
+
+			current, err := db.keys.isEncryptedWithCurrent(value.Key, value.Value)
+			if err != nil {
+				return fmt.Errorf("%s: %s", value.Key, err)
+			}
+			if current {
+				continue
+			}
+
+			record, err := db.keys.decryptRecord(value.Key, value.Value)
+			if err != nil {
+				return fmt.Errorf("%s: %s", value.Key, err)
+			}
+			if record, err = db.keys.encryptRecord(value.Key, record); err != nil {
+				return fmt.Errorf("%s: %s", value.Key, err)
+			}
+
+			fmt.Fprintf(w, "%s: encrypted with key %s\n", value.Key, db.keys.current.id)
+
+			// NOTE the write is conditional, so that a record changed meanwhile (and
+			// encrypted with the current key anyway) is not overwritten.
+			if _, err := db.store.update(value.Key, record, value.Revision); err != nil {
+				fmt.Fprintf(w, "  %s\n", err)
+				failed++
+				continue
+			}
+			changed++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%d records re-encrypted with key %s\n", changed, db.keys.current.id)
+	if failed > 0 {
+		return fmt.Errorf("%d records could not be re-encrypted, run again", failed)
+	}
+	return nil
+}
+
+// privateFieldNames returns the JSON names of the sg:"private" fields of the
+// type stored in a Collection.
+func privateFieldNames(collection string) (names []string) {
+	v, ok := recordTypes[collection]
+	if !ok {
+		return nil
+	}
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		isPrivate := false
+		for _, part := range strings.Split(field.Tag.Get("sg"), ",") {
+			if part == "private" {
+				isPrivate = true
+			}
+		}
+		if isPrivate {
+			names = append(names, strings.Split(field.Tag.Get("json"), ",")[0])
+		}
+	}
+	return names
+}
+
+// HasPrivateFields returns true if an API path (e.g. /v0/users/ci) is about a
+// Resource, or Collection of them, with sg:"private" fields, such as passwords.
+// Every segment of the path is checked, so it may be true of other paths too.
+func HasPrivateFields(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if len(privateFieldNames(segment)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// mapPrivateFields replaces every non-null private field of a record with the
+// result of fn, which is given the JSON name of the field and its value.
+func mapPrivateFields(collection string, record string, fn func(string, interface{}) (interface{}, error)) (string, error) {
+	names := privateFieldNames(collection)
+	if len(names) == 0 {
+		return record, nil
+	}
+
+	fields := make(map[string]interface{})
+	decoder := json.NewDecoder(strings.NewReader(record))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return "", err
+	}
+
+	for _, name := range names {
+		if fields[name] == nil {
+			continue
+		}
+		out, err := fn(name, fields[name])
+		if err != nil {
+			return "", err
+		}
+		fields[name] = out
+	}
+
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// sealJSON encrypts the JSON encoding of a value, authenticated together with
+// aad, returning the nonce and ciphertext base64 encoded.
+func sealJSON(gcm cipher.AEAD, v interface{}, aad []byte) (string, error) {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, aad)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openJSON reverses sealJSON. It returns errDecrypt if the value was not
+// encrypted with the key of gcm, or with other aad.
+func openJSON(gcm cipher.AEAD, encoded string, aad []byte) (interface{}, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("Encrypted private field is too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, errDecrypt
+	}
+
+	var out interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(plaintext)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+const (
+	testEncryptionKey    = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	testNewEncryptionKey = "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+)
+
+func newEncryptedCore(s store, current string, previous ...string) *Core {
+	keys, err := newKeyring(current, previous)
+	if err != nil {
+		panic(err)
+	}
+	db := newDB(s)
+	db.keys = keys
+	return &Core{db: db}
+}
+
+func TestEncryption(t *testing.T) {
+	Convey("Given an ImageRepo saved with an encryption key", t, func() {
+		s := newMemoryStore()
+		core := newEncryptedCore(s, testEncryptionKey)
+
+		repo := core.ImageRepos().New()
+		repo.Name = common.IDString("private")
+		repo.Key = "secret-key"
+		So(core.ImageRepos().Create(repo), ShouldBeNil)
+
+		keyID := core.db.keys.current.id
+
+		Convey("The Key should be stored encrypted", func() {
+			val, err := s.get("/repos/dockerhub/private")
+			So(err, ShouldBeNil)
+			So(val.Value, ShouldNotContainSubstring, "secret-key")
+			So(val.Value, ShouldContainSubstring, `"key":"encrypted:`+keyID+`:`)
+		})
+
+		Convey("The Key should be decrypted when loaded", func() {
+			repo, err := core.ImageRepos().Get(common.IDString("private"))
+			So(err, ShouldBeNil)
+			So(repo.Key, ShouldEqual, "secret-key")
+		})
+
+		Convey("Loading it without the key should fail with a clear error", func() {
+			_, err := newEncryptedCore(s, "").ImageRepos().Get(common.IDString("private"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, keyID)
+			So(err.Error(), ShouldContainSubstring, "--encryption-key")
+		})
+
+		Convey("When the key is rotated", func() {
+			rotated := newEncryptedCore(s, testNewEncryptionKey, testEncryptionKey)
+			out := new(bytes.Buffer)
+			So(rotated.db.reencrypt(out), ShouldBeNil)
+			So(out.String(), ShouldContainSubstring, "1 records re-encrypted")
+
+			Convey("It should be readable with only the new key", func() {
+				repo, err := newEncryptedCore(s, testNewEncryptionKey).ImageRepos().Get(common.IDString("private"))
+				So(err, ShouldBeNil)
+				So(repo.Key, ShouldEqual, "secret-key")
+			})
+
+			Convey("Re-encrypting again should leave it as it is", func() {
+				before, err := s.get("/repos/dockerhub/private")
+				So(err, ShouldBeNil)
+
+				out.Reset()
+				So(rotated.db.reencrypt(out), ShouldBeNil)
+				So(out.String(), ShouldContainSubstring, "0 records re-encrypted")
+
+				after, err := s.get("/repos/dockerhub/private")
+				So(err, ShouldBeNil)
+				So(after.Revision, ShouldEqual, before.Revision)
+			})
+		})
+
+		Convey("The Key should not be readable when copied into another record", func() {
+			val, err := s.get("/repos/dockerhub/private")
+			So(err, ShouldBeNil)
+			_, err = s.create("/repos/dockerhub/copy", strings.Replace(val.Value, `"name":"private"`, `"name":"copy"`, 1))
+			So(err, ShouldBeNil)
+
+			_, err = core.ImageRepos().Get(common.IDString("copy"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "could not be decrypted")
+		})
+
+		Convey("Swapping it without a revision should compare the decrypted values", func() {
+			old, err := core.ImageRepos().Get(common.IDString("private"))
+			So(err, ShouldBeNil)
+			old.Revision = ""
+
+			t := *old.ImageRepo
+			t.Key = "new-key"
+			next := &ImageRepoResource{ImageRepo: &t}
+			So(core.db.compareAndSwap(core.ImageRepos().(Collection), old.Name, old, next), ShouldBeNil)
+
+			repo, err := core.ImageRepos().Get(common.IDString("private"))
+			So(err, ShouldBeNil)
+			So(repo.Key, ShouldEqual, "new-key")
+
+			Convey("And fail once the stored value has changed", func() {
+				old.Revision = ""
+				So(isCompareFailedErr(core.db.compareAndSwap(core.ImageRepos().(Collection), old.Name, old, next)), ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given an ImageRepo stored before encryption was enabled", t, func() {
+		s := newMemoryStore()
+		_, err := s.create("/repos/dockerhub/old", `{"name":"old","key":"plain-key","tags":{}}`)
+		So(err, ShouldBeNil)
+		core := newEncryptedCore(s, testEncryptionKey)
+
+		Convey("It should be readable, and encrypted on the next write", func() {
+			repo, err := core.ImageRepos().Get(common.IDString("old"))
+			So(err, ShouldBeNil)
+			So(repo.Key, ShouldEqual, "plain-key")
+
+			So(repo.Update(), ShouldBeNil)
+			val, err := s.get("/repos/dockerhub/old")
+			So(err, ShouldBeNil)
+			So(val.Value, ShouldNotContainSubstring, "plain-key")
+		})
+	})
+
+	Convey("Given an invalid encryption key", t, func() {
+		_, err := newKeyring("too-short", nil)
+
+		Convey("It should be rejected", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestHasPrivateFields(t *testing.T) {
+	Convey("API paths should have private fields by the Collections they name", t, func() {
+		So(HasPrivateFields("/v0/users/ci"), ShouldBeTrue)
+		So(HasPrivateFields("/v0/tokens"), ShouldBeTrue)
+		So(HasPrivateFields("/v0/registries/dockerhub/repos/test"), ShouldBeTrue)
+		So(HasPrivateFields("/v0/apps/test/components/web"), ShouldBeFalse)
+	})
+}
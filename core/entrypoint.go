@@ -13,6 +13,7 @@ import (
 
 type EntrypointsInterface interface {
 	List() (*EntrypointList, error)
+	ListWithOptions(*ListOptions) (*EntrypointList, error)
 	New() *EntrypointResource
 	Create(*EntrypointResource) error
 	Get(common.ID) (*EntrypointResource, error)
@@ -34,7 +35,8 @@ type EntrypointResource struct {
 // NOTE this does not inherit from common like model does; all we need is a List
 // object, internally, that has a slice of our composed model above.
 type EntrypointList struct {
-	Items []*EntrypointResource `json:"items"`
+	Items    []*EntrypointResource `json:"items"`
+	Continue string                `json:"continue,omitempty"`
 }
 
 // initializeResource implements the Collection interface.
@@ -46,8 +48,13 @@ func (c *EntrypointCollection) initializeResource(in Resource) {
 
 // List returns an EntrypointList.
 func (c *EntrypointCollection) List() (*EntrypointList, error) {
+	return c.ListWithOptions(nil)
+}
+
+// ListWithOptions returns an EntrypointList with opts applied (see ListOptions).
+func (c *EntrypointCollection) ListWithOptions(opts *ListOptions) (*EntrypointList, error) {
 	list := new(EntrypointList)
-	err := c.core.db.list(c, list)
+	err := c.core.db.list(c, list, opts)
 	return list, err
 }
 
@@ -72,13 +79,13 @@ func (c *EntrypointCollection) Create(r *EntrypointResource) error {
 	// utilize a Status field
 	address, err := r.createELB()
 	if err != nil {
-		return err
+		return upstreamErr("AWS", err)
 	}
 	if err := r.attachELBToScalingGroups(); err != nil {
-		return err
+		return upstreamErr("AWS", err)
 	}
 	if err := r.configureELBHealthCheck(); err != nil {
-		return err
+		return upstreamErr("AWS", err)
 	}
 
 	r.Address = *address
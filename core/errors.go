@@ -0,0 +1,167 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/go-validator/validator"
+	"github.com/supergiant/guber"
+	"github.com/supergiant/supergiant/common"
+)
+
+// ErrorCode returns the code of an error returned by Core, or
+// common.ErrorCodeInternal for errors that are not about the request (e.g. the store
+// being unreachable).
+func ErrorCode(err error) string {
+	switch err.(type) {
+	case *ValidationError:
+		return common.ErrorCodeValidation
+	case invalidManifestError, invalidArchiveError, unknownContainerError:
+		return common.ErrorCodeInvalidRequest
+	case *PreconditionFailedError:
+		return common.ErrorCodePreconditionFailed
+	case conflictError:
+		return common.ErrorCodeConflict
+	case *UpstreamError, *guber.Error404, awserr.Error:
+		return common.ErrorCodeUpstream
+	}
+
+	switch {
+	case err == ErrUnauthenticated:
+		return common.ErrorCodeUnauthenticated
+	case IsInvalidListOptionsErr(err), err == ErrBadPassphrase:
+		return common.ErrorCodeInvalidRequest
+	case IsNotFoundErr(err), err == ErrInstanceHasNoPod:
+		return common.ErrorCodeNotFound
+	case IsConflictErr(err), isKeyExistsErr(err), err == ErrStoreNotEmpty:
+		return common.ErrorCodeConflict
+	}
+	return common.ErrorCodeInternal
+}
+
+// notFoundError is returned for Resources that are not stored, like
+// Instances, which do not exist.
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+// IsNotFoundErr returns true if the error is from loading a Resource that does
+// not exist.
+func IsNotFoundErr(err error) bool {
+	_, yes := err.(notFoundError)
+	return yes || isNotFoundErr(err)
+}
+
+// conflictError is returned for changes that the state of a Resource does not
+// allow, such as giving a Component a second target Release.
+type conflictError string
+
+func (e conflictError) Error() string {
+	return string(e)
+}
+
+// ValidationError is returned when writing a Resource with invalid fields.
+type ValidationError struct {
+	Fields []*common.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var msgs []string
+	for _, field := range e.Fields {
+		msgs = append(msgs, field.Path+": "+field.Error)
+	}
+	return "Validation failed: " + strings.Join(msgs, "; ")
+}
+
+// validationErrorOf turns the errors of go-validator, keyed by Go field names
+// (e.g. Meta.Tags), into a ValidationError with JSON paths (e.g. tags). Other
+// errors are returned as is.
+func validationErrorOf(v interface{}, err error) error {
+	errs, ok := err.(validator.ErrorMap)
+	if !ok {
+		return err
+	}
+
+	var names []string
+	for name := range errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	verr := new(ValidationError)
+	for _, name := range names {
+		path := jsonPathOf(reflect.TypeOf(v), name)
+		for _, fieldErr := range errs[name] {
+			verr.Fields = append(verr.Fields, &common.FieldError{Path: path, Error: fieldErr.Error()})
+		}
+	}
+	return verr
+}
+
+// jsonPathOf returns the JSON path of a dotted path of Go field names in t.
+// Embedded structs, which JSON flattens, are left out.
+func jsonPathOf(t reflect.Type, name string) string {
+	var path []string
+	for _, segment := range strings.Split(name, ".") {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			path = append(path, segment)
+			continue
+		}
+		field, ok := t.FieldByName(segment)
+		if !ok {
+			path = append(path, segment)
+			continue
+		}
+		t = field.Type
+		if field.Anonymous {
+			continue
+		}
+		jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+		if jsonName == "" {
+			jsonName = field.Name
+		}
+		path = append(path, jsonName)
+	}
+	return strings.Join(path, ".")
+}
+
+// PreconditionFailedError is returned for a write conditional on a revision
+// (If-Match in the API) of a Resource that has changed since.
+type PreconditionFailedError struct {
+	Revision string
+}
+
+func (e *PreconditionFailedError) Error() string {
+	return "Resource has changed since revision " + e.Revision
+}
+
+// UpstreamError is an error from a service Supergiant depends on, such as
+// Kubernetes or AWS, while handling a request.
+type UpstreamError struct {
+	Service string
+	Err     error
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Service, e.Err)
+}
+
+// upstreamErr wraps an error from service as an UpstreamError, keeping nil
+// as is.
+func upstreamErr(service string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*UpstreamError); ok {
+		return err
+	}
+	return &UpstreamError{service, err}
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+func TestErrorCode(t *testing.T) {
+	Convey("Given a Core with an ImageRepo", t, func() {
+		core := &Core{db: newDB(newMemoryStore())}
+		repo := core.ImageRepos().New()
+		repo.Name = common.IDString("test")
+		repo.Key = "key"
+		So(core.ImageRepos().Create(repo), ShouldBeNil)
+
+		Convey("Creating an ImageRepo with a missing field should fail validation with its JSON path", func() {
+			invalid := core.ImageRepos().New()
+			invalid.Name = common.IDString("other")
+			err := core.ImageRepos().Create(invalid)
+
+			So(ErrorCode(err), ShouldEqual, common.ErrorCodeValidation)
+			So(err.(*ValidationError).Fields, ShouldHaveLength, 1)
+			So(err.(*ValidationError).Fields[0].Path, ShouldEqual, "key")
+		})
+
+		Convey("Creating the ImageRepo again should be a conflict", func() {
+			again := core.ImageRepos().New()
+			again.Name = common.IDString("test")
+			again.Key = "key"
+			err := core.ImageRepos().Create(again)
+
+			So(ErrorCode(err), ShouldEqual, common.ErrorCodeConflict)
+		})
+
+		Convey("Getting an ImageRepo that does not exist should be not found", func() {
+			_, err := core.ImageRepos().Get(common.IDString("missing"))
+
+			So(IsNotFoundErr(err), ShouldBeTrue)
+			So(ErrorCode(err), ShouldEqual, common.ErrorCodeNotFound)
+		})
+
+		Convey("Invalid probes of a Release should fail validation with their JSON paths", func() {
+			release := &ReleaseResource{Release: &common.Release{Containers: []*common.ContainerBlueprint{
+				{Image: "nginx", LivenessProbe: &common.Probe{Exec: &common.ExecProbe{Command: []string{"true"}}}},
+				{Image: "redis", ReadinessProbe: &common.Probe{HTTP: &common.HTTPProbe{Port: 0}, TCP: &common.TCPProbe{Port: 6379}}},
+			}}}
+			err := release.validateProbes()
+
+			So(ErrorCode(err), ShouldEqual, common.ErrorCodeValidation)
+			fields := err.(*ValidationError).Fields
+			So(fields, ShouldHaveLength, 2)
+			So(fields[0].Path, ShouldEqual, "containers[1].readiness_probe")
+			So(fields[1].Path, ShouldEqual, "containers[1].readiness_probe.http.port")
+
+			release.Containers = release.Containers[:1]
+			So(release.validateProbes(), ShouldBeNil)
+		})
+
+		Convey("A null container of a Release should fail validation rather than panic", func() {
+			release := &ReleaseResource{Release: &common.Release{Containers: []*common.ContainerBlueprint{nil}}}
+			err := release.validateProbes()
+
+			So(ErrorCode(err), ShouldEqual, common.ErrorCodeValidation)
+			So(err.(*ValidationError).Fields[0].Path, ShouldEqual, "containers[0]")
+		})
+
+		Convey("Errors from Kubernetes or AWS should be upstream errors", func() {
+			So(ErrorCode(upstreamErr("Kubernetes", errors.New("timeout"))), ShouldEqual, common.ErrorCodeUpstream)
+			So(upstreamErr("Kubernetes", nil), ShouldBeNil)
+		})
+
+		Convey("Other errors should be internal", func() {
+			So(ErrorCode(errors.New("etcd is down")), ShouldEqual, common.ErrorCodeInternal)
+		})
+	})
+}
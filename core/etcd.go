@@ -2,12 +2,16 @@ package core
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	etcd "github.com/coreos/etcd/client"
 	"golang.org/x/net/context"
 )
 
-type etcdClient struct {
+// etcdStore is the store backed by the etcd v2 KeysAPI. It is the only store
+// that can be shared by several supergiant-api replicas.
+type etcdStore struct {
 	kapi etcd.KeysAPI
 }
 
@@ -15,48 +19,169 @@ const (
 	baseDir = "/supergiant"
 )
 
-func newEtcdClient(endpoints []string) *etcdClient {
+func newEtcdStore(endpoints []string) *etcdStore {
 	client, err := etcd.New(etcd.Config{Endpoints: endpoints})
 	if err != nil {
 		panic(err)
 	}
-	etcdClient := etcdClient{etcd.NewKeysAPI(client)}
-	etcdClient.createDir(baseDir)
-	return &etcdClient
+	etcdStore := etcdStore{etcd.NewKeysAPI(client)}
+	etcdStore.createDir(baseDir)
+	return &etcdStore
 }
 
 func fullKey(key string) string {
 	return fmt.Sprintf("%s%s", baseDir, key)
 }
 
-func (e *etcdClient) compareAndSwap(key string, prevValue string, value string) (*etcd.Response, error) {
-	return e.kapi.Set(context.Background(), fullKey(key), value, &etcd.SetOptions{PrevValue: prevValue})
+func (e *etcdStore) list(dir string) ([]*storeValue, error) {
+	resp, err := e.kapi.Get(context.Background(), fullKey(dir), &etcd.GetOptions{Sort: true})
+	if err != nil {
+		return nil, etcdStoreErr(err, dir)
+	}
+	var values []*storeValue
+	for _, node := range resp.Node.Nodes {
+		if !node.Dir {
+			values = append(values, etcdStoreValue(node))
+		}
+	}
+	return values, nil
 }
 
-func (e *etcdClient) create(key string, value string) (*etcd.Response, error) {
-	return e.kapi.Create(context.Background(), fullKey(key), value)
+func (e *etcdStore) listAll(dir string) ([]*storeValue, error) {
+	resp, err := e.kapi.Get(context.Background(), fullKey(dir), &etcd.GetOptions{Recursive: true, Sort: true})
+	if err != nil {
+		return nil, etcdStoreErr(err, dir)
+	}
+	var values []*storeValue
+	var walk func(nodes etcd.Nodes)
+	walk = func(nodes etcd.Nodes) {
+		for _, node := range nodes {
+			if node.Dir {
+				walk(node.Nodes)
+			} else {
+				values = append(values, etcdStoreValue(node))
+			}
+		}
+	}
+	walk(resp.Node.Nodes)
+	return values, nil
 }
 
-func (e *etcdClient) get(key string) (*etcd.Response, error) {
-	return e.kapi.Get(context.Background(), fullKey(key), nil)
+func (e *etcdStore) get(key string) (*storeValue, error) {
+	resp, err := e.kapi.Get(context.Background(), fullKey(key), nil)
+	if err != nil {
+		return nil, etcdStoreErr(err, key)
+	}
+	return etcdStoreValue(resp.Node), nil
 }
 
-func (e *etcdClient) update(key string, value string) (*etcd.Response, error) {
-	return e.kapi.Update(context.Background(), fullKey(key), value)
+func (e *etcdStore) create(key string, value string) (uint64, error) {
+	resp, err := e.kapi.Create(context.Background(), fullKey(key), value)
+	return etcdRevision(key, resp, err)
 }
 
-func (e *etcdClient) delete(key string) (*etcd.Response, error) {
-	return e.kapi.Delete(context.Background(), fullKey(key), nil)
+func (e *etcdStore) update(key string, value string, prevRevision uint64) (uint64, error) {
+	if prevRevision == 0 {
+		resp, err := e.kapi.Update(context.Background(), fullKey(key), value)
+		return etcdRevision(key, resp, err)
+	}
+	resp, err := e.kapi.Set(context.Background(), fullKey(key), value, &etcd.SetOptions{PrevExist: etcd.PrevExist, PrevIndex: prevRevision})
+	return etcdRevision(key, resp, err)
 }
 
-// func (e *etcdClient) createInOrder(key string, value string) (*etcd.Response, error) {
+func (e *etcdStore) delete(key string) error {
+	_, err := e.kapi.Delete(context.Background(), fullKey(key), nil)
+	return etcdStoreErr(err, key)
+}
+
+func (e *etcdStore) compareAndSwap(key string, prevValue string, value string) (uint64, error) {
+	resp, err := e.kapi.Set(context.Background(), fullKey(key), value, &etcd.SetOptions{PrevValue: prevValue})
+	return etcdRevision(key, resp, err)
+}
+
+func (e *etcdStore) watch(dir string) storeWatcher {
+	return &etcdWatcher{e.kapi.Watcher(fullKey(dir), &etcd.WatcherOptions{Recursive: true})}
+}
+
+// func (e *etcdStore) createInOrder(key string, value string) (*etcd.Response, error) {
 // 	return e.kapi.CreateInOrder(context.Background(), fullKey(key), value, nil)
 // }
 //
-// func (e *etcdClient) getInOrder(key string) (*etcd.Response, error) {
+// func (e *etcdStore) getInOrder(key string) (*etcd.Response, error) {
 // 	return e.kapi.Get(context.Background(), fullKey(key), &etcd.GetOptions{Sort: true})
 // }
 
-func (e *etcdClient) createDir(key string) (*etcd.Response, error) {
+func (e *etcdStore) createWithTTL(key string, value string, ttl time.Duration) error {
+	_, err := e.kapi.Set(context.Background(), fullKey(key), value, &etcd.SetOptions{PrevExist: etcd.PrevNoExist, TTL: ttl})
+	return etcdStoreErr(err, key)
+}
+
+func (e *etcdStore) refreshTTL(key string, value string, ttl time.Duration) error {
+	_, err := e.kapi.Set(context.Background(), fullKey(key), value, &etcd.SetOptions{PrevValue: value, TTL: ttl})
+	return etcdStoreErr(err, key)
+}
+
+func (e *etcdStore) compareAndDelete(key string, prevValue string) error {
+	_, err := e.kapi.Delete(context.Background(), fullKey(key), &etcd.DeleteOptions{PrevValue: prevValue})
+	return etcdStoreErr(err, key)
+}
+
+func (e *etcdStore) createDir(key string) (*etcd.Response, error) {
 	return e.kapi.Set(context.Background(), key, "", &etcd.SetOptions{Dir: true})
 }
+
+// etcdWatcher skips events on directories, which the other stores do not have.
+type etcdWatcher struct {
+	watcher etcd.Watcher
+}
+
+func (w *etcdWatcher) next(ctx context.Context) (*storeEvent, error) {
+	for {
+		resp, err := w.watcher.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Node == nil || resp.Node.Dir {
+			continue
+		}
+		return &storeEvent{resp.Action, strings.TrimPrefix(resp.Node.Key, baseDir), resp.Node.Value, resp.Node.ModifiedIndex}, nil
+	}
+}
+
+// close does nothing, since an etcd watcher only holds a request while next
+// is waiting.
+func (w *etcdWatcher) close() {}
+
+func etcdStoreValue(node *etcd.Node) *storeValue {
+	return &storeValue{strings.TrimPrefix(node.Key, baseDir), node.Value, node.ModifiedIndex}
+}
+
+// etcdRevision returns the revision of the key written, or the error of the
+// write converted with etcdStoreErr.
+func etcdRevision(key string, resp *etcd.Response, err error) (uint64, error) {
+	if err != nil {
+		return 0, etcdStoreErr(err, key)
+	}
+	if resp.Node == nil {
+		return 0, nil
+	}
+	return resp.Node.ModifiedIndex, nil
+}
+
+// etcdStoreErr converts the etcd errors callers need to tell apart into a
+// storeError.
+func etcdStoreErr(err error, key string) error {
+	etcdErr, ok := err.(etcd.Error)
+	if !ok {
+		return err
+	}
+	switch etcdErr.Code {
+	case etcd.ErrorCodeKeyNotFound:
+		return &storeError{storeErrKeyNotFound, key}
+	case etcd.ErrorCodeNodeExist:
+		return &storeError{storeErrKeyExists, key}
+	case etcd.ErrorCodeTestFailed:
+		return &storeError{storeErrCompareFailed, key}
+	}
+	return err
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+type FailedTasksInterface interface {
+	List() (*FailedTaskList, error)
+	ListWithOptions(*ListOptions) (*FailedTaskList, error)
+	New() *FailedTaskResource
+	Create(*FailedTaskResource) error
+	Get(common.ID) (*FailedTaskResource, error)
+	Delete(*FailedTaskResource) error
+	Retry(*FailedTaskResource) (*TaskResource, error)
+}
+
+type FailedTaskCollection struct {
+	core *Core
+}
+
+type FailedTaskResource struct {
+	core       *Core
+	collection FailedTasksInterface
+	*common.FailedTask
+}
+
+// NOTE this does not inherit from common like model does; all we need is a List
+// object, internally, that has a slice of our composed model above.
+type FailedTaskList struct {
+	Items    []*FailedTaskResource `json:"items"`
+	Continue string                `json:"continue,omitempty"`
+}
+
+// initializeResource implements the Collection interface.
+func (c *FailedTaskCollection) initializeResource(in Resource) {
+	r := in.(*FailedTaskResource)
+	r.collection = c
+	r.core = c.core
+}
+
+// List returns a FailedTaskList.
+func (c *FailedTaskCollection) List() (*FailedTaskList, error) {
+	return c.ListWithOptions(nil)
+}
+
+// ListWithOptions returns a FailedTaskList with opts applied (see ListOptions).
+func (c *FailedTaskCollection) ListWithOptions(opts *ListOptions) (*FailedTaskList, error) {
+	list := new(FailedTaskList)
+	err := c.core.db.list(c, list, opts)
+	return list, err
+}
+
+// New initializes a FailedTask with a pointer to the Collection.
+func (c *FailedTaskCollection) New() *FailedTaskResource {
+	r := &FailedTaskResource{
+		FailedTask: &common.FailedTask{
+			Meta: common.NewMeta(),
+		},
+	}
+	c.initializeResource(r)
+	return r
+}
+
+// Create takes a FailedTask and creates it in etcd.
+func (c *FailedTaskCollection) Create(r *FailedTaskResource) error {
+	return c.core.db.create(c, r.ID, r)
+}
+
+// Get takes an id and returns a FailedTaskResource if it exists.
+func (c *FailedTaskCollection) Get(id common.ID) (*FailedTaskResource, error) {
+	r := c.New()
+	if err := c.core.db.get(c, id, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Delete deletes the FailedTask in etcd.
+func (c *FailedTaskCollection) Delete(r *FailedTaskResource) error {
+	return c.core.db.delete(c, r.ID)
+}
+
+// Retry requeues the Action of the FailedTask as a new Task, and deletes the
+// FailedTask record. It returns an error if a Task for the same Action is
+// already queued or running.
+func (c *FailedTaskCollection) Retry(r *FailedTaskResource) (*TaskResource, error) {
+	action := r.ToAction()
+	task, err := c.core.Tasks().Start(action)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Delete(); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+//------------------------------------------------------------------------------
+
+// Key implements the Locatable interface.
+func (c *FailedTaskCollection) locationKey() string {
+	return "failed_tasks"
+}
+
+// Parent implements the Locatable interface. It returns nil here because Core
+// is the parent, and it is the root, which we exclude from paths.
+func (c *FailedTaskCollection) parent() (l Locatable) {
+	return
+}
+
+// Child implements the Locatable interface.
+func (c *FailedTaskCollection) child(key string) Locatable {
+	task, err := c.Get(common.IDString(key))
+	if err != nil {
+		panic(fmt.Errorf("No child with key %s for %T", key, c))
+	}
+	return task
+}
+
+// Key implements the Locatable interface.
+func (r *FailedTaskResource) locationKey() string {
+	return common.StringID(r.ID)
+}
+
+// Parent implements the Locatable interface.
+func (r *FailedTaskResource) parent() Locatable {
+	return r.collection.(Locatable)
+}
+
+// Child implements the Locatable interface.
+func (r *FailedTaskResource) child(key string) (l Locatable) {
+	switch key {
+	default:
+		panic(fmt.Errorf("No child with key %s for %T", key, r))
+	}
+}
+
+// Action implements the Resource interface.
+func (r *FailedTaskResource) Action(name string) *Action {
+	switch name {
+	default:
+		panic(fmt.Errorf("No action %s for FailedTask", name))
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// decorate implements the Resource interface
+func (r *FailedTaskResource) decorate() (err error) {
+	return
+}
+
+// ToAction returns the Action that originated the failed Task.
+func (r *FailedTaskResource) ToAction() *Action {
+	task := &TaskResource{
+		core: r.core,
+		Task: &common.Task{ActionData: r.ActionData},
+	}
+	return task.ToAction()
+}
+
+// Delete deletes the FailedTask in etcd.
+func (r *FailedTaskResource) Delete() error {
+	return r.collection.Delete(r)
+}
+
+// Retry is a proxy method to collection Retry.
+func (r *FailedTaskResource) Retry() (*TaskResource, error) {
+	return r.collection.Retry(r)
+}
+
+// newFailedTaskID returns a unique ID for the failure of the given Task, so
+// that the same Action can fail (and be recorded) more than once.
+func newFailedTaskID(task *TaskResource) common.ID {
+	return common.IDString(fmt.Sprintf("%s-%d", common.StringID(task.ID), time.Now().UnixNano()))
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// fileStore is an embedded store that keeps everything in a single JSON file,
+// for small installs that do not want to run etcd. All data is held in memory,
+// and the whole file is rewritten (atomically, by renaming a temp file) on
+// every write, or once per batch (see batchStore).
+//
+// NOTE every write therefore costs O(n) in the size of the whole store, which
+// is fine for the few hundred records of a small install, but not beyond that;
+// larger installs should use etcd.
+//
+// NOTE the file must only be opened by a single supergiant-api process, which
+// is why fileStore does not implement leaseStore.
+type fileStore struct {
+	*memoryStore
+	path string
+
+	// batches is the number of batches running, during which saving is put off
+	// until the last one ends. dirty is set if anything was written meanwhile.
+	// Both are guarded by the lock of memoryStore.
+	batches int
+	dirty   bool
+}
+
+// fileStoreData is the format of the file.
+type fileStoreData struct {
+	Index uint64                 `json:"index"`
+	Keys  map[string]*storeValue `json:"keys"`
+}
+
+func newFileStore(path string) (*fileStore, error) {
+	s := &fileStore{memoryStore: newMemoryStore(), path: path}
+
+	body, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(body) > 0 {
+		data := fileStoreData{Keys: s.data}
+		if err := json.Unmarshal(body, &data); err != nil {
+			return nil, err
+		}
+		s.index = data.Index
+	}
+
+	s.onWrite = s.saveUnlessBatching
+	return s, nil
+}
+
+// batch runs fn, saving the file once after all of its writes instead of after
+// each of them. Writes made by others while fn runs are saved with it.
+//
+// NOTE unlike a single write, a batch cannot be rolled back if saving fails, so
+// its writes are kept in memory and saved with the next successful write.
+func (s *fileStore) batch(fn func() error) error {
+	s.mu.Lock()
+	s.batches++
+	s.mu.Unlock()
+
+	fnErr := fn()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches--
+	if s.batches > 0 || !s.dirty {
+		return fnErr
+	}
+	if err := s.save(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return fnErr
+}
+
+// saveUnlessBatching must be called with the lock held.
+func (s *fileStore) saveUnlessBatching() error {
+	if s.batches > 0 {
+		s.dirty = true
+		return nil
+	}
+	if err := s.save(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+func (s *fileStore) save() error {
+	body, err := json.Marshal(&fileStoreData{s.index, s.data})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
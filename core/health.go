@@ -0,0 +1,106 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/supergiant/guber"
+)
+
+// readinessTimeout is how long CheckReadiness waits for each service.
+var readinessTimeout = 5 * time.Second
+
+// readinessCacheTTL is how long the result of CheckReadiness is reused.
+var readinessCacheTTL = 5 * time.Second
+
+// CheckReadiness checks the services this replica cannot serve the API without
+// (the store, and the Kubernetes API), returning the error of each by name,
+// which is nil when it is reachable. The result is reused for
+// readinessCacheTTL, and concurrent calls wait for the same check, so probes
+// cannot load either service. The returned map must not be modified.
+func (c *Core) CheckReadiness() map[string]error {
+	errs, _ := c.readiness.get(readinessCacheTTL, func() (interface{}, error) {
+		return c.checkReadiness(), nil
+	})
+	return errs.(map[string]error)
+}
+
+func (c *Core) checkReadiness() map[string]error {
+	checks := map[string]func() error{
+		"store":      c.checkStore,
+		"kubernetes": c.checkKubernetes,
+	}
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(checks))
+	for name, check := range checks {
+		go func(name string, check func() error) {
+			results <- result{name, check()}
+		}(name, check)
+	}
+
+	errs := make(map[string]error)
+	timeout := time.After(readinessTimeout)
+	for len(errs) < len(checks) {
+		select {
+		case r := <-results:
+			errs[r.name] = r.err
+		case <-timeout:
+			for name := range checks {
+				if _, done := errs[name]; !done {
+					errs[name] = errors.New("Timed out")
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func (c *Core) checkStore() error {
+	if c.db == nil {
+		return errors.New("Not initialized")
+	}
+	// NOTE any key will do; the leader key is just one that is always read.
+	_, err := c.db.store.get(leaderKey)
+	if isNotFoundErr(err) {
+		return nil
+	}
+	return err
+}
+
+func (c *Core) checkKubernetes() error {
+	if c.k8s == nil {
+		return errors.New("Not initialized")
+	}
+	_, err := c.k8s.Namespaces().Get("default")
+	if _, notFound := err.(*guber.Error404); notFound {
+		return nil
+	}
+	return err
+}
+
+// cachedResult holds the result of a function for a while. The zero value is
+// empty.
+type cachedResult struct {
+	mu      sync.Mutex
+	expires time.Time
+	value   interface{}
+	err     error
+}
+
+// get returns the result of the last call to fn if it is not older than ttl,
+// or calls fn again. Calls made while fn runs wait for its result.
+func (c *cachedResult) get(ttl time.Duration, fn func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.expires) {
+		return c.value, c.err
+	}
+	c.value, c.err = fn()
+	c.expires = time.Now().Add(ttl)
+	return c.value, c.err
+}
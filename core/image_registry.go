@@ -8,6 +8,7 @@ import (
 
 type ImageRegistriesInterface interface {
 	List() (*ImageRegistryList, error)
+	ListWithOptions(*ListOptions) (*ImageRegistryList, error)
 	New() *ImageRegistryResource
 	Create(*ImageRegistryResource) error
 	Get(common.ID) (*ImageRegistryResource, error)
@@ -32,7 +33,8 @@ type ImageRegistryResource struct {
 // NOTE this does not inherit from common like model does; all we need is a List
 // object, internally, that has a slice of our composed model above.
 type ImageRegistryList struct {
-	Items []*ImageRegistryResource `json:"items"`
+	Items    []*ImageRegistryResource `json:"items"`
+	Continue string                   `json:"continue,omitempty"`
 }
 
 // initializeResource implements the Collection interface.
@@ -48,8 +50,13 @@ func (c *ImageRegistryCollection) initializeResource(in Resource) {
 
 // List returns an ImageRegistryList.
 func (c *ImageRegistryCollection) List() (*ImageRegistryList, error) {
+	return c.ListWithOptions(nil)
+}
+
+// ListWithOptions returns an ImageRegistryList with opts applied (see ListOptions).
+func (c *ImageRegistryCollection) ListWithOptions(opts *ListOptions) (*ImageRegistryList, error) {
 	list := new(ImageRegistryList)
-	err := c.core.db.list(c, list)
+	err := c.core.db.list(c, list, opts)
 	return list, err
 }
 
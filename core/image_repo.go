@@ -8,6 +8,7 @@ import (
 
 type ImageReposInterface interface {
 	List() (*ImageRepoList, error)
+	ListWithOptions(*ListOptions) (*ImageRepoList, error)
 	New() *ImageRepoResource
 	Create(*ImageRepoResource) error
 	Get(common.ID) (*ImageRepoResource, error)
@@ -30,7 +31,8 @@ type ImageRepoResource struct {
 // NOTE this does not inherit from common like model does; all we need is a List
 // object, internally, that has a slice of our composed model above.
 type ImageRepoList struct {
-	Items []*ImageRepoResource `json:"items"`
+	Items    []*ImageRepoResource `json:"items"`
+	Continue string               `json:"continue,omitempty"`
 }
 
 // initializeResource implements the Collection interface.
@@ -42,8 +44,13 @@ func (c *ImageRepoCollection) initializeResource(in Resource) {
 
 // List returns an ImageRepoList.
 func (c *ImageRepoCollection) List() (*ImageRepoList, error) {
+	return c.ListWithOptions(nil)
+}
+
+// ListWithOptions returns an ImageRepoList with opts applied (see ListOptions).
+func (c *ImageRepoCollection) ListWithOptions(opts *ListOptions) (*ImageRepoList, error) {
 	list := new(ImageRepoList)
-	err := c.core.db.list(c, list)
+	err := c.core.db.list(c, list, opts)
 	return list, err
 }
 
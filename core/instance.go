@@ -1,22 +1,28 @@
 package core
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	"path"
 	"strconv"
 	"time"
 
 	"github.com/supergiant/guber"
 	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
 )
 
 type InstancesInterface interface {
 	// Release() *ReleaseResource
 
 	List() *InstanceList
+	ListWithOptions(*ListOptions) (*InstanceList, error)
 	New(common.ID) *InstanceResource
 	Get(common.ID) (*InstanceResource, error)
-	Start(Resource) error
-	Stop(Resource) error
+	Start(context.Context, Resource) error
+	Stop(context.Context, Resource) error
 }
 
 type InstanceCollection struct {
@@ -31,7 +37,8 @@ type InstanceResource struct {
 }
 
 type InstanceList struct {
-	Items []*InstanceResource `json:"items"`
+	Items    []*InstanceResource `json:"items"`
+	Continue string              `json:"continue,omitempty"`
 }
 
 func (c *InstanceCollection) app() *AppResource {
@@ -53,6 +60,15 @@ func (c *InstanceCollection) List() *InstanceList {
 	return list
 }
 
+// ListWithOptions returns an InstanceList with opts applied (see ListOptions).
+func (c *InstanceCollection) ListWithOptions(opts *ListOptions) (*InstanceList, error) {
+	list := c.List()
+	if opts == nil {
+		return list, nil
+	}
+	return list, opts.Apply(list)
+}
+
 // New initializes an Instance with a pointer to the Collection.
 func (c *InstanceCollection) New(id common.ID) *InstanceResource {
 	r := &InstanceResource{
@@ -77,35 +93,35 @@ func (c *InstanceCollection) New(id common.ID) *InstanceResource {
 func (c *InstanceCollection) Get(id common.ID) (*InstanceResource, error) {
 	index, err := strconv.Atoi(common.StringID(id))
 	if err != nil {
-		return nil, err
+		return nil, notFoundError(fmt.Sprintf("Instance ID %s is not a number", common.StringID(id)))
 	}
 	maxIndex := c.release.InstanceCount - 1
 	if index < 0 || index > maxIndex {
-		return nil, fmt.Errorf("%d for Instance ID is out of range; Highest ID is %d", index, maxIndex)
+		return nil, notFoundError(fmt.Sprintf("%d for Instance ID is out of range; Highest ID is %d", index, maxIndex))
 	}
 	return c.New(id), nil
 }
 
-func (c *InstanceCollection) Start(ri Resource) error {
+func (c *InstanceCollection) Start(ctx context.Context, ri Resource) error {
 	r := ri.(*InstanceResource)
 
-	if err := r.prepareVolumes(); err != nil {
+	if err := r.prepareVolumes(ctx); err != nil {
 		return err
 	}
-	if err := r.provisionReplicationController(); err != nil {
+	if err := r.provisionReplicationController(ctx); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (c *InstanceCollection) Stop(ri Resource) error {
+func (c *InstanceCollection) Stop(ctx context.Context, ri Resource) error {
 	r := ri.(*InstanceResource)
 
 	if err := r.deleteReplicationControllerAndPod(); err != nil {
 		return err
 	}
 	for _, vol := range r.Volumes() {
-		if err := vol.waitForAvailable(); err != nil {
+		if err := vol.waitForAvailable(ctx); err != nil {
 			return err
 		}
 	}
@@ -182,7 +198,13 @@ func (r *InstanceResource) decorate() error {
 		return err
 	}
 
-	if pod != nil && pod.IsReady() {
+	if pod != nil && pod.Status != nil {
+		for _, status := range pod.Status.ContainerStatuses {
+			r.Restarts += status.RestartCount
+		}
+	}
+
+	if pod != nil && isKubePodReady(pod) {
 		r.Status = common.InstanceStatusStarted
 	} else {
 		r.Status = common.InstanceStatusStopped
@@ -244,7 +266,7 @@ func (r *InstanceResource) Delete() (err error) {
 	if err = r.deleteReplicationControllerAndPod(); err != nil {
 		return err
 	}
-	if err = r.DeleteVolumes(); err != nil {
+	if err = r.DeleteVolumes(context.Background()); err != nil {
 		return err
 	}
 	return nil
@@ -253,25 +275,90 @@ func (r *InstanceResource) Delete() (err error) {
 // The following 2 are only diff from Provision() and Delete() in that they do
 // not delete the create or delete the volumes.
 func (r *InstanceResource) Start() error {
-	return r.collection.Start(r)
+	return r.collection.Start(context.Background(), r)
 }
 
 func (r *InstanceResource) Stop() error {
-	return r.collection.Stop(r)
+	return r.collection.Stop(context.Background(), r)
+}
+
+// LogOptions select the part of an Instance log that Log reads.
+type LogOptions struct {
+	Container  string        // the name of a container of the Release; the first one when empty
+	Tail       int           // only this many lines from the end; 0 for all
+	Since      time.Duration // only lines newer than this; 0 for all
+	Previous   bool          // of the run of the container before it last restarted
+	Follow     bool          // keep reading lines as they are written
+	Timestamps bool          // start each line with an RFC 3339 timestamp
 }
 
-func (r *InstanceResource) Log() (string, error) {
+// ErrInstanceHasNoPod is returned by Log for an Instance that is not started.
+var ErrInstanceHasNoPod = errors.New("Instance has no pod")
+
+// unknownContainerError is returned by Log for a LogOptions.Container that
+// is not in the Release.
+type unknownContainerError string
+
+func (e unknownContainerError) Error() string {
+	return string(e)
+}
+
+// IsUnknownContainerErr returns true if Log was asked for a container the
+// Release does not have.
+func IsUnknownContainerErr(err error) bool {
+	_, yes := err.(unknownContainerError)
+	return yes
+}
+
+// Log returns a reader of the log of a container of the Instance, which the
+// caller must close. With Follow, reading only ends when the container stops,
+// or ctx is done.
+func (r *InstanceResource) Log(ctx context.Context, opts *LogOptions) (io.ReadCloser, error) {
+	containers := r.Release().Containers
+	if len(containers) == 0 {
+		return nil, unknownContainerError("Release has no containers")
+	}
+
+	// TODO we need a better way of initializing defaults on sub-resources
+	containerName := asKubeContainer(containers[0], r).Name
+	if opts.Container != "" {
+		containerName = ""
+		for _, blueprint := range containers {
+			if name := asKubeContainer(blueprint, r).Name; name == opts.Container {
+				containerName = name
+			}
+		}
+		if containerName == "" {
+			return nil, unknownContainerError(fmt.Sprintf("Release has no container named %s", opts.Container))
+		}
+	}
+
 	pod, err := r.pod()
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if pod == nil {
+		return nil, ErrInstanceHasNoPod
 	}
 
-	// TODO nil pointer possibility if pod is nil
-
-	// TODO we need a better way of initializing defaults on sub-resources
-	containerName := asKubeContainer(r.Release().Containers[0], r).Name
+	query := url.Values{"container": {containerName}}
+	if opts.Tail > 0 {
+		query.Set("tailLines", strconv.Itoa(opts.Tail))
+	}
+	if opts.Since > 0 {
+		// Kubernetes only takes whole seconds; round up, to not miss lines.
+		query.Set("sinceSeconds", strconv.FormatInt(int64((opts.Since+time.Second-1)/time.Second), 10))
+	}
+	for param, set := range map[string]bool{"previous": opts.Previous, "follow": opts.Follow, "timestamps": opts.Timestamps} {
+		if set {
+			query.Set(param, "true")
+		}
+	}
 
-	return pod.Log(containerName)
+	// NOTE Guber reads the whole response of a log request, so it cannot follow
+	// one.
+	logPath := path.Join("api/v1/namespaces", common.StringID(r.App().Name), "pods", pod.Metadata.Name, "log")
+	return r.core.k8sStream(ctx, logPath, query)
 }
 
 func (r *InstanceResource) Release() *ReleaseResource {
@@ -290,7 +377,7 @@ func (r *InstanceResource) Volumes() (vols []*AwsVolume) {
 	return vols
 }
 
-func (r *InstanceResource) prepareVolumes() error {
+func (r *InstanceResource) prepareVolumes(ctx context.Context) error {
 	//resize volumes (concurrently) if needed
 	c := make(chan error)
 	// really, we should be resizing all or none. this is just so we don't wait
@@ -300,7 +387,7 @@ func (r *InstanceResource) prepareVolumes() error {
 		if vol.needsResize() {
 			volsResizing++
 			go func(vol *AwsVolume) {
-				c <- vol.resize()
+				c <- vol.resize(ctx)
 			}(vol)
 		}
 	}
@@ -323,7 +410,7 @@ func (r *InstanceResource) kubeVolumes() (vols []*guber.Volume, err error) {
 	return vols, nil
 }
 
-func (r *InstanceResource) kubeContainers() (containers []*guber.Container) {
+func (r *InstanceResource) kubeContainers() (containers []*kubeContainer) {
 	for _, blueprint := range r.Release().Containers {
 		containers = append(containers, asKubeContainer(blueprint, r))
 	}
@@ -334,22 +421,19 @@ func (r *InstanceResource) replicationController() (*guber.ReplicationController
 	return r.collection.core.k8s.ReplicationControllers(common.StringID(r.App().Name)).Get(r.Name)
 }
 
-func (r *InstanceResource) waitForReplicationControllerReady() error {
+func (r *InstanceResource) waitForReplicationControllerReady(ctx context.Context) error {
 	Log.Infof("Waiting for ReplicationController %s to start", r.Name)
-	start := time.Now()
-	maxWait := 5 * time.Minute
-	for elapsed := time.Since(start); elapsed < maxWait; {
+	desc := fmt.Sprintf("RC '%s' to start", r.Name)
+	return common.WaitFor(ctx, desc, 5*time.Minute, time.Second, func() (bool, error) {
 		rc, err := r.replicationController()
 		if err != nil {
-			return err
-		} else if rc.Status.Replicas == 1 { // TODO this may not assert pod running
-			return nil
+			return false, err
 		}
-	}
-	return fmt.Errorf("Timed out waiting for RC '%s' to start", r.Name)
+		return rc.Status.Replicas == 1, nil // TODO this may not assert pod running
+	})
 }
 
-func (r *InstanceResource) provisionReplicationController() error {
+func (r *InstanceResource) provisionReplicationController(ctx context.Context) error {
 	if _, err := r.replicationController(); err == nil {
 		return nil // already provisioned
 	} else if !isKubeNotFoundErr(err) {
@@ -367,37 +451,41 @@ func (r *InstanceResource) provisionReplicationController() error {
 		return err
 	}
 
-	rc := &guber.ReplicationController{
+	rc := &kubeReplicationController{
 		Metadata: &guber.Metadata{
 			Name: r.Name,
 		},
-		Spec: &guber.ReplicationControllerSpec{
+		Spec: &kubeReplicationControllerSpec{
 			Selector: map[string]string{
 				"instance": r.Name,
 			},
 			Replicas: 1,
-			Template: &guber.PodTemplate{
+			Template: &kubePodTemplate{
 				Metadata: &guber.Metadata{
 					Name: r.Name, // pod base name is same as RC
 					Labels: map[string]string{
-						"service":  common.StringID(r.Component().Name), // for Service
-						"instance": r.Name,                              // for RC (above)
+						"service":          common.StringID(r.Component().Name),        // for Service
+						"instance":         r.Name,                                     // for RC (above)
+						instanceGroupLabel: common.StringID(r.Release().InstanceGroup), // for blue-green Service switches
 					},
 				},
-				Spec: &guber.PodSpec{
-					Volumes:                       kubeVolumes,
-					Containers:                    r.kubeContainers(),
-					ImagePullSecrets:              imagePullSecrets,
-					TerminationGracePeriodSeconds: r.Release().TerminationGracePeriod,
+				Spec: &kubePodSpec{
+					PodSpec: &guber.PodSpec{
+						Volumes:                       kubeVolumes,
+						ImagePullSecrets:              imagePullSecrets,
+						TerminationGracePeriodSeconds: r.Release().TerminationGracePeriod,
+					},
+					Containers: r.kubeContainers(),
 				},
 			},
 		},
 	}
 	Log.Infof("Creating ReplicationController %s", r.Name)
-	if _, err = r.collection.core.k8s.ReplicationControllers(common.StringID(r.App().Name)).Create(rc); err != nil {
+	rcsPath := path.Join("api/v1/namespaces", common.StringID(r.App().Name), "replicationcontrollers")
+	if err = r.collection.core.k8sCreate(ctx, rcsPath, rc); err != nil {
 		return err
 	}
-	return r.waitForReplicationControllerReady()
+	return r.waitForReplicationControllerReady(ctx)
 }
 
 func (r *InstanceResource) pod() (*guber.Pod, error) {
@@ -406,7 +494,7 @@ func (r *InstanceResource) pod() (*guber.Pod, error) {
 	}
 	pods, err := r.collection.core.k8s.Pods(common.StringID(r.App().Name)).Query(q)
 	if err != nil {
-		return nil, err // Not sure what the error might be here
+		return nil, upstreamErr("Kubernetes", err)
 	}
 
 	if len(pods.Items) == 1 {
@@ -438,9 +526,9 @@ func (r *InstanceResource) deleteReplicationControllerAndPod() error {
 }
 
 // exposed for use in deploy_component.go
-func (r *InstanceResource) DeleteVolumes() error {
+func (r *InstanceResource) DeleteVolumes(ctx context.Context) error {
 	for _, vol := range r.Volumes() {
-		if err := vol.Delete(); err != nil { // NOTE this should not be a "not found" error -- since Volumes() will naturally do an existence check
+		if err := vol.Delete(ctx); err != nil { // NOTE this should not be a "not found" error -- since Volumes() will naturally do an existence check
 			return err
 		}
 	}
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/guber"
+	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
+)
+
+func TestInstanceLog(t *testing.T) {
+	Convey("Given an Instance with a pod on Kubernetes", t, func() {
+		var logPath string
+		var logQuery url.Values
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/api/v1/namespaces/test/pods":
+				w.Write([]byte(`{"items":[{"metadata":{"name":"web-0-x1y2z"},"status":{"phase":"Pending"}}]}`))
+			case strings.HasSuffix(r.URL.Path, "/log"):
+				logPath, logQuery = r.URL.Path, r.URL.Query()
+				w.Write([]byte("one\ntwo\n"))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer server.Close()
+
+		host := strings.TrimPrefix(server.URL, "https://")
+		core := &Core{db: newDB(newMemoryStore()), K8sHost: host, K8sUser: "u", K8sPass: "p", k8sHTTP: newK8sHTTPClient(true)}
+		core.k8s = guber.NewClient(host, "u", "p", true)
+
+		app := core.Apps().New()
+		app.Name = common.IDString("test")
+		component := app.Components().New()
+		component.Name = common.IDString("web")
+		release := component.Releases().New()
+		release.InstanceGroup = common.IDString("20160412035456")
+		release.InstanceCount = 1
+		release.Containers = []*common.ContainerBlueprint{{Image: "nginx"}, {Name: "sidecar", Image: "busybox"}}
+		instance, err := release.Instances().Get(common.IDString("0"))
+		So(err, ShouldBeNil)
+
+		Convey("Log should read the first container by default", func() {
+			stream, err := instance.Log(context.Background(), &LogOptions{})
+			So(err, ShouldBeNil)
+			defer stream.Close()
+
+			log, err := ioutil.ReadAll(stream)
+			So(err, ShouldBeNil)
+			So(string(log), ShouldEqual, "one\ntwo\n")
+			So(logPath, ShouldEqual, "/api/v1/namespaces/test/pods/web-0-x1y2z/log")
+			So(logQuery.Encode(), ShouldEqual, "container=nginx")
+		})
+
+		Convey("Log should pass on the options", func() {
+			stream, err := instance.Log(context.Background(), &LogOptions{
+				Container: "sidecar",
+				Tail:      20,
+				Since:     90500 * time.Millisecond,
+				Previous:  true,
+				Follow:    true,
+			})
+			So(err, ShouldBeNil)
+			stream.Close()
+
+			So(logQuery.Get("container"), ShouldEqual, "sidecar")
+			So(logQuery.Get("tailLines"), ShouldEqual, "20")
+			So(logQuery.Get("sinceSeconds"), ShouldEqual, "91")
+			So(logQuery.Get("previous"), ShouldEqual, "true")
+			So(logQuery.Get("follow"), ShouldEqual, "true")
+			So(logQuery.Get("timestamps"), ShouldBeEmpty)
+		})
+
+		Convey("Log should reject a container the Release does not have", func() {
+			_, err := instance.Log(context.Background(), &LogOptions{Container: "db"})
+			So(IsUnknownContainerErr(err), ShouldBeTrue)
+		})
+	})
+}
+
+func TestInstanceProbes(t *testing.T) {
+	Convey("Given an Instance of a Release with a readiness probe", t, func() {
+		var rcBody []byte
+		containerReady := false
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/api/v1/namespaces/test/replicationcontrollers" && r.Method == "POST":
+				rcBody, _ = ioutil.ReadAll(r.Body)
+				w.Write(rcBody)
+			case r.URL.Path == "/api/v1/namespaces/test/replicationcontrollers/web-00" && rcBody != nil:
+				w.Write([]byte(`{"metadata":{"name":"web-00"},"spec":{"replicas":1},"status":{"replicas":1}}`))
+			case r.URL.Path == "/api/v1/namespaces/test/pods":
+				w.Write([]byte(`{"items":[{"metadata":{"name":"web-00-x1y2z"},"status":{"conditions":[{"type":"Ready","status":"True"}],"containerStatuses":[{"ready":` + fmt.Sprint(containerReady) + `}]}}]}`))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer server.Close()
+
+		host := strings.TrimPrefix(server.URL, "https://")
+		core := &Core{db: newDB(newMemoryStore()), K8sHost: host, K8sUser: "u", K8sPass: "p", k8sHTTP: newK8sHTTPClient(true)}
+		core.k8s = guber.NewClient(host, "u", "p", true)
+
+		app := core.Apps().New()
+		app.Name = common.IDString("test")
+		component := app.Components().New()
+		component.Name = common.IDString("web")
+		release := component.Releases().New()
+		release.InstanceGroup = common.IDString("0")
+		release.InstanceCount = 1
+		release.Containers = []*common.ContainerBlueprint{{
+			Image: "nginx",
+			ReadinessProbe: &common.Probe{
+				HTTP:             &common.HTTPProbe{Path: "/health", Port: 80},
+				Period:           5,
+				FailureThreshold: 2,
+			},
+		}}
+
+		Convey("Starting the Instance should create its ReplicationController with the probe", func() {
+			instance, err := release.Instances().Get(common.IDString("0"))
+			So(err, ShouldBeNil)
+			So(release.Instances().Start(context.Background(), instance), ShouldBeNil)
+
+			rc := new(struct {
+				Spec struct {
+					Template struct {
+						Spec struct {
+							Containers []map[string]interface{} `json:"containers"`
+						} `json:"spec"`
+					} `json:"template"`
+				} `json:"spec"`
+			})
+			So(json.Unmarshal(rcBody, rc), ShouldBeNil)
+			So(rc.Spec.Template.Spec.Containers, ShouldHaveLength, 1)
+			So(rc.Spec.Template.Spec.Containers[0]["image"], ShouldEqual, "nginx")
+			So(rc.Spec.Template.Spec.Containers[0], ShouldNotContainKey, "livenessProbe")
+			So(rc.Spec.Template.Spec.Containers[0]["readinessProbe"], ShouldResemble, map[string]interface{}{
+				"httpGet":          map[string]interface{}{"path": "/health", "port": float64(80)},
+				"periodSeconds":    float64(5),
+				"failureThreshold": float64(2),
+			})
+		})
+
+		Convey("The Instance should only be started once all of its containers are ready", func() {
+			instance, err := release.Instances().Get(common.IDString("0"))
+			So(err, ShouldBeNil)
+			So(instance.Status, ShouldEqual, common.InstanceStatusStopped)
+
+			containerReady = true
+			instance, err = release.Instances().Get(common.IDString("0"))
+			So(err, ShouldBeNil)
+			So(instance.Status, ShouldEqual, common.InstanceStatusStarted)
+		})
+	})
+}
@@ -18,6 +18,79 @@ func isKubeNotFoundErr(err error) bool {
 	return yes
 }
 
+// The following are Kubernetes objects with fields Guber does not have (the
+// probes of containers), created with Core.k8sCreate.
+
+type kubeReplicationController struct {
+	Metadata *guber.Metadata                `json:"metadata"`
+	Spec     *kubeReplicationControllerSpec `json:"spec"`
+}
+
+type kubeReplicationControllerSpec struct {
+	Selector map[string]string `json:"selector"`
+	Replicas int               `json:"replicas"`
+	Template *kubePodTemplate  `json:"template"`
+}
+
+type kubePodTemplate struct {
+	Metadata *guber.Metadata `json:"metadata"`
+	Spec     *kubePodSpec    `json:"spec"`
+}
+
+// NOTE Containers hides the field of guber.PodSpec in JSON.
+type kubePodSpec struct {
+	*guber.PodSpec
+	Containers []*kubeContainer `json:"containers"`
+}
+
+type kubeContainer struct {
+	*guber.Container
+	LivenessProbe  *kubeProbe `json:"livenessProbe,omitempty"`
+	ReadinessProbe *kubeProbe `json:"readinessProbe,omitempty"`
+}
+
+type kubeProbe struct {
+	HTTPGet             *kubeHTTPGetAction   `json:"httpGet,omitempty"`
+	TCPSocket           *kubeTCPSocketAction `json:"tcpSocket,omitempty"`
+	Exec                *kubeExecAction      `json:"exec,omitempty"`
+	InitialDelaySeconds int                  `json:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int                  `json:"periodSeconds,omitempty"`
+	TimeoutSeconds      int                  `json:"timeoutSeconds,omitempty"`
+	SuccessThreshold    int                  `json:"successThreshold,omitempty"`
+	FailureThreshold    int                  `json:"failureThreshold,omitempty"`
+}
+
+type kubeHTTPGetAction struct {
+	Path string `json:"path,omitempty"`
+	Port int    `json:"port"`
+}
+
+type kubeTCPSocketAction struct {
+	Port int `json:"port"`
+}
+
+type kubeExecAction struct {
+	Command []string `json:"command"`
+}
+
+// isKubePodReady returns true once the pod is Ready, and each of its
+// containers is, which with a readiness probe is once the probe passes.
+func isKubePodReady(pod *guber.Pod) bool {
+	if pod.Status == nil {
+		return false
+	}
+	ready := false
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == "Ready" {
+			ready = cond.Status == "True"
+		}
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		ready = ready && status.Ready
+	}
+	return ready
+}
+
 func kubeVolumeMounts(m *common.ContainerBlueprint) (volMounts []*guber.VolumeMount) {
 	for _, mount := range m.Mounts {
 		volMounts = append(volMounts, asKubeVolumeMount(mount))
@@ -43,7 +116,7 @@ func ImageRepoName(m *common.ContainerBlueprint) string {
 	return strings.Split(m.Image, "/")[0]
 }
 
-func asKubeContainer(m *common.ContainerBlueprint, instance *InstanceResource) *guber.Container { // NOTE how instance must be passed here
+func asKubeContainer(m *common.ContainerBlueprint, instance *InstanceResource) *kubeContainer { // NOTE how instance must be passed here
 	// TODO
 	resources := &guber.Resources{
 		Requests: new(guber.ResourceValues),
@@ -94,7 +167,33 @@ func asKubeContainer(m *common.ContainerBlueprint, instance *InstanceResource) *
 		container.Command = m.Command
 	}
 
-	return container
+	return &kubeContainer{
+		Container:      container,
+		LivenessProbe:  asKubeProbe(m.LivenessProbe),
+		ReadinessProbe: asKubeProbe(m.ReadinessProbe),
+	}
+}
+
+func asKubeProbe(m *common.Probe) *kubeProbe {
+	if m == nil {
+		return nil
+	}
+	probe := &kubeProbe{
+		InitialDelaySeconds: m.InitialDelay,
+		PeriodSeconds:       m.Period,
+		TimeoutSeconds:      m.Timeout,
+		SuccessThreshold:    m.SuccessThreshold,
+		FailureThreshold:    m.FailureThreshold,
+	}
+	switch {
+	case m.HTTP != nil:
+		probe.HTTPGet = &kubeHTTPGetAction{Path: m.HTTP.Path, Port: m.HTTP.Port}
+	case m.TCP != nil:
+		probe.TCPSocket = &kubeTCPSocketAction{Port: m.TCP.Port}
+	case m.Exec != nil:
+		probe.Exec = &kubeExecAction{Command: m.Exec.Command}
+	}
+	return probe
 }
 
 // EnvVar
@@ -0,0 +1,193 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	leaderKey = "/leader"
+)
+
+const (
+	// defaultLeaderTTL is how long the leader key outlives a leader that
+	// stopped refreshing it (e.g. because it died). The leader refreshes the key
+	// every third of the TTL.
+	defaultLeaderTTL = 15 * time.Second
+)
+
+// leaderElection elects a single leader among all supergiant-api replicas
+// sharing an etcd cluster, by having each replica attempt to create the same
+// TTL key. Whoever creates it is the leader until it stops refreshing the key.
+//
+// Stores that cannot be shared between replicas (see leaseStore) need no
+// election, so the replica is simply always the leader.
+//
+// lead is called in its own goroutine every time this replica is elected, so
+// that it can never delay refreshing the leader key. The context passed to it
+// is cancelled when leadership is lost or given up, and everything started
+// from lead must stop when that happens.
+type leaderElection struct {
+	core  *Core
+	lease leaseStore // nil if the store is not shared
+	id    string
+	lead  func(ctx context.Context)
+
+	// ttl is the TTL of the leader key, see defaultLeaderTTL.
+	ttl time.Duration
+
+	mu       sync.Mutex
+	isLeader bool
+
+	resign chan struct{}
+	done   chan struct{}
+}
+
+func newLeaderElection(c *Core, lead func(ctx context.Context)) *leaderElection {
+	hostname, _ := os.Hostname()
+	lease, _ := c.db.store.(leaseStore)
+	return &leaderElection{
+		core:   c,
+		lease:  lease,
+		id:     fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano()),
+		lead:   lead,
+		ttl:    defaultLeaderTTL,
+		resign: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Run campaigns for leadership until Resign is called.
+func (e *leaderElection) Run() {
+	defer close(e.done)
+	for {
+		select {
+		case <-e.resign:
+			return
+		default:
+		}
+
+		if e.acquire() {
+			e.hold()
+			continue
+		}
+
+		e.waitForVacancy()
+	}
+}
+
+// Resign gives up leadership, if held, and stops campaigning. It deletes the
+// leader key so that another replica can take over without waiting for the
+// TTL to expire.
+func (e *leaderElection) Resign() {
+	close(e.resign)
+	<-e.done
+}
+
+// IsLeader returns true if this replica currently holds leadership.
+func (e *leaderElection) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.isLeader
+}
+
+func (e *leaderElection) setLeader(isLeader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.isLeader = isLeader
+}
+
+func (e *leaderElection) acquire() bool {
+	if e.lease == nil {
+		return true
+	}
+	if err := e.lease.createWithTTL(leaderKey, e.id, e.ttl); err != nil {
+		if !isKeyExistsErr(err) {
+			Log.Errorf("Leader election error: %s", err)
+		}
+		return false
+	}
+	return true
+}
+
+// hold runs lead and refreshes the leader key until either a refresh fails or
+// Resign is called.
+func (e *leaderElection) hold() {
+	Log.Infof("Elected leader as %s", e.id)
+	e.setLeader(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// NOTE refresh stays nil, blocking forever, when there is no lease.
+	var refresh <-chan time.Time
+	if e.lease != nil {
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
+	go e.lead(ctx)
+
+	for {
+		select {
+		case <-e.resign:
+			e.setLeader(false)
+			cancel()
+			if e.lease != nil {
+				if err := e.lease.compareAndDelete(leaderKey, e.id); err != nil {
+					Log.Errorf("Leader election error when resigning: %s", err)
+				}
+			}
+			Log.Info("Resigned leadership")
+			return
+
+		case <-refresh:
+			if err := e.lease.refreshTTL(leaderKey, e.id, e.ttl); err != nil {
+				// NOTE we cannot tell whether another replica took over or etcd is
+				// unreachable, so either way we stop acting as leader.
+				e.setLeader(false)
+				Log.Errorf("Lost leadership: %s", err)
+				return
+			}
+		}
+	}
+}
+
+// waitForVacancy blocks until the leader key is deleted or expires, Resign is
+// called, or the TTL has passed (in case the watch missed the vacancy).
+func (e *leaderElection) waitForVacancy() {
+	ctx, cancel := context.WithTimeout(context.Background(), e.ttl)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-e.resign:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	watcher := e.core.db.store.watch(leaderKey)
+	defer watcher.close()
+	for {
+		event, err := watcher.next(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				// NOTE we wait out the TTL here so that we don't spin while etcd is
+				// unreachable.
+				Log.Errorf("Leader election error when watching: %s", err)
+				<-ctx.Done()
+			}
+			return // timed out or resigned; try again either way
+		}
+		switch event.Action {
+		case "delete", "compareAndDelete", "expire":
+			return
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/supergiant/supergiant/core/mock"
+	"golang.org/x/net/context"
+)
+
+// fakeLeaderKey mimics the leader key in etcd, which can only be created if it
+// does not exist yet.
+type fakeLeaderKey struct {
+	sync.Mutex
+	holder string
+}
+
+func (k *fakeLeaderKey) set(key string, val string) error {
+	k.Lock()
+	defer k.Unlock()
+	if k.holder != "" && k.holder != val {
+		return etcd.Error{Code: etcd.ErrorCodeNodeExist}
+	}
+	k.holder = val
+	return nil
+}
+
+func (k *fakeLeaderKey) delete(key string) error {
+	k.Lock()
+	defer k.Unlock()
+	k.holder = ""
+	return nil
+}
+
+func TestLeaderElection(t *testing.T) {
+	Convey("Given a leader election with a vacant leader key", t, func() {
+		leaderKey := new(fakeLeaderKey)
+		watcher := mock.NewFakeWatcher()
+		fakeEtcd := new(mock.FakeEtcd).ReturnOnWatcher(watcher).OnSet(leaderKey.set).OnDelete(leaderKey.delete)
+		core := newMockCore(fakeEtcd)
+
+		leading := make(chan context.Context, 1)
+		e := newLeaderElection(core, func(ctx context.Context) {
+			leading <- ctx
+		})
+		e.ttl = time.Hour // only the watch should trigger a new campaign
+
+		Convey("When Run() is called", func() {
+			go e.Run()
+
+			var ctx context.Context
+			select {
+			case ctx = <-leading:
+			case <-time.After(time.Second):
+			}
+
+			Convey("The replica should be elected and start leading", func() {
+				So(ctx, ShouldNotBeNil)
+				So(e.IsLeader(), ShouldBeTrue)
+			})
+
+			Convey("When Resign() is called", func() {
+				e.Resign()
+
+				Convey("The leader key should be deleted and leading stopped", func() {
+					So(leaderKey.holder, ShouldEqual, "")
+					So(ctx.Err(), ShouldNotBeNil)
+					So(e.IsLeader(), ShouldBeFalse)
+				})
+			})
+		})
+
+		Convey("When another replica holds the leader key", func() {
+			leaderKey.holder = "other"
+
+			watching := make(chan struct{}, 1)
+			fakeEtcd.WatcherFn = func(key string) etcd.Watcher {
+				select {
+				case watching <- struct{}{}:
+				default:
+				}
+				return watcher
+			}
+
+			go e.Run()
+
+			// wait for the failed campaign before changing the leader key
+			select {
+			case <-watching:
+			case <-time.After(time.Second):
+			}
+
+			Convey("The replica should not lead", func() {
+				So(len(leading), ShouldEqual, 0)
+				So(e.IsLeader(), ShouldBeFalse)
+			})
+
+			Convey("When the leader key expires", func() {
+				leaderKey.delete("/supergiant/leader")
+				watcher.Emit("expire", "/supergiant/leader", "")
+
+				Convey("The replica should take over", func() {
+					var ctx context.Context
+					select {
+					case ctx = <-leading:
+					case <-time.After(time.Second):
+					}
+					So(ctx, ShouldNotBeNil)
+					So(e.IsLeader(), ShouldBeTrue)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,339 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+// ListOptions filters, sorts, and pages the Items of any List (AppList,
+// TaskList, etc.), given to the ListWithOptions method of a Collection. When a
+// page is cut short by Limit, the Continue field of the List is set to the
+// token for the next page.
+type ListOptions struct {
+	Selector []*TagRequirement
+
+	// Where, if set, is called with every Item (a Resource) before sorting and
+	// paging, and only the Items it returns true for are listed. It is for
+	// filters that are not about tags, such as what the requesting Principal
+	// can view.
+	Where func(Resource) bool
+
+	// Sort is one of created, updated, or name (the default), optionally
+	// prefixed with - for descending order. Ties are broken by name, in the same
+	// direction.
+	Sort string
+
+	// Limit is the maximum number of Items on a page, or 0 for all of them.
+	Limit int
+
+	// Continue is the token returned with the previous page.
+	Continue string
+}
+
+// TagRequirement is a single term of a tag selector, e.g. env!=dev.
+type TagRequirement struct {
+	Key   string
+	Op    string // one of =, !=, exists, !exists
+	Value string
+}
+
+// listCursor is encoded as the Continue token. It holds the position of the
+// last Item on the page.
+type listCursor struct {
+	Sort string `json:"sort"`
+	Key  string `json:"key"`
+	ID   string `json:"id"`
+}
+
+type listItem struct {
+	value reflect.Value
+	key   string // the value sorted on
+	id    string
+}
+
+// invalidListOptionsError is returned for options that cannot be parsed or
+// applied, such as a continue token from another sort.
+type invalidListOptionsError string
+
+func (e invalidListOptionsError) Error() string {
+	return string(e)
+}
+
+var errInvalidContinue = invalidListOptionsError("Invalid continue token")
+
+// ParseListOptions parses the tags, sort, limit, and continue query params of
+// a List request. Any of them may be empty.
+func ParseListOptions(tags string, sortBy string, limit string, cont string) (*ListOptions, error) {
+	opts := &ListOptions{Sort: sortBy, Continue: cont}
+
+	if opts.Sort == "" {
+		opts.Sort = "name"
+	}
+	switch strings.TrimPrefix(opts.Sort, "-") {
+	case "name", "created", "updated":
+	default:
+		return nil, invalidListOptionsError(fmt.Sprintf("Invalid sort %s, must be one of created, updated, or name, with an optional - prefix", sortBy))
+	}
+
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return nil, invalidListOptionsError(fmt.Sprintf("Invalid limit %s", limit))
+		}
+		opts.Limit = n
+	}
+
+	selector, err := ParseTagSelector(tags)
+	if err != nil {
+		return nil, err
+	}
+	opts.Selector = selector
+
+	return opts, nil
+}
+
+// ParseTagSelector parses a comma-separated list of requirements, each one of
+// key=value (or key==value), key!=value, key (the tag exists), or !key (the
+// tag does not exist).
+func ParseTagSelector(selector string) (reqs []*TagRequirement, err error) {
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		req := new(TagRequirement)
+		switch {
+		case strings.Contains(term, "!="):
+			parts := strings.SplitN(term, "!=", 2)
+			req.Key, req.Op, req.Value = parts[0], "!=", parts[1]
+		case strings.Contains(term, "=="):
+			parts := strings.SplitN(term, "==", 2)
+			req.Key, req.Op, req.Value = parts[0], "=", parts[1]
+		case strings.Contains(term, "="):
+			parts := strings.SplitN(term, "=", 2)
+			req.Key, req.Op, req.Value = parts[0], "=", parts[1]
+		case strings.HasPrefix(term, "!"):
+			req.Key, req.Op = term[1:], "!exists"
+		default:
+			req.Key, req.Op = term, "exists"
+		}
+
+		req.Key = strings.TrimSpace(req.Key)
+		req.Value = strings.TrimSpace(req.Value)
+		if req.Key == "" {
+			return nil, invalidListOptionsError(fmt.Sprintf("Invalid tag selector term %s", term))
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+func (req *TagRequirement) matches(tags common.Tags) bool {
+	value, ok := tags[req.Key]
+	switch req.Op {
+	case "=":
+		return ok && value == req.Value
+	case "!=":
+		return !ok || value != req.Value
+	case "exists":
+		return ok
+	default: // !exists
+		return !ok
+	}
+}
+
+// Apply filters, sorts, and pages the Items of list, which must be a pointer
+// to a List. It returns an error if the Continue token is not valid.
+func (opts *ListOptions) Apply(list interface{}) error {
+	listValue := reflect.ValueOf(list)
+	if listValue.Kind() != reflect.Ptr || listValue.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Cannot apply ListOptions to %T, which is not a pointer to a List", list)
+	}
+	itemsField := listValue.Elem().FieldByName("Items")
+	if !itemsField.IsValid() || itemsField.Kind() != reflect.Slice {
+		return fmt.Errorf("Cannot apply ListOptions to %T, which has no Items", list)
+	}
+
+	descending := strings.HasPrefix(opts.Sort, "-")
+	sortField := strings.TrimPrefix(opts.Sort, "-")
+
+	var items []*listItem
+	for i := 0; i < itemsField.Len(); i++ {
+		value := itemsField.Index(i)
+		meta := listItemMeta(value)
+
+		var tags common.Tags
+		if meta != nil {
+			tags = meta.Tags
+		}
+		if !matchesAll(opts.Selector, tags) {
+			continue
+		}
+		if opts.Where != nil {
+			if resource, ok := value.Interface().(Resource); ok && !opts.Where(resource) {
+				continue
+			}
+		}
+
+		item := &listItem{value: value, id: value.Interface().(Locatable).locationKey()}
+		switch sortField {
+		case "name":
+			item.key = item.id
+		case "created":
+			if meta != nil {
+				item.key = timestampSortKey(meta.Created)
+			}
+		case "updated":
+			if meta != nil {
+				item.key = timestampSortKey(meta.Updated)
+			}
+		}
+		items = append(items, item)
+	}
+
+	sort.Stable(listItemsSorter{items, descending})
+
+	if opts.Continue != "" {
+		cursor, err := decodeListCursor(opts.Continue)
+		if err != nil || cursor.Sort != opts.Sort {
+			return errInvalidContinue
+		}
+		start := len(items)
+		for i, item := range items {
+			if isAfterCursor(item, cursor, descending) {
+				start = i
+				break
+			}
+		}
+		items = items[start:]
+	}
+
+	next := ""
+	if opts.Limit > 0 && len(items) > opts.Limit {
+		items = items[:opts.Limit]
+		last := items[len(items)-1]
+		next = encodeListCursor(&listCursor{opts.Sort, last.key, last.id})
+	}
+
+	out := reflect.MakeSlice(itemsField.Type(), 0, len(items))
+	for _, item := range items {
+		out = reflect.Append(out, item.value)
+	}
+	itemsField.Set(out)
+
+	if continueField := reflect.ValueOf(list).Elem().FieldByName("Continue"); continueField.IsValid() {
+		continueField.SetString(next)
+	}
+	return nil
+}
+
+// IsInvalidListOptionsErr returns true if ListOptions could not be parsed or
+// applied because of the options themselves.
+func IsInvalidListOptionsErr(err error) bool {
+	_, yes := err.(invalidListOptionsError)
+	return yes
+}
+
+func matchesAll(reqs []*TagRequirement, tags common.Tags) bool {
+	for _, req := range reqs {
+		if !req.matches(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+// listItemMeta returns the Meta of a List Item (a pointer to a Resource), or
+// nil if it has none.
+func listItemMeta(item reflect.Value) *common.Meta {
+	elem := item.Elem()
+	field, ok := elem.Type().FieldByName("Meta")
+	if !ok {
+		return nil
+	}
+	// NOTE Meta is reached through embedded pointers (e.g. *common.App), any of
+	// which may be nil, so the path is walked one field at a time.
+	value := elem
+	for _, i := range field.Index {
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return nil
+			}
+			value = value.Elem()
+		}
+		value = value.Field(i)
+	}
+	meta, _ := value.Interface().(*common.Meta)
+	return meta
+}
+
+// timestampSortKey returns a string that sorts in the same order as the
+// Timestamp, with missing Timestamps first.
+func timestampSortKey(t *common.Timestamp) string {
+	if t == nil {
+		return ""
+	}
+	return fmt.Sprintf("%020d", t.UnixNano())
+}
+
+type listItemsSorter struct {
+	items      []*listItem
+	descending bool
+}
+
+func (s listItemsSorter) Len() int {
+	return len(s.items)
+}
+
+func (s listItemsSorter) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+}
+
+func (s listItemsSorter) Less(i, j int) bool {
+	a, b := s.items[i], s.items[j]
+	if s.descending {
+		a, b = b, a
+	}
+	if a.key != b.key {
+		return a.key < b.key
+	}
+	return a.id < b.id
+}
+
+func isAfterCursor(item *listItem, cursor *listCursor, descending bool) bool {
+	if item.key != cursor.Key {
+		return (item.key > cursor.Key) != descending
+	}
+	if item.id == cursor.ID {
+		return false
+	}
+	return (item.id > cursor.ID) != descending
+}
+
+func encodeListCursor(cursor *listCursor) string {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeListCursor(token string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	cursor := new(listCursor)
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
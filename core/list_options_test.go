@@ -0,0 +1,145 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+func newTestAppList() *AppList {
+	base := time.Date(2016, 4, 12, 0, 0, 0, 0, time.UTC)
+	app := func(name string, created int, tags common.Tags) *AppResource {
+		return &AppResource{
+			App: &common.App{
+				Name: common.IDString(name),
+				Meta: &common.Meta{
+					Created: &common.Timestamp{Time: base.Add(time.Duration(created) * time.Hour)},
+					Tags:    tags,
+				},
+			},
+		}
+	}
+	return &AppList{
+		Items: []*AppResource{
+			app("search", 3, common.Tags{"team": "search", "env": "prod"}),
+			app("billing", 1, common.Tags{"team": "billing", "env": "prod"}),
+			app("search-dev", 2, common.Tags{"team": "search", "env": "dev"}),
+			app("scratch", 4, common.Tags{}),
+		},
+	}
+}
+
+func appNames(list *AppList) (names []string) {
+	for _, app := range list.Items {
+		names = append(names, common.StringID(app.Name))
+	}
+	return names
+}
+
+func TestListOptions(t *testing.T) {
+	Convey("Given a list of Apps", t, func() {
+		list := newTestAppList()
+
+		apply := func(tags, sort, limit, cont string) error {
+			opts, err := ParseListOptions(tags, sort, limit, cont)
+			if err != nil {
+				return err
+			}
+			return opts.Apply(list)
+		}
+
+		Convey("With no options, it should be sorted by name", func() {
+			So(apply("", "", "", ""), ShouldBeNil)
+			So(appNames(list), ShouldResemble, []string{"billing", "scratch", "search", "search-dev"})
+			So(list.Continue, ShouldBeEmpty)
+		})
+
+		Convey("A tag selector should filter it", func() {
+			So(apply("team=search,env!=dev", "", "", ""), ShouldBeNil)
+			So(appNames(list), ShouldResemble, []string{"search"})
+		})
+
+		Convey("A tag selector should match on the existence of tags", func() {
+			So(apply("!team", "", "", ""), ShouldBeNil)
+			So(appNames(list), ShouldResemble, []string{"scratch"})
+		})
+
+		Convey("It should be sorted by descending created", func() {
+			So(apply("", "-created", "", ""), ShouldBeNil)
+			So(appNames(list), ShouldResemble, []string{"scratch", "search", "search-dev", "billing"})
+		})
+
+		Convey("It should be paged with limit and continue", func() {
+			So(apply("env", "-created", "1", ""), ShouldBeNil)
+			So(appNames(list), ShouldResemble, []string{"search"})
+			So(list.Continue, ShouldNotBeEmpty)
+
+			cont := list.Continue
+			list = newTestAppList()
+			So(apply("env", "-created", "1", cont), ShouldBeNil)
+			So(appNames(list), ShouldResemble, []string{"search-dev"})
+
+			cont = list.Continue
+			list = newTestAppList()
+			So(apply("env", "-created", "1", cont), ShouldBeNil)
+			So(appNames(list), ShouldResemble, []string{"billing"})
+			So(list.Continue, ShouldBeEmpty)
+		})
+
+		Convey("A continue token should only be valid with the same sort", func() {
+			So(apply("", "name", "1", ""), ShouldBeNil)
+			cont := list.Continue
+
+			err := apply("", "created", "1", cont)
+			So(IsInvalidListOptionsErr(err), ShouldBeTrue)
+		})
+
+		Convey("Invalid options should be rejected", func() {
+			for _, err := range []error{
+				apply("", "size", "", ""),
+				apply("", "", "-1", ""),
+				apply("=x", "", "", ""),
+			} {
+				So(IsInvalidListOptionsErr(err), ShouldBeTrue)
+			}
+		})
+
+		Convey("Where should filter it before paging", func() {
+			opts := &ListOptions{Sort: "name", Limit: 1, Where: func(item Resource) bool {
+				return item.(*AppResource).Tags["env"] == "prod"
+			}}
+			So(opts.Apply(list), ShouldBeNil)
+			So(appNames(list), ShouldResemble, []string{"billing"})
+			So(list.Continue, ShouldNotBeEmpty)
+		})
+
+		Convey("Items without Meta should be listed", func() {
+			list.Items[0].Meta = nil
+			So(apply("", "-created", "", ""), ShouldBeNil)
+			So(appNames(list), ShouldResemble, []string{"scratch", "search-dev", "billing", "search"})
+		})
+
+		Convey("Applying it to something that is not a List should fail", func() {
+			So((&ListOptions{Sort: "name"}).Apply(&struct{}{}), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a Collection with Apps in it", t, func() {
+		core := &Core{db: newDB(newMemoryStore())}
+		for _, app := range newTestAppList().Items {
+			So(core.db.create(core.Apps().(Collection), app.Name, app), ShouldBeNil)
+		}
+
+		Convey("ListWithOptions should filter, sort, and page it", func() {
+			opts, err := ParseListOptions("env=prod", "-name", "1", "")
+			So(err, ShouldBeNil)
+			list, err := core.Apps().ListWithOptions(opts)
+			So(err, ShouldBeNil)
+			So(appNames(list), ShouldResemble, []string{"search"})
+			So(list.Continue, ShouldNotBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,391 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/go-validator/validator"
+	"github.com/imdario/mergo"
+	"github.com/supergiant/supergiant/common"
+)
+
+// invalidManifestError is returned by ApplyManifest for a Manifest that cannot
+// be applied as written.
+type invalidManifestError string
+
+func (e invalidManifestError) Error() string {
+	return string(e)
+}
+
+// IsInvalidManifestErr returns true if ApplyManifest rejected the Manifest
+// itself.
+func IsInvalidManifestErr(err error) bool {
+	_, yes := err.(invalidManifestError)
+	return yes
+}
+
+// manifestReleaseFields are the fields of a Release blueprint that are
+// compared, to tell if a Component needs a new Release.
+var manifestReleaseFields = []string{"instance_count", "volumes", "containers", "termination_grace_period"}
+
+// manifestStep is a change needed to apply a Manifest, and the function that
+// makes it.
+type manifestStep struct {
+	change *common.ManifestChange
+	apply  func() error
+}
+
+type manifestPlan struct {
+	steps []*manifestStep
+}
+
+func (p *manifestPlan) add(action string, kind string, location string, fields []string, apply func() error) {
+	change := &common.ManifestChange{
+		Action:   action,
+		Kind:     kind,
+		Location: location,
+		Fields:   fields,
+	}
+	p.steps = append(p.steps, &manifestStep{change, apply})
+}
+
+// ApplyManifest makes the App of a Manifest, and the Resources it uses, match
+// it, changing only what differs: missing Resources are created, changed
+// fields are updated, and each Component whose Release blueprint differs from
+// its current Release gets a new Release (merge-created from the current one)
+// and is deployed. Tags are only changed when the Manifest gives them.
+//
+// Every change is passed to authorize before anything is changed, and any
+// error it returns stops the apply. With dryRun, the changes are only
+// returned. The changes are not atomic; when one fails, the ones before it
+// stay made.
+func (c *Core) ApplyManifest(m *common.Manifest, dryRun bool, authorize func(*common.ManifestChange) error) (*common.ManifestResult, error) {
+	if err := validator.Validate(m); err != nil {
+		return nil, validationErrorOf(m, err)
+	}
+
+	plan := new(manifestPlan)
+	if err := c.planManifest(m, plan); err != nil {
+		return nil, err
+	}
+
+	result := &common.ManifestResult{
+		DryRun:  dryRun,
+		Changes: make([]*common.ManifestChange, 0),
+	}
+	for _, step := range plan.steps {
+		if authorize != nil {
+			if err := authorize(step.change); err != nil {
+				return nil, err
+			}
+		}
+		result.Changes = append(result.Changes, step.change)
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	for _, step := range plan.steps {
+		if err := step.apply(); err != nil {
+			return nil, fmt.Errorf("Could not %s %s: %s", step.change.Action, step.change.Location, err)
+		}
+	}
+	return result, nil
+}
+
+// planManifest adds the steps to apply a Manifest, in the order they have to
+// be made.
+func (c *Core) planManifest(m *common.Manifest, plan *manifestPlan) error {
+	for _, desired := range m.ImageRepos {
+		if err := c.planImageRepo(desired, plan); err != nil {
+			return err
+		}
+	}
+
+	domains := make(map[string]bool)
+	for _, desired := range m.Entrypoints {
+		domains[*desired.Domain] = true
+		if err := c.planEntrypoint(desired, plan); err != nil {
+			return err
+		}
+	}
+
+	app, err := c.planApp(m.App, plan)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for _, desired := range m.Components {
+		if names[*desired.Name] {
+			return invalidManifestError(fmt.Sprintf("Component %s is in the Manifest twice", *desired.Name))
+		}
+		names[*desired.Name] = true
+
+		if err := c.checkManifestEntrypoints(desired, domains); err != nil {
+			return err
+		}
+		if err := c.planComponent(app, desired, plan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Core) planImageRepo(desired *common.ImageRepo, plan *manifestPlan) error {
+	repo, err := c.ImageRepos().Get(desired.Name)
+	if isNotFoundErr(err) {
+		repo = c.ImageRepos().New()
+		repo.Name = desired.Name
+		repo.Key = desired.Key
+		setManifestTags(repo.Meta, desired.Meta)
+		plan.add("create", "ImageRepo", ResourceLocation(repo), nil, func() error {
+			return c.ImageRepos().Create(repo)
+		})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var fields []string
+	if repo.Key != desired.Key {
+		fields = append(fields, "key")
+		repo.Key = desired.Key
+	}
+	if setManifestTags(repo.Meta, desired.Meta) {
+		fields = append(fields, "tags")
+	}
+	if len(fields) > 0 {
+		plan.add("update", "ImageRepo", ResourceLocation(repo), fields, repo.Update)
+	}
+	return nil
+}
+
+func (c *Core) planEntrypoint(desired *common.Entrypoint, plan *manifestPlan) error {
+	entrypoint, err := c.Entrypoints().Get(desired.Domain)
+	if isNotFoundErr(err) {
+		entrypoint = c.Entrypoints().New()
+		entrypoint.Domain = desired.Domain
+		setManifestTags(entrypoint.Meta, desired.Meta)
+		plan.add("create", "Entrypoint", ResourceLocation(entrypoint), nil, func() error {
+			return c.Entrypoints().Create(entrypoint)
+		})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if setManifestTags(entrypoint.Meta, desired.Meta) {
+		plan.add("update", "Entrypoint", ResourceLocation(entrypoint), []string{"tags"}, entrypoint.Update)
+	}
+	return nil
+}
+
+func (c *Core) planApp(desired *common.App, plan *manifestPlan) (*AppResource, error) {
+	app, err := c.Apps().Get(desired.Name)
+	if isNotFoundErr(err) {
+		app = c.Apps().New()
+		app.Name = desired.Name
+		setManifestTags(app.Meta, desired.Meta)
+		plan.add("create", "App", ResourceLocation(app), nil, func() error {
+			return c.Apps().Create(app)
+		})
+		return app, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if setManifestTags(app.Meta, desired.Meta) {
+		plan.add("update", "App", ResourceLocation(app), []string{"tags"}, app.Update)
+	}
+	return app, nil
+}
+
+func (c *Core) planComponent(app *AppResource, desired *common.ManifestComponent, plan *manifestPlan) error {
+	component, err := app.Components().Get(desired.Name)
+	if isNotFoundErr(err) {
+		component = app.Components().New()
+		component.Name = desired.Name
+		component.CustomDeployScript = desired.CustomDeployScript
+		component.Strategy = desired.Strategy
+		component.Canary = desired.Canary
+		component.Rolling = desired.Rolling
+		setManifestTags(component.Meta, &common.Meta{Tags: desired.Tags})
+		plan.add("create", "Component", ResourceLocation(component), nil, func() error {
+			return app.Components().Create(component)
+		})
+		return c.planRelease(component, desired.Release, plan)
+	}
+	if err != nil {
+		return err
+	}
+
+	var fields []string
+	if !jsonEqual(component.CustomDeployScript, desired.CustomDeployScript) {
+		fields = append(fields, "custom_deploy_script")
+		component.CustomDeployScript = desired.CustomDeployScript
+	}
+	if component.Strategy != desired.Strategy {
+		fields = append(fields, "strategy")
+		component.Strategy = desired.Strategy
+	}
+	if !jsonEqual(component.Canary, desired.Canary) {
+		fields = append(fields, "canary")
+		component.Canary = desired.Canary
+	}
+	if !jsonEqual(component.Rolling, desired.Rolling) {
+		fields = append(fields, "rolling")
+		component.Rolling = desired.Rolling
+	}
+	if setManifestTags(component.Meta, &common.Meta{Tags: desired.Tags}) {
+		fields = append(fields, "tags")
+	}
+	if len(fields) > 0 {
+		plan.add("update", "Component", ResourceLocation(component), fields, component.Update)
+	}
+	return c.planRelease(component, desired.Release, plan)
+}
+
+// planRelease adds a new Release for a Component, and its deploy, if the
+// blueprint differs from the one the Component runs (or is about to). A
+// target Release that is not deployed yet is changed in place instead.
+func (c *Core) planRelease(component *ComponentResource, desired *common.Release, plan *manifestPlan) error {
+	location := ResourceLocation(component)
+
+	release := component.Releases().New()
+	release.InstanceGroup = desired.InstanceGroup
+	release.InstanceCount = desired.InstanceCount
+	release.Volumes = desired.Volumes
+	release.Containers = desired.Containers
+	release.TerminationGracePeriod = desired.TerminationGracePeriod
+
+	var base *ReleaseResource
+	var err error
+	if component.TargetReleaseTimestamp != nil {
+		if base, err = component.TargetRelease(); err != nil {
+			return err
+		}
+	} else if component.CurrentReleaseTimestamp != nil {
+		if base, err = component.CurrentRelease(); err != nil {
+			return err
+		}
+	}
+
+	if base == nil {
+		if desired.InstanceGroup != nil {
+			return invalidManifestError(fmt.Sprintf("Component %s has no Release yet, so its instance_group cannot be given", *component.Name))
+		}
+		plan.add("release", "Release", location+"/releases", manifestReleaseFields, func() error {
+			return component.Releases().Create(release)
+		})
+		plan.add("deploy", "Component", location, nil, component.StartDeploy)
+		return nil
+	}
+
+	// NOTE the comparison is made with what the Release would be after
+	// merge-creating it, so that fields left out of the Manifest do not count.
+	merged := component.Releases().New()
+	*merged.Release = *release.Release
+	if err := mergo.Merge(merged.Release, *base.Release); err != nil {
+		return err
+	}
+	setDefaultFields(merged)
+	// NOTE a target Release is updated in place below, which does not validate
+	// the probes the way creating a Release does.
+	if err := merged.validateProbes(); err != nil {
+		return err
+	}
+
+	var fields []string
+	for _, field := range manifestReleaseFields {
+		if !jsonFieldEqual(merged.Release, base.Release, field) {
+			fields = append(fields, field)
+		}
+	}
+	if desired.InstanceGroup != nil && (base.InstanceGroup == nil || *desired.InstanceGroup != *base.InstanceGroup) {
+		fields = append(fields, "instance_group")
+	}
+
+	switch {
+	case component.TargetReleaseTimestamp != nil && base.Committed:
+		if len(fields) > 0 {
+			return invalidManifestError(fmt.Sprintf("Component %s is being deployed; apply again once it is done", *component.Name))
+		}
+	case component.TargetReleaseTimestamp != nil:
+		// A target Release that was never deployed is changed in place, and
+		// deployed either way.
+		if len(fields) > 0 {
+			plan.add("update", "Release", ResourceLocation(base), fields, func() error {
+				return c.db.retryUpdate(base.collection.(Collection), base.Timestamp, base, func() error {
+					base.InstanceGroup = merged.InstanceGroup
+					base.InstanceCount = merged.InstanceCount
+					base.Volumes = merged.Volumes
+					base.Containers = merged.Containers
+					base.TerminationGracePeriod = merged.TerminationGracePeriod
+					return nil
+				})
+			})
+		}
+		plan.add("deploy", "Component", location, nil, component.StartDeploy)
+	case len(fields) > 0:
+		plan.add("release", "Release", location+"/releases", fields, func() error {
+			return component.Releases().MergeCreate(release)
+		})
+		plan.add("deploy", "Component", location, nil, component.StartDeploy)
+	}
+	return nil
+}
+
+// checkManifestEntrypoints makes sure the Entrypoints the ports of a Component
+// are added to exist, or are in the Manifest.
+func (c *Core) checkManifestEntrypoints(component *common.ManifestComponent, domains map[string]bool) error {
+	for _, container := range component.Release.Containers {
+		if container == nil {
+			continue
+		}
+		for _, port := range container.Ports {
+			if port == nil || port.EntrypointDomain == nil || domains[*port.EntrypointDomain] {
+				continue
+			}
+			if _, err := c.Entrypoints().Get(port.EntrypointDomain); isNotFoundErr(err) {
+				return invalidManifestError(fmt.Sprintf("Component %s uses Entrypoint %s, which does not exist and is not in the Manifest", *component.Name, *port.EntrypointDomain))
+			} else if err != nil {
+				return err
+			}
+			domains[*port.EntrypointDomain] = true
+		}
+	}
+	return nil
+}
+
+// setManifestTags sets the Tags of desired on meta, if it gives any, returning
+// true if they differ.
+func setManifestTags(meta *common.Meta, desired *common.Meta) bool {
+	if desired == nil || desired.Tags == nil || reflect.DeepEqual(meta.Tags, desired.Tags) {
+		return false
+	}
+	meta.Tags = desired.Tags
+	return true
+}
+
+func jsonEqual(a interface{}, b interface{}) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// jsonFieldEqual compares a field of two structs, by its JSON name.
+func jsonFieldEqual(a interface{}, b interface{}, field string) bool {
+	var aFields, bFields map[string]json.RawMessage
+	aJSON, _ := json.Marshal(a)
+	bJSON, _ := json.Marshal(b)
+	if json.Unmarshal(aJSON, &aFields) != nil || json.Unmarshal(bJSON, &bFields) != nil {
+		return false
+	}
+	return bytes.Equal(aFields[field], bFields[field])
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/guber"
+	"github.com/supergiant/supergiant/common"
+)
+
+func testManifest(release string) *common.Manifest {
+	m := new(common.Manifest)
+	data := `{
+		"app": {"name": "test"},
+		"components": [{"name": "web", "release": ` + release + `}]
+	}`
+	if err := json.Unmarshal([]byte(data), m); err != nil {
+		panic(err)
+	}
+	return m
+}
+
+const (
+	testManifestContainers = `[{"image": "nginx:1.11", "cpu": {"min": 0, "max": 0}, "ram": {"min": 0, "max": 0}}]`
+	testManifestRelease    = `{"instance_count": 2, "containers": ` + testManifestContainers + `}`
+)
+
+func TestApplyManifest(t *testing.T) {
+	Convey("Given a Core with no Apps", t, func() {
+		core := &Core{db: newDB(newMemoryStore())}
+
+		Convey("A dry run should list the App, its Components, their Releases and deploys, without making them", func() {
+			result, err := core.ApplyManifest(testManifest(testManifestRelease), true, nil)
+			So(err, ShouldBeNil)
+			So(result.DryRun, ShouldBeTrue)
+			So(result.Changes, ShouldHaveLength, 4)
+			So(*result.Changes[0], ShouldResemble, common.ManifestChange{Action: "create", Kind: "App", Location: "/apps/test"})
+			So(*result.Changes[1], ShouldResemble, common.ManifestChange{Action: "create", Kind: "Component", Location: "/apps/test/components/web"})
+			So(result.Changes[2].Action, ShouldEqual, "release")
+			So(result.Changes[2].Location, ShouldEqual, "/apps/test/components/web/releases")
+			So(*result.Changes[3], ShouldResemble, common.ManifestChange{Action: "deploy", Kind: "Component", Location: "/apps/test/components/web"})
+
+			_, err = core.Apps().Get(common.IDString("test"))
+			So(isNotFoundErr(err), ShouldBeTrue)
+		})
+
+		Convey("A Manifest using an Entrypoint that does not exist should be invalid", func() {
+			m := testManifest(`{"containers": [{"image": "nginx", "cpu": {}, "ram": {}, "ports": [{"protocol": "HTTP", "number": 80, "entrypoint_domain": "example.com"}]}]}`)
+			_, err := core.ApplyManifest(m, true, nil)
+			So(IsInvalidManifestErr(err), ShouldBeTrue)
+		})
+
+		Convey("A Manifest without an App should be invalid", func() {
+			m := testManifest(testManifestRelease)
+			m.App = nil
+			_, err := core.ApplyManifest(m, true, nil)
+			So(ErrorCode(err), ShouldEqual, common.ErrorCodeValidation)
+			So(err.(*ValidationError).Fields[0].Path, ShouldEqual, "app")
+		})
+
+		Convey("An error from authorize should stop the apply", func() {
+			denied := errors.New("denied")
+			_, err := core.ApplyManifest(testManifest(testManifestRelease), false, func(change *common.ManifestChange) error {
+				if change.Action == "deploy" {
+					return denied
+				}
+				return nil
+			})
+			So(err, ShouldEqual, denied)
+
+			_, err = core.Apps().Get(common.IDString("test"))
+			So(isNotFoundErr(err), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given an App with a Component running the Release of a Manifest", t, func() {
+		server := httptest.NewTLSServer(http.NotFoundHandler())
+		defer server.Close()
+
+		host := strings.TrimPrefix(server.URL, "https://")
+		core := &Core{db: newDB(newMemoryStore())}
+		core.k8s = guber.NewClient(host, "u", "p", true)
+		_, err := core.db.store.create("/apps/test", `{"name":"test","tags":{}}`)
+		So(err, ShouldBeNil)
+
+		_, err = core.db.store.create("/components/test/web", `{"name":"web","current_release_id":"20160412035456","tags":{}}`)
+		So(err, ShouldBeNil)
+		_, err = core.db.store.create("/releases/test/web/20160412035456", `{"timestamp":"20160412035456","instance_group":"20160412035456","committed":true,"instance_count":2,"containers":`+testManifestContainers+`,"termination_grace_period":10,"tags":{}}`)
+		So(err, ShouldBeNil)
+
+		app, err := core.Apps().Get(common.IDString("test"))
+		So(err, ShouldBeNil)
+
+		Convey("Applying it again should change nothing", func() {
+			result, err := core.ApplyManifest(testManifest(testManifestRelease), false, nil)
+			So(err, ShouldBeNil)
+			So(result.Changes, ShouldBeEmpty)
+		})
+
+		Convey("Fields left out of the Manifest should not count as changes", func() {
+			result, err := core.ApplyManifest(testManifest(`{"containers": `+testManifestContainers+`}`), true, nil)
+			So(err, ShouldBeNil)
+			So(result.Changes, ShouldBeEmpty)
+		})
+
+		Convey("Invalid probes should fail validation, even for a target Release updated in place", func() {
+			_, err := core.db.store.create("/releases/test/web/20160413035456", `{"timestamp":"20160413035456","instance_group":"20160412035456","instance_count":2,"containers":`+testManifestContainers+`,"termination_grace_period":10,"tags":{}}`)
+			So(err, ShouldBeNil)
+			component, err := app.Components().Get(common.IDString("web"))
+			So(err, ShouldBeNil)
+			component.TargetReleaseTimestamp = common.IDString("20160413035456")
+			So(component.Update(), ShouldBeNil)
+
+			m := testManifest(`{"containers": [{"image": "nginx:1.11", "cpu": {}, "ram": {}, "liveness_probe": {"http": {"path": "/", "port": 80}, "tcp": {"port": 80}}}]}`)
+			_, err = core.ApplyManifest(m, true, nil)
+			So(ErrorCode(err), ShouldEqual, common.ErrorCodeValidation)
+			So(err.(*ValidationError).Fields[0].Path, ShouldEqual, "containers[0].liveness_probe")
+		})
+
+		Convey("A changed deploy strategy should update the Component, without a new Release", func() {
+			m := testManifest(testManifestRelease)
+			m.Components[0].Strategy = common.DeployStrategyCanary
+			m.Components[0].Canary = &common.CanaryOptions{Instances: 1, Pause: 300}
+
+			result, err := core.ApplyManifest(m, false, nil)
+			So(err, ShouldBeNil)
+			So(result.Changes, ShouldHaveLength, 1)
+			So(*result.Changes[0], ShouldResemble, common.ManifestChange{Action: "update", Kind: "Component", Location: "/apps/test/components/web", Fields: []string{"strategy", "canary"}})
+
+			component, err := app.Components().Get(common.IDString("web"))
+			So(err, ShouldBeNil)
+			So(component.Strategy, ShouldEqual, common.DeployStrategyCanary)
+			So(component.Canary.Pause, ShouldEqual, 300)
+			So(component.Rolling, ShouldBeNil)
+
+			result, err = core.ApplyManifest(m, false, nil)
+			So(err, ShouldBeNil)
+			So(result.Changes, ShouldBeEmpty)
+		})
+
+		Convey("A changed blueprint should give a new Release, merged with the current one", func() {
+			m := testManifest(`{"instance_count": 3, "containers": ` + testManifestContainers + `}`)
+			m.App.Meta = &common.Meta{Tags: common.Tags{"team": "search"}}
+
+			result, err := core.ApplyManifest(m, true, nil)
+			So(err, ShouldBeNil)
+			So(result.Changes, ShouldHaveLength, 3)
+			So(*result.Changes[0], ShouldResemble, common.ManifestChange{Action: "update", Kind: "App", Location: "/apps/test", Fields: []string{"tags"}})
+			So(*result.Changes[1], ShouldResemble, common.ManifestChange{Action: "release", Kind: "Release", Location: "/apps/test/components/web/releases", Fields: []string{"instance_count"}})
+			So(result.Changes[2].Action, ShouldEqual, "deploy")
+
+			plan := new(manifestPlan)
+			So(core.planManifest(m, plan), ShouldBeNil)
+			So(plan.steps[0].apply(), ShouldBeNil)
+			So(plan.steps[1].apply(), ShouldBeNil)
+
+			component, err := app.Components().Get(common.IDString("web"))
+			So(err, ShouldBeNil)
+			target, err := component.TargetRelease()
+			So(err, ShouldBeNil)
+			So(target.InstanceCount, ShouldEqual, 3)
+			So(target.Containers[0].Image, ShouldEqual, "nginx:1.11")
+			So(target.Committed, ShouldBeFalse)
+
+			app, err = core.Apps().Get(common.IDString("test"))
+			So(err, ShouldBeNil)
+			So(app.Tags, ShouldResemble, common.Tags{"team": "search"})
+		})
+	})
+}
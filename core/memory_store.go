@@ -0,0 +1,124 @@
+package core
+
+import "sync"
+
+// memoryStore keeps everything in a map. It is meant for tests and trying out
+// supergiant, since nothing survives a restart.
+type memoryStore struct {
+	mu    sync.RWMutex
+	data  map[string]*storeValue
+	index uint64 // the revision of the latest write
+	hub   *watchHub
+
+	// onWrite, if set, is called after every write, while still holding the
+	// lock. A failed write is rolled back. See fileStore.
+	onWrite func() error
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		data: make(map[string]*storeValue),
+		hub:  newWatchHub(),
+	}
+}
+
+func (s *memoryStore) list(dir string) ([]*storeValue, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedValuesUnder(s.data, dir, false), nil
+}
+
+func (s *memoryStore) listAll(dir string) ([]*storeValue, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedValuesUnder(s.data, dir, true), nil
+}
+
+func (s *memoryStore) get(key string) (*storeValue, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.data[key]
+	if !ok {
+		return nil, &storeError{storeErrKeyNotFound, key}
+	}
+	out := *v
+	out.Key = key
+	return &out, nil
+}
+
+func (s *memoryStore) create(key string, value string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[key]; ok {
+		return 0, &storeError{storeErrKeyExists, key}
+	}
+	return s.write("create", key, value)
+}
+
+func (s *memoryStore) update(key string, value string, prevRevision uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	if !ok {
+		return 0, &storeError{storeErrKeyNotFound, key}
+	}
+	if prevRevision != 0 && v.Revision != prevRevision {
+		return 0, &storeError{storeErrCompareFailed, key}
+	}
+	return s.write("update", key, value)
+}
+
+func (s *memoryStore) delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[key]; !ok {
+		return &storeError{storeErrKeyNotFound, key}
+	}
+	_, err := s.write("delete", key, "")
+	return err
+}
+
+func (s *memoryStore) compareAndSwap(key string, prevValue string, value string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	if !ok {
+		return 0, &storeError{storeErrKeyNotFound, key}
+	}
+	if v.Value != prevValue {
+		return 0, &storeError{storeErrCompareFailed, key}
+	}
+	return s.write("compareAndSwap", key, value)
+}
+
+func (s *memoryStore) watch(dir string) storeWatcher {
+	return s.hub.watch(dir)
+}
+
+// write must be called with the lock held.
+func (s *memoryStore) write(action string, key string, value string) (uint64, error) {
+	prev, existed := s.data[key]
+	prevIndex := s.index
+
+	s.index++
+	if action == "delete" {
+		delete(s.data, key)
+	} else {
+		s.data[key] = &storeValue{Value: value, Revision: s.index}
+	}
+
+	if s.onWrite != nil {
+		if err := s.onWrite(); err != nil {
+			s.index = prevIndex
+			if existed {
+				s.data[key] = prev
+			} else {
+				delete(s.data, key)
+			}
+			return 0, err
+		}
+	}
+
+	s.hub.emit(action, key, value, s.index)
+	return s.index, nil
+}
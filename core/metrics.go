@@ -0,0 +1,234 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the buckets of the
+// duration histograms. Tasks (such as deploys) can take minutes.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800}
+
+// The metrics of this replica, written by WriteMetrics.
+var (
+	httpRequestDuration = newHistogramVec("supergiant_http_request_duration_seconds", "Time taken to serve API requests, by method, route and status.", durationBuckets, "method", "route", "status")
+	taskAttempts        = newCounterVec("supergiant_task_attempts_total", "Task attempts started by the Supervisor, by action.", "action")
+	taskDuration        = newHistogramVec("supergiant_task_duration_seconds", "Time taken by Task attempts, by action and result (succeeded, failed or cancelled).", durationBuckets, "action", "result")
+	taskFailures        = newCounterVec("supergiant_task_failures_total", "Tasks moved to FailedTasks after their last attempt failed, by action.", "action")
+	capacityDecisions   = newCounterVec("supergiant_capacity_decisions_total", "Decisions of the capacity service (create_node, terminate_node or wait_for_node), by instance type.", "decision", "class")
+	capacityErrors      = newCounterVec("supergiant_capacity_errors_total", "Errors of the capacity service loop, by the step that failed.", "step")
+	nodeCreates         = newCounterVec("supergiant_node_creates_total", "Nodes created, by instance type and result.", "class", "result")
+	nodeTerminations    = newCounterVec("supergiant_node_terminations_total", "Nodes terminated, by instance type and result.", "class", "result")
+)
+
+// taskMetricsTTL is how long the Tasks counted by WriteMetrics are reused. It
+// is about the usual scrape interval, so that Tasks are listed about once per
+// scrape however many scrapers there are.
+var taskMetricsTTL = 15 * time.Second
+
+// ObserveHTTPRequest records an API request served in d, by the template of
+// the route that matched it.
+func ObserveHTTPRequest(method string, route string, status int, d time.Duration) {
+	httpRequestDuration.observe(d.Seconds(), method, route, strconv.Itoa(status))
+}
+
+// WriteMetrics writes the metrics of this replica to w, in the Prometheus text
+// exposition format. The Tasks and FailedTasks by status and action are read
+// from the store, so they are the same on every replica. They are counted at
+// most once per taskMetricsTTL.
+func (c *Core) WriteMetrics(w io.Writer) error {
+	tasks, err := c.taskMetrics.get(taskMetricsTTL, func() (interface{}, error) {
+		return c.countTasks()
+	})
+	if err != nil {
+		return err
+	}
+
+	leader := newGaugeVec("supergiant_leader", "1 if this replica is the elected leader, running the Supervisor and capacity service.")
+	if c.IsLeader() {
+		leader.add(1)
+	} else {
+		leader.add(0)
+	}
+
+	buf := bufio.NewWriter(w)
+	for _, v := range []*metricVec{
+		httpRequestDuration,
+		tasks.(*metricVec),
+		taskAttempts,
+		taskDuration,
+		taskFailures,
+		capacityDecisions,
+		capacityErrors,
+		nodeCreates,
+		nodeTerminations,
+		leader,
+	} {
+		v.write(buf)
+	}
+	return buf.Flush()
+}
+
+// countTasks returns the supergiant_tasks gauge, counting the Tasks and
+// FailedTasks in the store.
+func (c *Core) countTasks() (*metricVec, error) {
+	tasks := newGaugeVec("supergiant_tasks", "Tasks queued, running or failed, by status and action.", "status", "action")
+
+	taskList, err := c.Tasks().List()
+	if err != nil {
+		return nil, err
+	}
+	for _, task := range taskList.Items {
+		// NOTE a Task whose Action cannot be read is counted without an action.
+		action := new(Action)
+		json.Unmarshal([]byte(task.ActionData), action)
+		tasks.add(1, task.Status, action.ActionName)
+	}
+
+	failedList, err := c.FailedTasks().List()
+	if err != nil {
+		return nil, err
+	}
+	for _, failed := range failedList.Items {
+		tasks.add(1, failed.Status, failed.ActionName)
+	}
+	return tasks, nil
+}
+
+//------------------------------------------------------------------------------
+
+// metricVec is a metric with a series for every combination of label values,
+// which is enough of a Prometheus client for our needs.
+type metricVec struct {
+	name    string
+	help    string
+	kind    string // counter, gauge or histogram
+	labels  []string
+	buckets []float64 // histograms only
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64 // the sum, for histograms
+	count       uint64
+	bucketCount []uint64
+}
+
+func newCounterVec(name string, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "counter", labels: labels, series: make(map[string]*metricSeries)}
+}
+
+func newGaugeVec(name string, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "gauge", labels: labels, series: make(map[string]*metricSeries)}
+}
+
+func newHistogramVec(name string, help string, buckets []float64, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets, series: make(map[string]*metricSeries)}
+}
+
+// seriesOf returns the series of the label values, creating it the first
+// time. It must be called with mu held.
+func (v *metricVec) seriesOf(labelValues []string) *metricSeries {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Errorf("Metric %s has %d labels, not %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: labelValues, bucketCount: make([]uint64, len(v.buckets))}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *metricVec) inc(labelValues ...string) {
+	v.add(1, labelValues...)
+}
+
+func (v *metricVec) add(delta float64, labelValues ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.seriesOf(labelValues).value += delta
+}
+
+func (v *metricVec) observe(value float64, labelValues ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s := v.seriesOf(labelValues)
+	s.value += value
+	s.count++
+	for i, bound := range v.buckets {
+		if value <= bound {
+			s.bucketCount[i]++
+		}
+	}
+}
+
+// write writes the series of the metric, sorted by label values.
+func (v *metricVec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+
+	var keys []string
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := v.series[key]
+		if v.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelPairs(s, ""), formatMetricValue(s.value))
+			continue
+		}
+		for i, bound := range v.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, v.labelPairs(s, formatMetricValue(bound)), s.bucketCount[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, v.labelPairs(s, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, v.labelPairs(s, ""), formatMetricValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, v.labelPairs(s, ""), s.count)
+	}
+}
+
+// labelPairs returns the labels of a series as {name="value",...}, with the
+// le label of histogram buckets when le is not empty.
+func (v *metricVec) labelPairs(s *metricSeries, le string) string {
+	var pairs []string
+	for i, label := range v.labels {
+		pairs = append(pairs, label+`="`+escapeLabelValue(s.labelValues[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatMetricValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetricVec(t *testing.T) {
+	Convey("Given a counter and a histogram", t, func() {
+		counter := newCounterVec("test_total", "A counter.", "name")
+		histogram := newHistogramVec("test_seconds", "A histogram.", []float64{0.5, 1}, "name")
+
+		Convey("Counters should be written by label values", func() {
+			counter.inc("b")
+			counter.inc("a")
+			counter.add(2, "b")
+
+			out := new(bytes.Buffer)
+			counter.write(out)
+			So(out.String(), ShouldEqual, `# HELP test_total A counter.
+# TYPE test_total counter
+test_total{name="a"} 1
+test_total{name="b"} 3
+`)
+		})
+
+		Convey("Histograms should be written with cumulative buckets", func() {
+			histogram.observe(0.25, "a")
+			histogram.observe(0.75, "a")
+			histogram.observe(2, "a")
+
+			out := new(bytes.Buffer)
+			histogram.write(out)
+			So(out.String(), ShouldEqual, `# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{name="a",le="0.5"} 1
+test_seconds_bucket{name="a",le="1"} 2
+test_seconds_bucket{name="a",le="+Inf"} 3
+test_seconds_sum{name="a"} 3
+test_seconds_count{name="a"} 3
+`)
+		})
+
+		Convey("Label values should be escaped", func() {
+			counter.inc("say \"hi\"\n")
+
+			out := new(bytes.Buffer)
+			counter.write(out)
+			So(out.String(), ShouldContainSubstring, `test_total{name="say \"hi\"\n"} 1`)
+		})
+	})
+}
+
+func TestWriteMetrics(t *testing.T) {
+	Convey("Given a Core with a queued Task", t, func() {
+		core := &Core{db: newDB(newMemoryStore())}
+		_, err := core.Tasks().Start(&Action{ActionName: "deploy", ResourceLocation: "/apps/test/components/web"})
+		So(err, ShouldBeNil)
+
+		Convey("WriteMetrics should count it by status and action", func() {
+			out := new(bytes.Buffer)
+			So(core.WriteMetrics(out), ShouldBeNil)
+			So(out.String(), ShouldContainSubstring, `supergiant_tasks{status="QUEUED",action="deploy"} 1`)
+			So(out.String(), ShouldContainSubstring, "supergiant_leader 0")
+		})
+
+		Convey("Tasks started since should not be counted until taskMetricsTTL has passed", func() {
+			So(core.WriteMetrics(new(bytes.Buffer)), ShouldBeNil)
+			_, err := core.Tasks().Start(&Action{ActionName: "deploy", ResourceLocation: "/apps/test/components/api"})
+			So(err, ShouldBeNil)
+
+			out := new(bytes.Buffer)
+			So(core.WriteMetrics(out), ShouldBeNil)
+			So(out.String(), ShouldContainSubstring, `supergiant_tasks{status="QUEUED",action="deploy"} 1`)
+
+			core.taskMetrics.expires = time.Now()
+			out.Reset()
+			So(core.WriteMetrics(out), ShouldBeNil)
+			So(out.String(), ShouldContainSubstring, `supergiant_tasks{status="QUEUED",action="deploy"} 2`)
+		})
+	})
+}
@@ -0,0 +1,182 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Every stored record carries the schema version it was written with, in the
+// field below. Records written before versioning was introduced have none, and
+// are version 0.
+const schemaVersionField = "schema_version"
+
+// migration upgrades the records of a single Collection (by its etcd directory,
+// e.g. "tasks") to the given schema version.
+type migration struct {
+	version     int
+	collection  string
+	description string
+	migrate     func(record map[string]interface{}) error
+}
+
+// migrations must be ordered by version, starting at 1. When changing any
+// stored field of a common type, add a migration here and a fixture to
+// testdata/migrations.
+var migrations = []*migration{
+	{
+		version:     1,
+		collection:  "tasks",
+		description: "Copy the last error of a Task into its error history",
+		migrate: func(record map[string]interface{}) error {
+			if record["errors"] != nil {
+				return nil
+			}
+			msg, _ := record["error"].(string)
+			if msg == "" {
+				return nil
+			}
+			record["errors"] = []interface{}{
+				map[string]interface{}{
+					"attempt":   record["attempts"],
+					"error":     msg,
+					"timestamp": record["updated"],
+				},
+			}
+			return nil
+		},
+	},
+}
+
+func schemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// stampSchemaVersion adds the current schema version to a marshalled record.
+func stampSchemaVersion(record []byte) string {
+	stamp := fmt.Sprintf(`{"%s":%d`, schemaVersionField, schemaVersion())
+	if string(record) == "{}" {
+		return stamp + "}"
+	}
+	return stamp + "," + string(record[1:])
+}
+
+// migrateRecord upgrades a record of the given Collection to the current schema
+// version, returning the version it was at. If it was already current, the
+// record is returned as is.
+func migrateRecord(collection string, value string) (int, string, error) {
+	header := make(map[string]json.RawMessage)
+	if err := json.Unmarshal([]byte(value), &header); err != nil {
+		return 0, "", err
+	}
+
+	version := 0
+	if raw, ok := header[schemaVersionField]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return 0, "", err
+		}
+	}
+
+	switch current := schemaVersion(); {
+	case version == current:
+		return version, value, nil
+	case version > current:
+		return version, "", fmt.Errorf("Record has schema version %d, but this supergiant-api only supports up to %d", version, current)
+	}
+
+	record := make(map[string]interface{})
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		return version, "", err
+	}
+
+	for _, m := range migrations {
+		if m.version <= version || m.collection != collection {
+			continue
+		}
+		if err := m.migrate(record); err != nil {
+			return version, "", fmt.Errorf("Migration %d (%s) failed: %s", m.version, m.description, err)
+		}
+	}
+	record[schemaVersionField] = schemaVersion()
+
+	out, err := json.Marshal(record)
+	if err != nil {
+		return version, "", err
+	}
+	return version, string(out), nil
+}
+
+// recordCollection returns the Collection directory of a stored key, or an empty
+// string if the key is not a record (e.g. the leader key).
+func recordCollection(key string) string {
+	segments := strings.Split(key, "/")
+	if len(segments) < 3 {
+		return ""
+	}
+	return segments[1]
+}
+
+// migrate upgrades every stored record to the current schema version, writing
+// a line to w for each one that needs it. With dryRun, the upgraded records are
+// written to w instead of being saved.
+func (db *database) migrate(w io.Writer, dryRun bool) error {
+	values, err := db.store.listAll("")
+	if err != nil && !isNotFoundErr(err) {
+		return err
+	}
+
+	migrated, failed := 0, 0
+	err = db.batch(func() error {
+		for _, value := range values {
+			collection := recordCollection(value.Key)
+			if collection == "" {
+				continue
+			}
+
+			version, out, err := migrateRecord(collection, value.Value)
+			if err != nil {
+				return fmt.Errorf("%s: %s", value.Key, err)
+			}
+			if version == schemaVersion() {
+				continue
+			}
+
+			fmt.Fprintf(w, "%s: schema version %d -> %d\n", value.Key, version, schemaVersion())
+
+			if dryRun {
+				indented := new(bytes.Buffer)
+				json.Indent(indented, []byte(out), "  ", "  ")
+				fmt.Fprintf(w, "  %s\n", indented)
+				migrated++
+				continue
+			}
+
+			// NOTE the write is conditional, so that a record changed while migrating
+			// is left for the next run.
+			if _, err := db.store.update(value.Key, out, value.Revision); err != nil {
+				fmt.Fprintf(w, "  %s\n", err)
+				failed++
+				continue
+			}
+			migrated++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Fprintf(w, "%d of %d records would be migrated to schema version %d\n", migrated, len(values), schemaVersion())
+		return nil
+	}
+	fmt.Fprintf(w, "%d of %d records migrated to schema version %d\n", migrated, len(values), schemaVersion())
+	if failed > 0 {
+		return fmt.Errorf("%d records could not be migrated, run migrate again", failed)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+// loadFixture reads a testdata/migrations file, which maps keys to records.
+func loadFixture(name string) map[string]json.RawMessage {
+	data, err := ioutil.ReadFile("testdata/migrations/" + name)
+	if err != nil {
+		panic(err)
+	}
+	records := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &records); err != nil {
+		panic(err)
+	}
+	return records
+}
+
+// storeFromFixture returns a memory store holding the records of a fixture.
+func storeFromFixture(name string) *memoryStore {
+	s := newMemoryStore()
+	for key, record := range loadFixture(name) {
+		compacted := new(bytes.Buffer)
+		if err := json.Compact(compacted, record); err != nil {
+			panic(err)
+		}
+		if _, err := s.create(key, compacted.String()); err != nil {
+			panic(err)
+		}
+	}
+	return s
+}
+
+func TestMigrations(t *testing.T) {
+	Convey("Given a store with version 0 records", t, func() {
+		s := storeFromFixture("v0.json")
+		db := newDB(s)
+		expected := loadFixture("v1.json")
+
+		Convey("When migrating with dryRun", func() {
+			out := new(bytes.Buffer)
+			err := db.migrate(out, true)
+
+			Convey("It should print the records that would change without saving them", func() {
+				So(err, ShouldBeNil)
+				So(out.String(), ShouldContainSubstring, "/tasks/failing: schema version 0 -> 1")
+				So(out.String(), ShouldContainSubstring, "4 of 4 records would be migrated to schema version 1")
+
+				val, err := s.get("/tasks/failing")
+				So(err, ShouldBeNil)
+				So(val.Value, ShouldNotContainSubstring, schemaVersionField)
+			})
+		})
+
+		Convey("When migrating", func() {
+			out := new(bytes.Buffer)
+			err := db.migrate(out, false)
+
+			Convey("Every record should match the version 1 fixture", func() {
+				So(err, ShouldBeNil)
+				So(out.String(), ShouldContainSubstring, "4 of 4 records migrated to schema version 1")
+
+				for key, record := range expected {
+					val, err := s.get(key)
+					So(err, ShouldBeNil)
+
+					var actual, want interface{}
+					So(json.Unmarshal([]byte(val.Value), &actual), ShouldBeNil)
+					So(json.Unmarshal(record, &want), ShouldBeNil)
+					So(actual, ShouldResemble, want)
+				}
+			})
+
+			Convey("Migrating again should change nothing", func() {
+				again := new(bytes.Buffer)
+				So(db.migrate(again, false), ShouldBeNil)
+				So(again.String(), ShouldEqual, "0 of 4 records migrated to schema version 1\n")
+			})
+		})
+
+		Convey("When a Task is loaded without migrating first", func() {
+			core := &Core{db: db}
+			task, err := core.Tasks().Get(common.IDString("failing"))
+
+			Convey("It should be upgraded in memory", func() {
+				So(err, ShouldBeNil)
+				So(task.Errors, ShouldHaveLength, 1)
+				So(task.Errors[0].Attempt, ShouldEqual, 3)
+				So(task.Errors[0].Error, ShouldEqual, "Namespace still terminating")
+			})
+		})
+	})
+
+	Convey("Given a record from a newer schema version", t, func() {
+		_, _, err := migrateRecord("tasks", `{"schema_version":99,"id":"x"}`)
+
+		Convey("migrateRecord() should refuse it", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -51,6 +51,21 @@ func (f *FakeEtcd) OnCreate(clbk func(string, string) error) *FakeEtcd {
 	return f
 }
 
+func (f *FakeEtcd) OnSet(clbk func(string, string) error) *FakeEtcd {
+	f.SetFn = func(key string, val string) (*etcd.Response, error) {
+		if err := clbk(key, val); err != nil {
+			return nil, err
+		}
+		return &etcd.Response{
+			Node: &etcd.Node{
+				Key:   key,
+				Value: val,
+			},
+		}, nil
+	}
+	return f
+}
+
 func (f *FakeEtcd) OnCreateInOrder(clbk func(string) (*etcd.Response, error)) *FakeEtcd {
 	f.CreateInOrderFn = func(val string) (*etcd.Response, error) {
 		return clbk(val)
@@ -86,11 +101,12 @@ func (f *FakeEtcd) OnDelete(clbk func(string) error) *FakeEtcd {
 // FakeEtcd is used to mock etcd operations in tests
 type FakeEtcd struct {
 	GetFn           func() (*etcd.Response, error)
-	SetFn           func() (*etcd.Response, error)
+	SetFn           func(key string, val string) (*etcd.Response, error)
 	DeleteFn        func(key string) (*etcd.Response, error)
 	CreateFn        func(key string, val string) (*etcd.Response, error)
 	CreateInOrderFn func(val string) (*etcd.Response, error)
 	UpdateFn        func(key string, val string) (*etcd.Response, error)
+	WatcherFn       func(key string) etcd.Watcher
 }
 
 // Get implements the etcd.KeysAPI interface
@@ -100,7 +116,7 @@ func (f *FakeEtcd) Get(ctx context.Context, key string, opts *etcd.GetOptions) (
 
 // Set implements the etcd.KeysAPI interface
 func (f *FakeEtcd) Set(ctx context.Context, key, value string, opts *etcd.SetOptions) (*etcd.Response, error) {
-	return f.SetFn()
+	return f.SetFn(key, value)
 }
 
 // Delete implements the etcd.KeysAPI interface
@@ -125,5 +141,47 @@ func (f *FakeEtcd) Update(ctx context.Context, key, value string) (*etcd.Respons
 
 // Watcher implements the etcd.KeysAPI interface
 func (f *FakeEtcd) Watcher(key string, opts *etcd.WatcherOptions) etcd.Watcher {
-	return nil
+	if f.WatcherFn == nil {
+		return nil
+	}
+	return f.WatcherFn(key)
+}
+
+// Convenience method for returning the same FakeWatcher on every Watcher call
+func (f *FakeEtcd) ReturnOnWatcher(w *FakeWatcher) *FakeEtcd {
+	f.WatcherFn = func(key string) etcd.Watcher {
+		return w
+	}
+	return f
+}
+
+// FakeWatcher is used to mock etcd watch events in tests. Responses sent on
+// Events are returned by Next in order.
+type FakeWatcher struct {
+	Events chan *etcd.Response
+}
+
+func NewFakeWatcher() *FakeWatcher {
+	return &FakeWatcher{make(chan *etcd.Response)}
+}
+
+// Emit sends a watch event with the given action, key and value.
+func (w *FakeWatcher) Emit(action string, key string, val string) {
+	w.Events <- &etcd.Response{
+		Action: action,
+		Node: &etcd.Node{
+			Key:   key,
+			Value: val,
+		},
+	}
+}
+
+// Next implements the etcd.Watcher interface
+func (w *FakeWatcher) Next(ctx context.Context) (*etcd.Response, error) {
+	select {
+	case resp := <-w.Events:
+		return resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
@@ -12,6 +12,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/supergiant/guber"
 	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
 )
 
 type NodesInterface interface {
@@ -27,6 +28,7 @@ type NodesInterface interface {
 	populate() error
 
 	List() (*NodeList, error)
+	ListWithOptions(*ListOptions) (*NodeList, error)
 	New() *NodeResource
 	Create(*NodeResource) error
 	Get(common.ID) (*NodeResource, error)
@@ -48,7 +50,8 @@ type NodeResource struct {
 // NOTE this does not inherit from common like model does; all we need is a List
 // object, internally, that has a slice of our composed model above.
 type NodeList struct {
-	Items []*NodeResource `json:"items"`
+	Items    []*NodeResource `json:"items"`
+	Continue string          `json:"continue,omitempty"`
 }
 
 // initializeResource implements the Collection interface.
@@ -60,8 +63,13 @@ func (c *NodeCollection) initializeResource(in Resource) {
 
 // List returns an NodeList.
 func (c *NodeCollection) List() (*NodeList, error) {
+	return c.ListWithOptions(nil)
+}
+
+// ListWithOptions returns a NodeList with opts applied (see ListOptions).
+func (c *NodeCollection) ListWithOptions(opts *ListOptions) (*NodeList, error) {
 	list := new(NodeList)
-	err := c.core.db.list(c, list)
+	err := c.core.db.list(c, list, opts)
 	return list, err
 }
 
@@ -90,8 +98,10 @@ func (c *NodeCollection) Create(r *NodeResource) error {
 
 	server, err := c.createServer(r.Class) // TODO move to AWS helpers
 	if err != nil {
-		return err
+		nodeCreates.inc(r.Class, AuditResultFailed)
+		return upstreamErr("AWS", err)
 	}
+	nodeCreates.inc(r.Class, AuditResultSucceeded)
 	node, err := c.createNodeFromServer(server)
 	if err != nil {
 		return err
@@ -126,8 +136,10 @@ func (c *NodeCollection) Patch(name common.ID, r *NodeResource) error {
 // Delete deletes the Node in etcd.
 func (c *NodeCollection) Delete(r *NodeResource) error {
 	if err := r.deleteServer(); err != nil {
+		nodeTerminations.inc(r.Class, AuditResultFailed)
 		return err
 	}
+	nodeTerminations.inc(r.Class, AuditResultSucceeded)
 	return c.core.db.delete(c, r.ID)
 }
 
@@ -139,7 +151,7 @@ func (c *NodeCollection) populate() error {
 
 	servers, err := ec2InstancesFromAutoscalingGroups(c.core)
 	if err != nil {
-		return err
+		return upstreamErr("AWS", err)
 	}
 
 	existentNodeIDs := make(map[string]struct{})
@@ -341,7 +353,7 @@ func (c *NodeCollection) createServer(class string) (*ec2.Instance, error) {
 		startingCapacity,
 		desiredCapacity,
 	)
-	err = common.WaitFor(desc, 60*time.Second, 2*time.Second, func() (bool, error) {
+	err = common.WaitFor(context.Background(), desc, 60*time.Second, 2*time.Second, func() (bool, error) {
 		group, err := autoscalingGroup(c.core, group.AutoScalingGroupName)
 		if err != nil {
 			return false, err
@@ -6,15 +6,18 @@ import (
 	"reflect"
 	"time"
 
+	"github.com/go-validator/validator"
 	"github.com/imdario/mergo"
 	"github.com/supergiant/guber"
 	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
 )
 
 type ReleasesInterface interface {
 	Component() *ComponentResource
 
 	List() (*ReleaseList, error)
+	ListWithOptions(*ListOptions) (*ReleaseList, error)
 	New() *ReleaseResource
 	Create(*ReleaseResource) error
 	MergeCreate(*ReleaseResource) error
@@ -24,6 +27,10 @@ type ReleasesInterface interface {
 	Delete(*ReleaseResource) error
 }
 
+// errTargetReleaseExists is returned when creating a Release for a Component
+// that has a target Release already.
+var errTargetReleaseExists = conflictError("Component already has a target Release")
+
 type ReleaseCollection struct {
 	core      *Core
 	component *ComponentResource
@@ -46,7 +53,8 @@ type ReleaseResource struct {
 }
 
 type ReleaseList struct {
-	Items []*ReleaseResource `json:"items"`
+	Items    []*ReleaseResource `json:"items"`
+	Continue string             `json:"continue,omitempty"`
 }
 
 // initializeResource implements the Collection interface.
@@ -66,8 +74,13 @@ func (c *ReleaseCollection) Component() *ComponentResource {
 
 // List returns an ReleaseList.
 func (c *ReleaseCollection) List() (*ReleaseList, error) {
+	return c.ListWithOptions(nil)
+}
+
+// ListWithOptions returns a ReleaseList with opts applied (see ListOptions).
+func (c *ReleaseCollection) ListWithOptions(opts *ListOptions) (*ReleaseList, error) {
 	list := new(ReleaseList)
-	err := c.core.db.list(c, list)
+	err := c.core.db.list(c, list, opts)
 	return list, err
 }
 
@@ -85,7 +98,11 @@ func (c *ReleaseCollection) New() *ReleaseResource {
 // Create takes an Release and creates it in etcd.
 func (c *ReleaseCollection) Create(r *ReleaseResource) error {
 	if c.Component().TargetReleaseTimestamp != nil {
-		return errors.New("Component already has a target Release")
+		return errTargetReleaseExists
+	}
+
+	if err := r.validateProbes(); err != nil {
+		return err
 	}
 
 	r.Timestamp = newReleaseTimestamp()
@@ -99,8 +116,21 @@ func (c *ReleaseCollection) Create(r *ReleaseResource) error {
 		return err
 	}
 
-	c.Component().TargetReleaseTimestamp = r.Timestamp
-	return c.Component().Update()
+	component := c.Component()
+	err := c.core.db.retryUpdate(component.collection.(Collection), component.Name, component, func() error {
+		if component.TargetReleaseTimestamp != nil {
+			return errTargetReleaseExists
+		}
+		component.TargetReleaseTimestamp = r.Timestamp
+		return nil
+	})
+	if err != nil {
+		// NOTE the Component got another target Release in the meantime, so this
+		// one would be orphaned.
+		c.core.db.delete(c, r.Timestamp)
+		return err
+	}
+	return nil
 }
 
 // MergeCreate creates a Release by taking a new Release and merging it with the
@@ -115,12 +145,14 @@ func (c *ReleaseCollection) MergeCreate(r *ReleaseResource) error {
 		return err
 	}
 
-	if err := mergo.Merge(r, *current); err != nil {
+	if err := mergo.Merge(r.Release, *current.Release); err != nil {
 		return err
 	}
 
 	// TODO
 	r.Committed = false
+	r.Rollback = nil
+	r.Canary = nil
 	r.Created = nil
 	r.Updated = nil
 
@@ -143,6 +175,9 @@ func (c *ReleaseCollection) Update(timestamp common.ID, r *ReleaseResource) erro
 
 // Patch partially updates the App in etcd.
 func (c *ReleaseCollection) Patch(name common.ID, r *ReleaseResource) error {
+	if err := r.validateProbes(); err != nil {
+		return err
+	}
 	return c.core.db.patch(c, name, r)
 }
 
@@ -171,14 +206,24 @@ func (c *ReleaseCollection) Delete(r *ReleaseResource) error {
 	}
 
 	// TODO sloppy
-	targetTimestamp := r.Component().TargetReleaseTimestamp
-	currentTimestamp := r.Component().CurrentReleaseTimestamp
-	if targetTimestamp != nil && *r.Timestamp == *targetTimestamp {
-		r.Component().TargetReleaseTimestamp = nil
-		r.Component().Update()
-	} else if currentTimestamp != nil && *r.Timestamp == *currentTimestamp {
-		r.Component().CurrentReleaseTimestamp = nil
-		r.Component().Update()
+	// NOTE we update a fresh copy of the Component, because the Releases of a
+	// Component are deleted concurrently.
+	component, err := r.Component().collection.Get(r.Component().Name)
+	if err != nil {
+		return err
+	}
+	err = r.core.db.retryUpdate(component.collection.(Collection), component.Name, component, func() error {
+		targetTimestamp := component.TargetReleaseTimestamp
+		currentTimestamp := component.CurrentReleaseTimestamp
+		if targetTimestamp != nil && *r.Timestamp == *targetTimestamp {
+			component.TargetReleaseTimestamp = nil
+		} else if currentTimestamp != nil && *r.Timestamp == *currentTimestamp {
+			component.CurrentReleaseTimestamp = nil
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	return r.core.db.delete(c, r.Timestamp)
@@ -247,13 +292,13 @@ func (r *ReleaseResource) Action(name string) *Action {
 func (r *ReleaseResource) decorate() error {
 	svc, err := r.getService(r.ExternalServiceName())
 	if err != nil && !isKubeNotFoundErr(err) {
-		return err
+		return upstreamErr("Kubernetes", err)
 	}
 	r.ExternalService = svc
 
 	svc, err = r.getService(r.InternalServiceName())
 	if err != nil && !isKubeNotFoundErr(err) {
-		return err
+		return upstreamErr("Kubernetes", err)
 	}
 	r.InternalService = svc
 
@@ -340,7 +385,7 @@ func (r *ReleaseResource) getEntrypoints() (map[string]*EntrypointResource, erro
 		if err != nil {
 
 			// TODO
-			if isEtcdNotFoundErr(err) {
+			if isNotFoundErr(err) {
 				Log.Errorf("Entrypoint %s does not exist", *port.EntrypointDomain)
 				continue
 			}
@@ -523,6 +568,64 @@ func (r *ReleaseResource) removeExternalPortsFromEntrypoint() error {
 	return nil
 }
 
+// validateProbes validates the probes of the containers, which validateFields
+// does not reach, since go-validator does not look into slices.
+func (r *ReleaseResource) validateProbes() error {
+	verr := new(ValidationError)
+	for i, container := range r.Containers {
+		if container == nil {
+			verr.Fields = append(verr.Fields, &common.FieldError{Path: fmt.Sprintf("containers[%d]", i), Error: "must not be null"})
+			continue
+		}
+		probes := []struct {
+			name  string
+			probe *common.Probe
+		}{
+			{"liveness_probe", container.LivenessProbe},
+			{"readiness_probe", container.ReadinessProbe},
+		}
+		for _, p := range probes {
+			if p.probe == nil {
+				continue
+			}
+			path := fmt.Sprintf("containers[%d].%s", i, p.name)
+
+			handlers := 0
+			for _, set := range []bool{p.probe.HTTP != nil, p.probe.TCP != nil, p.probe.Exec != nil} {
+				if set {
+					handlers++
+				}
+			}
+			if handlers != 1 {
+				verr.Fields = append(verr.Fields, &common.FieldError{Path: path, Error: "must have exactly one of http, tcp or exec"})
+			}
+
+			if perr, ok := validationErrorOf(p.probe, validator.Validate(p.probe)).(*ValidationError); ok {
+				for _, field := range perr.Fields {
+					field.Path = path + "." + field.Path
+					verr.Fields = append(verr.Fields, field)
+				}
+			}
+		}
+	}
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// restartsFrom returns true if deploying r after old restarts the Instances,
+// which is when they are in different InstanceGroups.
+func (r *ReleaseResource) restartsFrom(old *ReleaseResource) bool {
+	return *r.InstanceGroup != *old.InstanceGroup
+}
+
+// samePort is how ports are matched between Releases by AddNewPorts and
+// RemoveOldPorts.
+func samePort(a *common.Port, b *common.Port) bool {
+	return reflect.DeepEqual(*a, *b)
+}
+
 // AddNewPorts adds any new ports defined in containers to the existing
 // Services. This is used as a part of the deployment process, and is used in
 // conjunction with RemoveOldPorts.
@@ -535,7 +638,7 @@ func (newR *ReleaseResource) AddNewPorts(oldR *ReleaseResource) error {
 	for _, np := range newRInternalPorts {
 		new := true
 		for _, op := range oldRInternalPorts {
-			if reflect.DeepEqual(*np.Port, *op.Port) {
+			if samePort(np.Port, op.Port) {
 				new = false
 				break
 			}
@@ -551,7 +654,7 @@ func (newR *ReleaseResource) AddNewPorts(oldR *ReleaseResource) error {
 	for _, np := range newRExternalPorts {
 		new := true
 		for _, op := range oldRExternalPorts {
-			if reflect.DeepEqual(*np.Port, *op.Port) {
+			if samePort(np.Port, op.Port) {
 				new = false
 				break
 			}
@@ -607,7 +710,7 @@ func (newR *ReleaseResource) RemoveOldPorts(oldR *ReleaseResource) error {
 	for _, op := range oldRInternalPorts {
 		old := true
 		for _, np := range newRInternalPorts {
-			if reflect.DeepEqual(*np.Port, *op.Port) {
+			if samePort(np.Port, op.Port) {
 				old = false
 				break
 			}
@@ -622,7 +725,7 @@ func (newR *ReleaseResource) RemoveOldPorts(oldR *ReleaseResource) error {
 	for _, op := range oldRExternalPorts {
 		old := true
 		for _, np := range newRExternalPorts {
-			if reflect.DeepEqual(*np.Port, *op.Port) {
+			if samePort(np.Port, op.Port) {
 				old = false
 				break
 			}
@@ -682,7 +785,7 @@ func (newR *ReleaseResource) RemoveOldPorts(oldR *ReleaseResource) error {
 
 // Provision creates needed assets for all instances. It does not actually
 // start instances -- that is handled by deploy.go.
-func (r *ReleaseResource) Provision() error {
+func (r *ReleaseResource) Provision(ctx context.Context) error {
 	if err := r.provisionSecrets(); err != nil {
 		return err
 	}
@@ -714,7 +817,7 @@ func (r *ReleaseResource) Provision() error {
 		}
 	}
 	for _, vol := range newVols {
-		if err := vol.waitForAvailable(); err != nil {
+		if err := vol.waitForAvailable(ctx); err != nil {
 			return err
 		}
 	}
@@ -734,7 +837,7 @@ func (r *ReleaseResource) getImageRepos() (repos []*ImageRepoResource, err error
 		repo, err := r.core.ImageRepos().Get(&repoName)
 		if err != nil {
 
-			if isEtcdNotFoundErr(err) {
+			if isNotFoundErr(err) {
 				// if there is no repo, we can assume this is a public repo (though it
 				// may not be) -- this represents a TODO on how to report errors from
 				// Kubernetes
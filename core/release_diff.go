@@ -0,0 +1,182 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+// Effects of a ReleaseChange.
+const (
+	effectRestart = "restart"
+	effectScale   = "scale"
+	effectPorts   = "ports"
+)
+
+// Diff returns what changes when the Component moves from r to other.
+func (r *ReleaseResource) Diff(other *ReleaseResource) *common.ReleaseDiff {
+	d := &releaseDiffer{
+		diff: &common.ReleaseDiff{
+			From:    r.Timestamp,
+			To:      other.Timestamp,
+			Changes: make([]*common.ReleaseChange, 0),
+			Restart: other.restartsFrom(r),
+		},
+	}
+
+	d.compare("instance_group", effectRestart, r.InstanceGroup, other.InstanceGroup)
+	d.compare("instance_count", effectScale, r.InstanceCount, other.InstanceCount)
+	d.compare("termination_grace_period", effectRestart, r.TerminationGracePeriod, other.TerminationGracePeriod)
+	d.diffVolumes(r.Volumes, other.Volumes)
+	d.diffContainers(r.Containers, other.Containers)
+
+	effects := make(map[string]bool)
+	for _, change := range d.diff.Changes {
+		effects[change.Effect] = true
+		if change.Effect == effectRestart && !d.diff.Restart {
+			d.diff.Warnings = append(d.diff.Warnings, fmt.Sprintf("%s will not reach running Instances, since the Releases have the same InstanceGroup", change.Field))
+		}
+	}
+	d.diff.ScaleOnly = len(effects) == 1 && effects[effectScale]
+	d.diff.PortsOnly = len(effects) == 1 && effects[effectPorts]
+	return d.diff
+}
+
+type releaseDiffer struct {
+	diff *common.ReleaseDiff
+}
+
+// compare adds a change to field if from and to differ. A nil from or to is
+// an addition or removal.
+func (d *releaseDiffer) compare(field string, effect string, from interface{}, to interface{}) {
+	if jsonEqual(from, to) {
+		return
+	}
+	change := &common.ReleaseChange{Field: field, Effect: effect}
+	if !isNil(from) {
+		change.From, _ = json.Marshal(from)
+	}
+	if !isNil(to) {
+		change.To, _ = json.Marshal(to)
+	}
+	d.diff.Changes = append(d.diff.Changes, change)
+}
+
+func isNil(v interface{}) bool {
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		return value.IsNil()
+	}
+	return v == nil
+}
+
+func (d *releaseDiffer) diffVolumes(from []*common.VolumeBlueprint, to []*common.VolumeBlueprint) {
+	fromByName := make(map[string]*common.VolumeBlueprint)
+	for _, volume := range from {
+		fromByName[common.StringID(volume.Name)] = volume
+	}
+	toByName := make(map[string]*common.VolumeBlueprint)
+	for _, volume := range to {
+		toByName[common.StringID(volume.Name)] = volume
+	}
+
+	for _, volume := range from {
+		name := common.StringID(volume.Name)
+		d.compare("volumes["+name+"]", effectRestart, volume, toByName[name])
+	}
+	for _, volume := range to {
+		if name := common.StringID(volume.Name); fromByName[name] == nil {
+			d.compare("volumes["+name+"]", effectRestart, (*common.VolumeBlueprint)(nil), volume)
+		}
+	}
+}
+
+// containerKey is the name of a container, or its index when it has none.
+func containerKey(container *common.ContainerBlueprint, i int) string {
+	if container.Name != "" {
+		return container.Name
+	}
+	return strconv.Itoa(i)
+}
+
+func (d *releaseDiffer) diffContainers(from []*common.ContainerBlueprint, to []*common.ContainerBlueprint) {
+	fromByKey := make(map[string]*common.ContainerBlueprint)
+	for i, container := range from {
+		fromByKey[containerKey(container, i)] = container
+	}
+	toByKey := make(map[string]*common.ContainerBlueprint)
+	for i, container := range to {
+		toByKey[containerKey(container, i)] = container
+	}
+
+	for i, container := range from {
+		key := containerKey(container, i)
+		if toByKey[key] == nil {
+			d.compare("containers["+key+"]", effectRestart, container, (*common.ContainerBlueprint)(nil))
+			continue
+		}
+		d.diffContainer("containers["+key+"]", container, toByKey[key])
+	}
+	for i, container := range to {
+		if key := containerKey(container, i); fromByKey[key] == nil {
+			d.compare("containers["+key+"]", effectRestart, (*common.ContainerBlueprint)(nil), container)
+		}
+	}
+}
+
+func (d *releaseDiffer) diffContainer(field string, from *common.ContainerBlueprint, to *common.ContainerBlueprint) {
+	d.compare(field+".image", effectRestart, from.Image, to.Image)
+	d.compare(field+".command", effectRestart, from.Command, to.Command)
+	d.compare(field+".cpu", effectRestart, from.CPU, to.CPU)
+	d.compare(field+".ram", effectRestart, from.RAM, to.RAM)
+	d.compare(field+".mounts", effectRestart, from.Mounts, to.Mounts)
+	d.compare(field+".liveness_probe", effectRestart, from.LivenessProbe, to.LivenessProbe)
+	d.compare(field+".readiness_probe", effectRestart, from.ReadinessProbe, to.ReadinessProbe)
+
+	fromEnv := make(map[string]*common.EnvVar)
+	for _, env := range from.Env {
+		fromEnv[env.Name] = env
+	}
+	toEnv := make(map[string]*common.EnvVar)
+	for _, env := range to.Env {
+		toEnv[env.Name] = env
+	}
+	for _, env := range from.Env {
+		d.compare(field+".env["+env.Name+"]", effectRestart, env, toEnv[env.Name])
+	}
+	for _, env := range to.Env {
+		if fromEnv[env.Name] == nil {
+			d.compare(field+".env["+env.Name+"]", effectRestart, (*common.EnvVar)(nil), env)
+		}
+	}
+
+	// NOTE ports are matched the way AddNewPorts and RemoveOldPorts match them,
+	// so a changed port is a removal and an addition.
+	for _, port := range from.Ports {
+		if !hasPort(to.Ports, port) {
+			d.compare(field+".ports["+portKey(port)+"]", effectPorts, port, (*common.Port)(nil))
+		}
+	}
+	for _, port := range to.Ports {
+		if !hasPort(from.Ports, port) {
+			d.compare(field+".ports["+portKey(port)+"]", effectPorts, (*common.Port)(nil), port)
+		}
+	}
+}
+
+func hasPort(ports []*common.Port, port *common.Port) bool {
+	for _, p := range ports {
+		if samePort(p, port) {
+			return true
+		}
+	}
+	return false
+}
+
+func portKey(port *common.Port) string {
+	return port.Protocol + ":" + strconv.Itoa(port.Number)
+}
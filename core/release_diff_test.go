@@ -0,0 +1,100 @@
+package core
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+func TestReleaseDiff(t *testing.T) {
+	Convey("Given the current Release of a Component", t, func() {
+		core := &Core{db: newDB(newMemoryStore())}
+		app := core.Apps().New()
+		app.Name = common.IDString("test")
+		component := app.Components().New()
+		component.Name = common.IDString("web")
+
+		newRelease := func(timestamp string, instanceGroup string) *ReleaseResource {
+			release := component.Releases().New()
+			release.Timestamp = common.IDString(timestamp)
+			release.InstanceGroup = common.IDString(instanceGroup)
+			release.InstanceCount = 2
+			release.TerminationGracePeriod = 10
+			release.Containers = []*common.ContainerBlueprint{{
+				Name:  "web",
+				Image: "nginx:1.10",
+				Env:   []*common.EnvVar{{Name: "MODE", Value: "a"}},
+				Ports: []*common.Port{{Protocol: "HTTP", Number: 80}},
+			}}
+			return release
+		}
+		current := newRelease("20160412035456", "20160412035456")
+
+		Convey("A Release with a new InstanceGroup should restart the Instances", func() {
+			target := newRelease("20160413035456", "20160413035456")
+			target.InstanceCount = 3
+			target.Containers[0].Image = "nginx:1.11"
+			target.Containers[0].Env = append(target.Containers[0].Env, &common.EnvVar{Name: "DEBUG", Value: "1"})
+
+			diff := current.Diff(target)
+			So(diff.Restart, ShouldBeTrue)
+			So(diff.ScaleOnly, ShouldBeFalse)
+			So(diff.Warnings, ShouldBeEmpty)
+
+			var fields []string
+			for _, change := range diff.Changes {
+				fields = append(fields, change.Field+" "+change.Effect)
+			}
+			So(fields, ShouldResemble, []string{
+				"instance_group restart",
+				"instance_count scale",
+				"containers[web].image restart",
+				"containers[web].env[DEBUG] restart",
+			})
+			So(string(diff.Changes[1].From), ShouldEqual, "2")
+			So(string(diff.Changes[1].To), ShouldEqual, "3")
+			So(diff.Changes[3].From, ShouldBeNil)
+		})
+
+		Convey("A Release in the same InstanceGroup with another count should be scale-only", func() {
+			target := newRelease("20160413035456", "20160412035456")
+			target.InstanceCount = 1
+
+			diff := current.Diff(target)
+			So(diff.Restart, ShouldBeFalse)
+			So(diff.ScaleOnly, ShouldBeTrue)
+			So(diff.PortsOnly, ShouldBeFalse)
+			So(diff.Changes, ShouldHaveLength, 1)
+		})
+
+		Convey("A changed port should be port-only, as a removal and an addition", func() {
+			target := newRelease("20160413035456", "20160412035456")
+			target.Containers[0].Ports[0].Public = true
+
+			diff := current.Diff(target)
+			So(diff.PortsOnly, ShouldBeTrue)
+			So(diff.Changes, ShouldHaveLength, 2)
+			So(diff.Changes[0].Field, ShouldEqual, "containers[web].ports[HTTP:80]")
+			So(diff.Changes[0].To, ShouldBeNil)
+			So(diff.Changes[1].From, ShouldBeNil)
+		})
+
+		Convey("Changes needing a restart in the same InstanceGroup should be warned about", func() {
+			target := newRelease("20160413035456", "20160412035456")
+			target.Containers[0].Env[0].Value = "b"
+
+			diff := current.Diff(target)
+			So(diff.Restart, ShouldBeFalse)
+			So(diff.Warnings, ShouldHaveLength, 1)
+			So(diff.Warnings[0], ShouldStartWith, "containers[web].env[MODE]")
+		})
+
+		Convey("A Release should not differ from itself", func() {
+			diff := current.Diff(current)
+			So(diff.Changes, ShouldBeEmpty)
+			So(diff.ScaleOnly, ShouldBeFalse)
+		})
+	})
+}
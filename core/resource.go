@@ -327,10 +327,10 @@ func copyWithoutNoStoreFields(r Resource) Resource {
 }
 
 // setDefaultFields takes a Resource with a pointer and sets the default value
-// on all fields with the tag sg:"default=something".
+// on all fields with the tag sg:"default=something" that are not set.
 func setDefaultFields(r Resource) {
 	for _, tf := range taggedResourceFieldsOf(r) {
-		if d := tf.Default; d != nil {
+		if d := tf.Default; d != nil && tf.Field.Interface() == reflect.Zero(tf.Field.Type()).Interface() {
 			tf.Field.Set(reflect.ValueOf(d))
 		}
 	}
@@ -339,5 +339,5 @@ func setDefaultFields(r Resource) {
 // validateFields takes a Resource with a pointer and runs a validation on every
 // field with the validate:"..." tag.
 func validateFields(r Resource) error {
-	return validator.Validate(r)
+	return validationErrorOf(r, validator.Validate(r))
 }
@@ -0,0 +1,261 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// store is the storage backend of the database. Keys are slash-separated paths
+// like /components/:app_name/:name, and every value is a marshalled Resource.
+//
+// Every write gives the key a new revision, which is higher than any revision
+// before it. Revisions are used for optimistic concurrency (see
+// database.update).
+//
+// Backends are picked with Core.Store (see newStore), and every Collection
+// works the same on any of them.
+type store interface {
+	// list returns all keys directly under dir, sorted by key.
+	list(dir string) ([]*storeValue, error)
+
+	// listAll returns all keys under dir at any depth, sorted by key.
+	listAll(dir string) ([]*storeValue, error)
+
+	get(key string) (*storeValue, error)
+	create(key string, value string) (revision uint64, err error)
+
+	// update sets key to value. If prevRevision is not 0, it fails if key has
+	// been written since prevRevision.
+	update(key string, value string, prevRevision uint64) (revision uint64, err error)
+
+	delete(key string) error
+
+	// compareAndSwap sets key to value only if it currently holds prevValue.
+	compareAndSwap(key string, prevValue string, value string) (revision uint64, err error)
+
+	// watch returns a storeWatcher for every change to dir, or any key under
+	// it.
+	watch(dir string) storeWatcher
+}
+
+type storeValue struct {
+	Key      string `json:"-"` // set on every value returned by a store
+	Value    string `json:"value"`
+	Revision uint64 `json:"revision"`
+}
+
+// leaseStore is implemented by stores that can be shared by several
+// supergiant-api replicas (i.e. etcd), which then have to elect a leader. See
+// leaderElection.
+type leaseStore interface {
+	// createWithTTL creates a key which expires after ttl, unless refreshed.
+	createWithTTL(key string, value string, ttl time.Duration) error
+
+	// refreshTTL resets the TTL of a key, failing if the key no longer holds
+	// value.
+	refreshTTL(key string, value string, ttl time.Duration) error
+
+	compareAndDelete(key string, prevValue string) error
+}
+
+// batchStore is implemented by stores for which every write has a cost that
+// does not depend on what is written (i.e. fileStore, which rewrites its whole
+// file), so that writing many keys at once can share that cost. See
+// database.batch.
+type batchStore interface {
+	// batch runs fn, making the writes it does durable together once it
+	// returns.
+	batch(fn func() error) error
+}
+
+const (
+	storeEtcd   = "etcd"
+	storeFile   = "file"
+	storeMemory = "memory"
+)
+
+func newStore(c *Core) (store, error) {
+	switch c.Store {
+	case "", storeEtcd:
+		return newEtcdStore(c.EtcdEndpoints), nil
+	case storeFile:
+		return newFileStore(c.StoreFile)
+	case storeMemory:
+		return newMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("Unknown store %s, must be one of %s, %s, %s", c.Store, storeEtcd, storeFile, storeMemory)
+	}
+}
+
+// Errors
+
+const (
+	storeErrKeyNotFound = iota + 1
+	storeErrKeyExists
+	storeErrCompareFailed
+)
+
+// storeError is returned by every store backend for the errors callers need to
+// tell apart. Any other error (e.g. etcd being unreachable) is returned as is.
+type storeError struct {
+	code int
+	key  string
+}
+
+func (e *storeError) Error() string {
+	switch e.code {
+	case storeErrKeyNotFound:
+		return "Key not found: " + e.key
+	case storeErrKeyExists:
+		return "Key already exists: " + e.key
+	default:
+		return "Key has been changed by another write: " + e.key
+	}
+}
+
+func isStoreErr(err error, code int) bool {
+	storeErr, ok := err.(*storeError)
+	return ok && storeErr.code == code
+}
+
+func isNotFoundErr(err error) bool {
+	return isStoreErr(err, storeErrKeyNotFound)
+}
+
+func isKeyExistsErr(err error) bool {
+	return isStoreErr(err, storeErrKeyExists)
+}
+
+func isCompareFailedErr(err error) bool {
+	return isStoreErr(err, storeErrCompareFailed)
+}
+
+// Watching
+
+// storeEvent is a change to a single key. Action uses the etcd names (create,
+// update, compareAndSwap, delete, expire, ...) on every backend.
+type storeEvent struct {
+	Action   string
+	Key      string
+	Value    string
+	Revision uint64 // of the write
+}
+
+type storeWatcher interface {
+	// next blocks until the next event, or until ctx is done.
+	next(ctx context.Context) (*storeEvent, error)
+
+	// close releases the watcher. It must be called once it is no longer used.
+	close()
+}
+
+// watchHub fans out events to the watchers of the in-process stores. Events are
+// queued per watcher, so a slow watcher never blocks writes or misses events.
+type watchHub struct {
+	mu       sync.Mutex
+	watchers map[*hubWatcher]struct{}
+}
+
+type hubWatcher struct {
+	hub *watchHub
+	dir string
+
+	mu     sync.Mutex
+	events []*storeEvent
+	ready  chan struct{}
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{watchers: make(map[*hubWatcher]struct{})}
+}
+
+func (h *watchHub) watch(dir string) storeWatcher {
+	w := &hubWatcher{
+		hub:   h,
+		dir:   strings.TrimSuffix(dir, "/"),
+		ready: make(chan struct{}, 1),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.watchers[w] = struct{}{}
+	return w
+}
+
+func (h *watchHub) emit(action string, key string, value string, revision uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers {
+		if key == w.dir || strings.HasPrefix(key, w.dir+"/") {
+			w.push(&storeEvent{action, key, value, revision})
+		}
+	}
+}
+
+func (h *watchHub) remove(w *hubWatcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.watchers, w)
+}
+
+func (w *hubWatcher) push(event *storeEvent) {
+	w.mu.Lock()
+	w.events = append(w.events, event)
+	w.mu.Unlock()
+
+	select {
+	case w.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (w *hubWatcher) next(ctx context.Context) (*storeEvent, error) {
+	for {
+		w.mu.Lock()
+		if len(w.events) > 0 {
+			event := w.events[0]
+			w.events = w.events[1:]
+			w.mu.Unlock()
+			return event, nil
+		}
+		w.mu.Unlock()
+
+		select {
+		case <-w.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (w *hubWatcher) close() {
+	w.hub.remove(w)
+}
+
+// sortedValuesUnder returns the values of the keys under dir, sorted by key.
+// Unless recursive, only keys directly under dir are returned.
+func sortedValuesUnder(data map[string]*storeValue, dir string, recursive bool) []*storeValue {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	var keys []string
+	for key := range data {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if recursive || !strings.Contains(key[len(prefix):], "/") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	values := make([]*storeValue, len(keys))
+	for i, key := range keys {
+		v := *data[key]
+		v.Key = key
+		values[i] = &v
+	}
+	return values
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"golang.org/x/net/context"
+)
+
+// storeBackends returns a fresh instance of every store that does not need an
+// external service, along with a func to clean up after it.
+func storeBackends() (map[string]store, func()) {
+	dir, err := ioutil.TempDir("", "supergiant-store")
+	if err != nil {
+		panic(err)
+	}
+	fs, err := newFileStore(filepath.Join(dir, "supergiant.db"))
+	if err != nil {
+		panic(err)
+	}
+	return map[string]store{
+		storeMemory: newMemoryStore(),
+		storeFile:   fs,
+	}, func() { os.RemoveAll(dir) }
+}
+
+func TestStores(t *testing.T) {
+	backends, cleanup := storeBackends()
+	defer cleanup()
+
+	for name, s := range backends {
+		s := s
+		Convey("Given an empty "+name+" store", t, func() {
+			Convey("Keys can be created, read, listed, and deleted", func() {
+				rev1, err := s.create("/apps/a", "1")
+				So(err, ShouldBeNil)
+				_, err = s.create("/apps/b", "2")
+				So(err, ShouldBeNil)
+				_, err = s.create("/components/a/web", "3")
+				So(err, ShouldBeNil)
+
+				val, err := s.get("/apps/a")
+				So(err, ShouldBeNil)
+				So(*val, ShouldResemble, storeValue{"/apps/a", "1", rev1})
+
+				vals, err := s.list("/apps")
+				So(err, ShouldBeNil)
+				So(vals, ShouldHaveLength, 2)
+				So(vals[0].Value, ShouldEqual, "1")
+				So(vals[1].Value, ShouldEqual, "2")
+
+				_, err = s.create("/apps/a", "1")
+				So(isKeyExistsErr(err), ShouldBeTrue)
+
+				rev2, err := s.update("/apps/a", "4", 0)
+				So(err, ShouldBeNil)
+				So(rev2, ShouldBeGreaterThan, rev1)
+				_, err = s.update("/apps/c", "4", 0)
+				So(isNotFoundErr(err), ShouldBeTrue)
+
+				_, err = s.update("/apps/a", "5", rev1)
+				So(isCompareFailedErr(err), ShouldBeTrue)
+				rev3, err := s.update("/apps/a", "5", rev2)
+				So(err, ShouldBeNil)
+
+				_, err = s.compareAndSwap("/apps/a", "4", "6")
+				So(isCompareFailedErr(err), ShouldBeTrue)
+				rev4, err := s.compareAndSwap("/apps/a", "5", "6")
+				So(err, ShouldBeNil)
+				So(rev4, ShouldBeGreaterThan, rev3)
+
+				for _, key := range []string{"/apps/a", "/apps/b", "/components/a/web"} {
+					So(s.delete(key), ShouldBeNil)
+				}
+				_, err = s.get("/apps/a")
+				So(isNotFoundErr(err), ShouldBeTrue)
+			})
+
+			Convey("Writes under a watched directory should be emitted as events", func() {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+
+				w := s.watch("/tasks")
+				defer w.close()
+				s.create("/apps/x", "ignored")
+				rev, _ := s.create("/tasks/x", "1")
+				s.delete("/tasks/x")
+				s.delete("/apps/x")
+
+				event, err := w.next(ctx)
+				So(err, ShouldBeNil)
+				So(*event, ShouldResemble, storeEvent{"create", "/tasks/x", "1", rev})
+
+				event, err = w.next(ctx)
+				So(err, ShouldBeNil)
+				So(event.Action, ShouldEqual, "delete")
+			})
+
+			Convey("Collections should work on top of it", func() {
+				core := &Core{db: newDB(s)}
+				action := &Action{ActionName: "delete", ResourceLocation: "/apps/test"}
+
+				task, err := core.Tasks().Start(action)
+				So(err, ShouldBeNil)
+				So(task.Claim(), ShouldBeNil)
+
+				list, err := core.Tasks().List()
+				So(err, ShouldBeNil)
+				So(list.Items, ShouldHaveLength, 1)
+				So(list.Items[0].Status, ShouldEqual, statusRunning)
+
+				So(task.Delete(), ShouldBeNil)
+				_, err = core.Tasks().Get(task.ID)
+				So(isNotFoundErr(err), ShouldBeTrue)
+			})
+		})
+	}
+
+	Convey("Given a file store with data in it", t, func() {
+		dir, err := ioutil.TempDir("", "supergiant-store")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "supergiant.db")
+
+		s, err := newFileStore(path)
+		So(err, ShouldBeNil)
+		revision, err := s.create("/apps/test", "persisted")
+		So(err, ShouldBeNil)
+
+		Convey("The data should survive reopening the file", func() {
+			reopened, err := newFileStore(path)
+			So(err, ShouldBeNil)
+
+			val, err := reopened.get("/apps/test")
+			So(err, ShouldBeNil)
+			So(*val, ShouldResemble, storeValue{"/apps/test", "persisted", revision})
+
+			Convey("Revisions should keep increasing", func() {
+				next, err := reopened.create("/apps/other", "new")
+				So(err, ShouldBeNil)
+				So(next, ShouldBeGreaterThan, revision)
+			})
+		})
+
+		Convey("Writes in a batch should only be saved once it ends", func() {
+			err := s.batch(func() error {
+				s.create("/apps/a", "1")
+				s.create("/apps/b", "2")
+
+				unsaved, err := newFileStore(path)
+				So(err, ShouldBeNil)
+				_, err = unsaved.get("/apps/a")
+				So(isNotFoundErr(err), ShouldBeTrue)
+				return nil
+			})
+			So(err, ShouldBeNil)
+
+			reopened, err := newFileStore(path)
+			So(err, ShouldBeNil)
+			vals, err := reopened.list("/apps")
+			So(err, ShouldBeNil)
+			So(vals, ShouldHaveLength, 3)
+		})
+	})
+}
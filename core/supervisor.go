@@ -1,86 +1,360 @@
 package core
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
+)
 
 const (
-	interval = time.Second
+	// defaultSweepInterval is how often the Supervisor lists all Tasks
+	// regardless of watch events. It is only a safety net for events missed
+	// while the watch was reconnecting.
+	defaultSweepInterval = 30 * time.Second
+
+	// watchRetryInterval is how long the Supervisor waits before re-creating a
+	// Watcher that returned an error.
+	watchRetryInterval = time.Second
 )
 
 type Supervisor struct {
 	core    *Core
 	workers int
+
+	// sweepInterval is how often all Tasks are listed, see
+	// defaultSweepInterval.
+	sweepInterval time.Duration
+
+	// wake is signalled whenever there may be queued Tasks to dispatch. It is
+	// buffered with a size of 1, so that any number of signals received during
+	// a dispatch collapse into a single follow-up dispatch.
+	wake chan struct{}
+
+	// idle holds one token for every worker not currently performing a Task.
+	idle chan struct{}
+
+	// tasks is buffered to the number of workers, so that a claimed Task can
+	// always be sent without blocking the dispatch loop.
+	tasks chan *TaskResource
+
+	// ctx is the context given to Run, i.e. that of the lead. The contexts
+	// Tasks are performed with are derived from it, so that they are cancelled
+	// when leadership is lost.
+	ctx context.Context
+
+	// running maps the ID of every claimed Task to the context it is performed
+	// with.
+	running   map[string]*runningTask
+	runningMu sync.Mutex
+}
+
+type runningTask struct {
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func NewSupervisor(c *Core, workers int) *Supervisor {
-	return &Supervisor{c, workers}
+	s := &Supervisor{
+		core:          c,
+		workers:       workers,
+		sweepInterval: defaultSweepInterval,
+		ctx:           context.Background(),
+		wake:          make(chan struct{}, 1),
+		idle:          make(chan struct{}, workers),
+		tasks:         make(chan *TaskResource, workers),
+		running:       make(map[string]*runningTask),
+	}
+	for i := 0; i < workers; i++ {
+		s.idle <- struct{}{}
+	}
+	return s
 }
 
-func (s *Supervisor) Run() {
+// Run starts the workers and dispatches Tasks until ctx is done. Tasks being
+// performed are cancelled then too, and put back in the queue for the next
+// leader.
+//
+// NOTE a leader that cannot refresh the leader key cancels its Tasks at most a
+// third of the key's TTL after its last refresh, while another replica can
+// only be elected once the key expires, a full TTL after it. Two replicas
+// only perform Tasks at the same time when an Action takes longer than the
+// rest of the TTL to return after its context is cancelled.
+func (s *Supervisor) Run(ctx context.Context) {
+	s.ctx = ctx
+
 	// This starts all workers listening on the channel
-	tasks := make(chan *TaskResource)
 	for i := 0; i < s.workers; i++ {
-		go s.startWorker(tasks)
+		go s.startWorker()
+	}
+	s.loop(ctx)
+}
+
+// loop watches the Task directory and dispatches queued Tasks every time it is
+// woken up by a watch event, a finished worker, or the periodic sweep.
+func (s *Supervisor) loop(ctx context.Context) {
+	// NOTE loop is the only sender on tasks, so closing it here lets workers
+	// drain what was already claimed, and then exit.
+	defer close(s.tasks)
+
+	go s.watch(ctx)
+	go s.sweep(ctx)
+
+	s.signal() // pick up anything queued before we started watching
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+			s.dispatch()
+		}
+	}
+}
+
+// signal wakes the dispatch loop without blocking.
+func (s *Supervisor) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default: // a wake-up is already pending
 	}
+}
 
-	// loop every <interval> seconds
-	for _ = range time.NewTicker(interval).C {
+func (s *Supervisor) sweep(ctx context.Context) {
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.signal()
+		}
+	}
+}
 
-		list, err := s.core.Tasks().List()
+func (s *Supervisor) watch(ctx context.Context) {
+	for {
+		err := s.watchTasks(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		Log.Errorf("Supervisor error when watching Tasks: %s", err)
+
+		// NOTE the watch may have missed events while broken (e.g. when etcd
+		// clears the event index), so we also sweep once we are back.
+		time.Sleep(watchRetryInterval)
+		s.signal()
+	}
+}
+
+// watchTasks wakes the Supervisor for queued Tasks, and cancels the Tasks
+// marked CANCELLING, until the watch fails or ctx is done.
+func (s *Supervisor) watchTasks(ctx context.Context) error {
+	watcher := s.core.db.watch(s.core.Tasks().(Collection))
+	defer watcher.close()
+	for {
+		event, err := watcher.next(ctx)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
-		// Find first queued task, or return.
-		// Claim task and return if claim fails.
-		var task *TaskResource
+		task := new(common.Task)
+		if err := json.Unmarshal([]byte(event.Value), task); err != nil {
+			continue // deletes and expirations have no value
+		}
+		switch task.Status {
+		case statusQueued:
+			s.signal()
+		case statusCancelling:
+			s.cancel(common.StringID(task.ID))
+		}
+	}
+}
 
-		for _, j := range list.Items {
-			if j.IsQueued() {
-				task = j
-				break
+// dispatch claims queued Tasks and hands them to workers until either there
+// are no more queued Tasks or no more idle workers.
+func (s *Supervisor) dispatch() {
+	list, err := s.core.Tasks().List()
+	if err != nil {
+		Log.Errorf("Supervisor error when listing Tasks: %s", err)
+		return
+	}
+
+	for _, task := range list.Items {
+		if task.IsCancelling() && !s.isRunning(task) {
+			// The worker performing this Task is gone (e.g. the Supervisor was
+			// restarted), so there is nothing left to interrupt.
+			if err := task.RecordCancellation(errors.New("Task cancelled while not running")); err != nil {
+				Log.Error(err)
 			}
+			continue
 		}
-		if task == nil {
+
+		if !task.IsQueued() {
 			continue
 		}
 
+		select {
+		case <-s.idle:
+		default:
+			return // all workers are busy; a finishing worker will wake us again
+		}
+
 		if err := task.Claim(); err != nil {
 			// NOTE should be a CompareAndSwap error if anything
 			Log.Error(err)
+			s.idle <- struct{}{}
 			continue
 		}
 
-		// NOTE since this is not using a buffered channel, this will block if all
-		// workers are busy, which I think should be the expected behavior.
-		tasks <- task
+		// NOTE the Task is tracked as soon as it is claimed, so that it is never
+		// mistaken for an orphaned Task above before a worker picks it up.
+		s.track(task)
+		s.tasks <- task
 	}
 }
 
-func (s *Supervisor) startWorker(tasks <-chan *TaskResource) {
-	for task := range tasks {
-		// recover from panic, capture error and report
-		defer func() {
-			if err := recover(); err != nil {
-				recordError(task, err.(error))
-			}
-		}()
+func (s *Supervisor) startWorker() {
+	for task := range s.tasks {
+		s.perform(task)
 
-		action := task.ToAction().initialize(s.core)
+		s.idle <- struct{}{}
+		s.signal()
+	}
+}
 
-		Log.Infof("Starting Task %s : %s", action.ActionName, action.ResourceLocation)
-		if err := action.Perform(); err != nil {
+func (s *Supervisor) perform(task *TaskResource) {
+	ctx := s.track(task)
+	defer s.untrack(task)
+
+	// NOTE Tasks claimed before leadership was lost may still be handed to
+	// workers.
+	if s.ctx.Err() != nil {
+		s.release(task)
+		return
+	}
+
+	var action *Action
+	started := time.Now()
+
+	// recover from panic, capture error and report
+	defer func() {
+		if r := recover(); r != nil {
+			err := panicError(r)
+			if action != nil {
+				s.core.auditTask(action, AuditResultFailed, err)
+				taskDuration.observe(time.Since(started).Seconds(), action.ActionName, AuditResultFailed)
+			}
 			recordError(task, err)
-			continue
 		}
+	}()
+
+	action = task.ToAction()
+	action.initialize(s.core)
 
-		Log.Infof("Completed Task %s : %s", action.ActionName, action.ResourceLocation)
-		task.Delete() // Task is successful, delete from Queue
+	Log.Infof("Starting Task %s : %s", action.ActionName, action.ResourceLocation)
+	s.core.auditTask(action, AuditResultStarted, nil)
+	taskAttempts.inc(action.ActionName)
+	if err := action.Perform(ctx); err != nil {
+		if s.ctx.Err() != nil {
+			s.release(task)
+			return
+		}
+		if ctx.Err() != nil {
+			s.core.auditTask(action, AuditResultCancelled, err)
+			taskDuration.observe(time.Since(started).Seconds(), action.ActionName, AuditResultCancelled)
+			if err := task.RecordCancellation(err); err != nil {
+				Log.Error(err)
+			}
+			return
+		}
+		s.core.auditTask(action, AuditResultFailed, err)
+		taskDuration.observe(time.Since(started).Seconds(), action.ActionName, AuditResultFailed)
+		recordError(task, err)
+		return
 	}
+
+	Log.Infof("Completed Task %s : %s", action.ActionName, action.ResourceLocation)
+	s.core.auditTask(action, AuditResultSucceeded, nil)
+	taskDuration.observe(time.Since(started).Seconds(), action.ActionName, AuditResultSucceeded)
+	task.Delete() // Task is successful, delete from Queue
 }
 
-// Record error, and panic if that goes wrong
+// track returns the context the Task is performed with, creating it the first
+// time the Task is tracked.
+func (s *Supervisor) track(task *TaskResource) context.Context {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	id := common.StringID(task.ID)
+	if rt, ok := s.running[id]; ok {
+		return rt.ctx
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.running[id] = &runningTask{ctx, cancel}
+	return ctx
+}
+
+func (s *Supervisor) untrack(task *TaskResource) {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	id := common.StringID(task.ID)
+	if rt, ok := s.running[id]; ok {
+		rt.cancel()
+		delete(s.running, id)
+	}
+}
+
+// release puts a Task interrupted by the loss of leadership back in the queue,
+// for the next leader to perform.
+func (s *Supervisor) release(task *TaskResource) {
+	Log.Infof("Releasing Task %s after losing leadership", common.StringID(task.ID))
+	if err := task.Release(); err != nil {
+		Log.Errorf("Could not release Task %s: %s", common.StringID(task.ID), err)
+	}
+}
+
+// cancel cancels the context of the Task with the given ID, if it is being
+// performed by this Supervisor.
+func (s *Supervisor) cancel(id string) {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	if rt, ok := s.running[id]; ok {
+		Log.Infof("Cancelling Task %s", id)
+		rt.cancel()
+	}
+}
+
+func (s *Supervisor) isRunning(task *TaskResource) bool {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	_, ok := s.running[common.StringID(task.ID)]
+	return ok
+}
+
+// recordError records the error of an attempt at a Task. Since it is also
+// called from the recover of a worker, it only logs any failure to do so,
+// including a panic (e.g. on ActionData that cannot be decoded), so that it
+// cannot crash the process.
 func recordError(task *TaskResource, err error) {
-	if uberErr := task.RecordError(err); uberErr != nil {
-		panic(uberErr)
+	defer func() {
+		if r := recover(); r != nil {
+			Log.Errorf("Could not record error of Task %s: %s", common.StringID(task.ID), panicError(r))
+		}
+	}()
+	if recordErr := task.RecordError(err); recordErr != nil {
+		Log.Errorf("Could not record error of Task %s: %s", common.StringID(task.ID), recordErr)
+	}
+}
+
+// panicError returns the value recovered from a panic as an error.
+func panicError(r interface{}) error {
+	if err, ok := r.(error); ok {
+		return err
 	}
+	return fmt.Errorf("%v", r)
 }
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/supergiant/supergiant/common"
+	"github.com/supergiant/supergiant/core/mock"
+	"golang.org/x/net/context"
+)
+
+func queuedTaskJSON(id string) string {
+	return fmt.Sprintf(`{
+		"id": "%s",
+		"action_data": "{}",
+		"max_attempts": 10,
+		"status": "QUEUED",
+		"created": "Tue, 12 Apr 2016 03:54:56 UTC",
+		"updated": null,
+		"tags": {}
+	}`, id)
+}
+
+// fakeTaskStore backs the FakeEtcd GetFn with a list of Task values that can be
+// changed while the Supervisor is running.
+type fakeTaskStore struct {
+	sync.Mutex
+	vals []string
+}
+
+func (s *fakeTaskStore) add(val string) {
+	s.Lock()
+	defer s.Unlock()
+	s.vals = append(s.vals, val)
+}
+
+func (s *fakeTaskStore) get() (*etcd.Response, error) {
+	s.Lock()
+	defer s.Unlock()
+	var nodes []*etcd.Node
+	for _, val := range s.vals {
+		nodes = append(nodes, &etcd.Node{Value: val})
+	}
+	return &etcd.Response{Node: &etcd.Node{Dir: true, Nodes: nodes}}, nil
+}
+
+func TestSupervisorDispatchFromWatch(t *testing.T) {
+	Convey("Given a running Supervisor with an empty Task queue", t, func() {
+		store := new(fakeTaskStore)
+		watcher := mock.NewFakeWatcher()
+
+		fakeEtcd := new(mock.FakeEtcd).ReturnOnWatcher(watcher).OnSet(func(key string, val string) error {
+			return nil
+		})
+		fakeEtcd.GetFn = store.get
+
+		core := newMockCore(fakeEtcd)
+		s := NewSupervisor(core, 4)
+		s.sweepInterval = time.Hour // only the watch should wake the Supervisor
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go s.loop(ctx)
+
+		Convey("When a queued Task is written to etcd", func() {
+			val := queuedTaskJSON("test")
+			store.add(val)
+
+			started := time.Now()
+			watcher.Emit("create", "/supergiant/tasks/test", val)
+
+			Convey("It should be claimed and dispatched well before the sweep interval", func() {
+				var task *TaskResource
+				select {
+				case task = <-s.tasks:
+				case <-time.After(time.Second):
+				}
+
+				So(task, ShouldNotBeNil)
+				So(*task.ID, ShouldEqual, "test")
+				So(time.Since(started), ShouldBeLessThan, 500*time.Millisecond)
+			})
+		})
+	})
+}
+
+func TestSupervisorDispatchFillsIdleWorkers(t *testing.T) {
+	Convey("Given a Supervisor with 4 idle workers and 6 queued Tasks", t, func() {
+		store := new(fakeTaskStore)
+		for i := 0; i < 6; i++ {
+			store.add(queuedTaskJSON(fmt.Sprintf("task-%d", i)))
+		}
+
+		claimed := 0
+		fakeEtcd := new(mock.FakeEtcd).OnSet(func(key string, val string) error {
+			claimed++
+			return nil
+		})
+		fakeEtcd.GetFn = store.get
+
+		core := newMockCore(fakeEtcd)
+		s := NewSupervisor(core, 4)
+
+		Convey("When dispatch() is called once", func() {
+			s.dispatch()
+
+			Convey("Every idle worker should receive a claimed Task", func() {
+				So(claimed, ShouldEqual, 4)
+				So(len(s.tasks), ShouldEqual, 4)
+				So(len(s.idle), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestSupervisorCancelFromWatch(t *testing.T) {
+	Convey("Given a Supervisor performing a claimed Task", t, func() {
+		watcher := mock.NewFakeWatcher()
+		fakeEtcd := new(mock.FakeEtcd).ReturnOnWatcher(watcher)
+
+		core := newMockCore(fakeEtcd)
+		s := NewSupervisor(core, 1)
+		go s.watch(context.Background())
+
+		task := core.Tasks().New()
+		task.ID = common.IDString("test")
+		ctx := s.track(task)
+
+		Convey("When the Task is marked CANCELLING in etcd", func() {
+			watcher.Emit("compareAndSwap", "/supergiant/tasks/test", `{"id":"test","status":"CANCELLING"}`)
+
+			Convey("The context of the Task should be cancelled", func() {
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+				So(ctx.Err(), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestSupervisorPerformPanics(t *testing.T) {
+	Convey("Given a Task on its last attempt, whose ActionData cannot be decoded", t, func() {
+		core := &Core{db: newDB(newMemoryStore())}
+		task := core.Tasks().New()
+		task.ID = common.IDString("test")
+		task.ActionData = "not json"
+		task.MaxAttempts = 1
+		task.Attempts = 1
+		task.Status = statusRunning
+		So(core.Tasks().Create(task), ShouldBeNil)
+
+		s := NewSupervisor(core, 1)
+
+		Convey("Performing it should not panic, even though recording its error does", func() {
+			So(func() { s.perform(task) }, ShouldNotPanic)
+			So(s.isRunning(task), ShouldBeFalse)
+		})
+	})
+
+	Convey("Values recovered from a panic should be turned into errors", t, func() {
+		err := errors.New("broken")
+		So(panicError(err), ShouldEqual, err)
+		So(panicError("broken").Error(), ShouldEqual, "broken")
+		So(panicError(42).Error(), ShouldEqual, "42")
+	})
+}
+
+func TestSupervisorLosingLeadership(t *testing.T) {
+	Convey("Given a Supervisor run with the context of a lead", t, func() {
+		core := &Core{db: newDB(newMemoryStore())}
+		task, err := core.Tasks().Start(&Action{ActionName: "delete", ResourceLocation: "/apps/test"})
+		So(err, ShouldBeNil)
+		So(task.Claim(), ShouldBeNil)
+
+		s := NewSupervisor(core, 1)
+		lead, cancel := context.WithCancel(context.Background())
+		s.ctx = lead
+
+		Convey("Losing leadership should cancel the Tasks being performed", func() {
+			ctx := s.track(task)
+			cancel()
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			So(ctx.Err(), ShouldNotBeNil)
+		})
+
+		Convey("A Task performed after leadership is lost should be put back in the queue", func() {
+			cancel()
+			s.perform(task)
+
+			latest, err := core.Tasks().Get(task.ID)
+			So(err, ShouldBeNil)
+			So(latest.Status, ShouldEqual, statusQueued)
+			So(latest.Attempts, ShouldEqual, 0)
+		})
+	})
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/supergiant/supergiant/common"
@@ -9,6 +10,7 @@ import (
 
 type TasksInterface interface {
 	List() (*TaskList, error)
+	ListWithOptions(*ListOptions) (*TaskList, error)
 	New() *TaskResource
 	Start(*Action) (*TaskResource, error)
 	Create(*TaskResource) error
@@ -31,13 +33,16 @@ type TaskResource struct {
 // NOTE this does not inherit from common like model does; all we need is a List
 // object, internally, that has a slice of our composed model above.
 type TaskList struct {
-	Items []*TaskResource `json:"items"`
+	Items    []*TaskResource `json:"items"`
+	Continue string          `json:"continue,omitempty"`
 }
 
 const (
-	statusQueued  = "QUEUED"
-	statusRunning = "RUNNING"
-	statusFailed  = "FAILED"
+	statusQueued     = "QUEUED"
+	statusRunning    = "RUNNING"
+	statusCancelling = "CANCELLING"
+	statusFailed     = "FAILED"
+	statusCancelled  = "CANCELLED"
 )
 
 // initializeResource implements the Collection interface.
@@ -49,8 +54,13 @@ func (c *TaskCollection) initializeResource(in Resource) {
 
 // List returns an TaskList.
 func (c *TaskCollection) List() (*TaskList, error) {
+	return c.ListWithOptions(nil)
+}
+
+// ListWithOptions returns a TaskList with opts applied (see ListOptions).
+func (c *TaskCollection) ListWithOptions(opts *ListOptions) (*TaskList, error) {
 	list := new(TaskList)
-	err := c.core.db.list(c, list)
+	err := c.core.db.list(c, list, opts)
 	return list, err
 }
 
@@ -215,35 +225,141 @@ func (r *TaskResource) IsQueued() bool {
 	return r.Status == statusQueued
 }
 
+// IsCancelling returns true if cancellation of the Task has been requested.
+func (r *TaskResource) IsCancelling() bool {
+	return r.Status == statusCancelling
+}
+
 // Claim updates the Task status to "RUNNING" and returns nil. compareAndSwap is
 // used to prevent a race condition and ensure only one worker performs the task.
 func (r *TaskResource) Claim() error {
+	return r.swapStatus(statusRunning)
+}
+
+// Release puts a claimed Task back in the queue, without counting an attempt.
+func (r *TaskResource) Release() error {
+	return r.swapStatus(statusQueued)
+}
+
+// Cancel requests cancellation of the Task. A queued Task is cancelled right
+// away. A running Task is marked "CANCELLING", which the Supervisor picks up
+// through its watch in order to cancel the context of the running Action.
+func (r *TaskResource) Cancel() error {
+	switch r.Status {
+	case statusQueued:
+		// NOTE we swap the status first, so that the Task can not be claimed
+		// while we are moving it.
+		if err := r.swapStatus(statusCancelling); err != nil {
+			return err
+		}
+		r.Status = statusCancelling
+		return r.RecordCancellation(errors.New("Task cancelled before it started"))
+
+	case statusRunning:
+		if err := r.swapStatus(statusCancelling); err != nil {
+			return err
+		}
+		r.Status = statusCancelling
+		return nil
+
+	case statusCancelling:
+		return nil // already requested
+
+	default:
+		return fmt.Errorf("Cannot cancel Task with status %s", r.Status)
+	}
+}
+
+// swapStatus updates the Task status through compareAndSwap, so that it fails
+// if the Task has changed since it was loaded.
+func (r *TaskResource) swapStatus(status string) error {
 	// NOTE we de-ref the task because the DB will strip the ID (maybe a TODO)
 	prev := *r
 
 	// NOTE we have to do this instead of the above, because nested pointers are
 	// not de-referenced.
 	t := *r.Task
-	t.Status = statusRunning
+	t.Status = status
 	next := &TaskResource{Task: &t}
 
 	return r.core.db.compareAndSwap(r.collection.(Collection), r.ID, &prev, next)
 }
 
+// abortError is returned by Actions that gave up in a way retrying would not
+// fix, such as a blue-green deploy whose new Instances never became ready.
+type abortError struct {
+	error
+}
+
+// RecordError saves the error of the latest attempt on the Task, and puts the
+// Task back in the queue. Once the Task has exceeded MaxAttempts, or the
+// Action aborted, it is moved to FailedTasks, freeing up the Action to be run
+// again.
 func (r *TaskResource) RecordError(err error) error {
 	Log.Error(err)
 
-	r.Error = err.Error()
-	if r.Attempts < r.MaxAttempts {
-		r.Status = statusQueued // Add back to queue for retry
-	} else {
-		// TODO ideally we should save these to see failure.
-		// However, with the resource ID scheme, it means actions cannot be repeated
-		// r.Status = statusFailed
-		Log.Error("Deleting failed Task")
-		return r.Delete()
+	r.appendError(err)
+
+	if _, aborted := err.(abortError); aborted || r.Attempts >= r.MaxAttempts {
+		Log.Error("Moving failed Task to FailedTasks")
+		taskFailures.inc(r.ToAction().ActionName)
+		return r.fail(statusFailed)
 	}
+
+	r.Status = statusQueued // Add back to queue for retry
 	r.Attempts++
 
-	return r.Update()
+	updateErr := r.Update()
+	if !IsConflictErr(updateErr) {
+		return updateErr
+	}
+
+	// The Task has changed since it was claimed, which only happens when its
+	// cancellation was requested.
+	latest, getErr := r.collection.Get(r.ID)
+	if getErr != nil {
+		return getErr
+	}
+	if !latest.IsCancelling() {
+		return updateErr
+	}
+	return latest.RecordCancellation(err)
+}
+
+// RecordCancellation saves the error the Action returned when cancelled, and
+// moves the Task to FailedTasks with the status "CANCELLED".
+func (r *TaskResource) RecordCancellation(err error) error {
+	Log.Warnf("Task %s cancelled: %s", common.StringID(r.ID), err)
+
+	r.appendError(err)
+	return r.fail(statusCancelled)
+}
+
+func (r *TaskResource) appendError(err error) {
+	r.Error = err.Error()
+	r.Errors = append(r.Errors, &common.TaskError{
+		Attempt:   r.Attempts + 1,
+		Error:     r.Error,
+		Timestamp: common.NewTimestamp(),
+	})
+}
+
+func (r *TaskResource) fail(status string) error {
+	action := r.ToAction()
+
+	failed := r.core.FailedTasks().New()
+	failed.ID = newFailedTaskID(r)
+	failed.TaskID = r.ID
+	failed.ActionName = action.ActionName
+	failed.ResourceLocation = action.ResourceLocation
+	failed.ActionData = r.ActionData
+	failed.MaxAttempts = r.MaxAttempts
+	failed.Attempts = r.Attempts + 1
+	failed.Errors = r.Errors
+	failed.Status = status
+
+	if err := r.core.FailedTasks().Create(failed); err != nil {
+		return err
+	}
+	return r.Delete()
 }
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/supergiant/common"
+	"github.com/supergiant/supergiant/core/mock"
+)
+
+const testActionData = `{"resource_location":"/apps/test","action_name":"delete"}`
+
+func TestTaskRecordError(t *testing.T) {
+	Convey("Given a running Task", t, func() {
+		etcdKeyCreated := ""
+		etcdValCreated := ""
+		etcdKeyDeleted := ""
+		etcdValUpdated := ""
+
+		fakeEtcd := new(mock.FakeEtcd).OnCreate(func(key string, val string) error {
+			etcdKeyCreated = key
+			etcdValCreated = val
+			return nil
+		}).OnDelete(func(key string) error {
+			etcdKeyDeleted = key
+			return nil
+		}).OnUpdate(func(key string, val string) error {
+			etcdValUpdated = val
+			return nil
+		})
+
+		core := newMockCore(fakeEtcd)
+		task := core.Tasks().New()
+		task.ID = common.IDString("test")
+		task.ActionData = testActionData
+		task.MaxAttempts = 2
+		task.Status = statusRunning
+
+		Convey("When RecordError() is called before MaxAttempts is reached", func() {
+			err := task.RecordError(errors.New("first"))
+
+			Convey("The Task should be requeued with the error of the attempt", func() {
+				So(err, ShouldBeNil)
+				So(task.Status, ShouldEqual, statusQueued)
+				So(task.Attempts, ShouldEqual, 1)
+				So(task.Errors, ShouldHaveLength, 1)
+				So(task.Errors[0].Error, ShouldEqual, "first")
+				So(etcdValUpdated, ShouldContainSubstring, `"errors"`)
+				So(etcdKeyDeleted, ShouldEqual, "")
+			})
+		})
+
+		Convey("When RecordError() is called with an aborted Action before MaxAttempts is reached", func() {
+			err := task.RecordError(abortError{errors.New("aborted")})
+
+			Convey("The Task should be moved to FailedTasks without retrying", func() {
+				So(err, ShouldBeNil)
+				So(etcdKeyDeleted, ShouldEqual, "/supergiant/tasks/test")
+				So(strings.HasPrefix(etcdKeyCreated, "/supergiant/failed_tasks/test-"), ShouldBeTrue)
+				So(etcdValCreated, ShouldContainSubstring, `"aborted"`)
+			})
+		})
+
+		Convey("When RecordError() is called once MaxAttempts is reached", func() {
+			task.Attempts = 2
+			task.Errors = []*common.TaskError{
+				{Attempt: 1, Error: "first"},
+				{Attempt: 2, Error: "second"},
+			}
+
+			err := task.RecordError(errors.New("third"))
+
+			Convey("The Task should be moved to FailedTasks with every error", func() {
+				So(err, ShouldBeNil)
+				So(etcdKeyDeleted, ShouldEqual, "/supergiant/tasks/test")
+				So(strings.HasPrefix(etcdKeyCreated, "/supergiant/failed_tasks/test-"), ShouldBeTrue)
+
+				failed := new(common.FailedTask)
+				So(json.Unmarshal([]byte(etcdValCreated), failed), ShouldBeNil)
+				So(*failed.TaskID, ShouldEqual, "test")
+				So(failed.Status, ShouldEqual, statusFailed)
+				So(failed.ActionName, ShouldEqual, "delete")
+				So(failed.ResourceLocation, ShouldEqual, "/apps/test")
+				So(failed.Attempts, ShouldEqual, 3)
+				So(failed.Errors, ShouldHaveLength, 3)
+				So(failed.Errors[2].Error, ShouldEqual, "third")
+			})
+		})
+	})
+}
+
+func TestFailedTaskRetry(t *testing.T) {
+	Convey("Given a FailedTask", t, func() {
+		etcdKeyCreated := ""
+		etcdKeyDeleted := ""
+
+		fakeEtcd := new(mock.FakeEtcd).OnCreate(func(key string, val string) error {
+			etcdKeyCreated = key
+			return nil
+		}).OnDelete(func(key string) error {
+			etcdKeyDeleted = key
+			return nil
+		})
+
+		core := newMockCore(fakeEtcd)
+		failed := core.FailedTasks().New()
+		failed.ID = common.IDString("test-1")
+		failed.TaskID = common.IDString("test")
+		failed.ActionData = testActionData
+
+		Convey("When Retry() is called", func() {
+			task, err := failed.Retry()
+
+			Convey("A new queued Task should be created for the Action, and the FailedTask deleted", func() {
+				So(err, ShouldBeNil)
+				So(task.Status, ShouldEqual, statusQueued)
+				So(etcdKeyCreated, ShouldEqual, "/supergiant/tasks/"+common.StringID(task.ID))
+				So(etcdKeyDeleted, ShouldEqual, "/supergiant/failed_tasks/test-1")
+			})
+		})
+
+		Convey("When Retry() is called while a Task for the Action already exists", func() {
+			fakeEtcd.OnCreate(func(key string, val string) error {
+				return errors.New("Key already exists")
+			})
+
+			_, err := failed.Retry()
+
+			Convey("An error should be returned and the FailedTask kept", func() {
+				So(err, ShouldNotBeNil)
+				So(etcdKeyDeleted, ShouldEqual, "")
+			})
+		})
+	})
+}
+
+func TestTaskCancel(t *testing.T) {
+	Convey("Given a Task", t, func() {
+		etcdValSet := ""
+		etcdKeyCreated := ""
+		etcdValCreated := ""
+		etcdKeyDeleted := ""
+
+		fakeEtcd := new(mock.FakeEtcd).OnSet(func(key string, val string) error {
+			etcdValSet = val
+			return nil
+		}).OnCreate(func(key string, val string) error {
+			etcdKeyCreated = key
+			etcdValCreated = val
+			return nil
+		}).OnDelete(func(key string) error {
+			etcdKeyDeleted = key
+			return nil
+		})
+
+		core := newMockCore(fakeEtcd)
+		task := core.Tasks().New()
+		task.ID = common.IDString("test")
+		task.ActionData = testActionData
+		task.MaxAttempts = 10
+
+		Convey("When Cancel() is called on a running Task", func() {
+			task.Status = statusRunning
+			err := task.Cancel()
+
+			Convey("The Task should be marked CANCELLING for the Supervisor to pick up", func() {
+				So(err, ShouldBeNil)
+				So(task.Status, ShouldEqual, statusCancelling)
+				So(etcdValSet, ShouldContainSubstring, `"status":"CANCELLING"`)
+				So(etcdKeyDeleted, ShouldEqual, "")
+			})
+		})
+
+		Convey("When Cancel() is called on a queued Task", func() {
+			task.Status = statusQueued
+			err := task.Cancel()
+
+			Convey("The Task should be moved to FailedTasks as CANCELLED", func() {
+				So(err, ShouldBeNil)
+				So(etcdKeyDeleted, ShouldEqual, "/supergiant/tasks/test")
+				So(strings.HasPrefix(etcdKeyCreated, "/supergiant/failed_tasks/test-"), ShouldBeTrue)
+				So(etcdValCreated, ShouldContainSubstring, `"status":"CANCELLED"`)
+			})
+		})
+	})
+}
@@ -0,0 +1,213 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/supergiant/supergiant/common"
+)
+
+type UsersInterface interface {
+	List() (*UserList, error)
+	ListWithOptions(*ListOptions) (*UserList, error)
+	New() *UserResource
+	Create(*UserResource) error
+	Get(common.ID) (*UserResource, error)
+	Update(common.ID, *UserResource) error
+	Patch(common.ID, *UserResource) error
+	Delete(*UserResource) error
+}
+
+type UserCollection struct {
+	core *Core
+}
+
+type UserResource struct {
+	core       *Core
+	collection UsersInterface
+	*common.User
+}
+
+type UserList struct {
+	Items    []*UserResource `json:"items"`
+	Continue string          `json:"continue,omitempty"`
+}
+
+// initializeResource implements the Collection interface.
+func (c *UserCollection) initializeResource(in Resource) {
+	r := in.(*UserResource)
+	r.collection = c
+	r.core = c.core
+}
+
+// List returns a UserList.
+func (c *UserCollection) List() (*UserList, error) {
+	return c.ListWithOptions(nil)
+}
+
+// ListWithOptions returns an UserList with opts applied (see ListOptions).
+func (c *UserCollection) ListWithOptions(opts *ListOptions) (*UserList, error) {
+	list := new(UserList)
+	err := c.core.db.list(c, list, opts)
+	return list, err
+}
+
+// New initializes a User with a pointer to the Collection.
+func (c *UserCollection) New() *UserResource {
+	r := &UserResource{
+		User: &common.User{
+			Roles: make([]*common.RoleBinding, 0),
+			Meta:  common.NewMeta(),
+		},
+	}
+	c.initializeResource(r)
+	return r
+}
+
+// Create takes a User and creates it in etcd. The Password, if given, is
+// stored hashed. The name supervisor is reserved for the Principal of the
+// service token (and the Actor of its audit entries).
+func (c *UserCollection) Create(r *UserResource) error {
+	if common.StringID(r.Name) == auditActorSupervisor {
+		return &ValidationError{Fields: []*common.FieldError{{Path: "name", Error: "is reserved"}}}
+	}
+	if err := prepareUser(r); err != nil {
+		return err
+	}
+	return c.core.db.create(c, r.Name, r)
+}
+
+// Get takes a name and returns a UserResource if it exists.
+func (c *UserCollection) Get(name common.ID) (*UserResource, error) {
+	r := c.New()
+	if err := c.core.db.get(c, name, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Update updates the User in etcd, replacing its Roles outright.
+func (c *UserCollection) Update(name common.ID, r *UserResource) error {
+	if err := prepareUser(r); err != nil {
+		return err
+	}
+	return c.core.db.update(c, name, r)
+}
+
+// Patch partially updates the User in etcd. The password is only changed if a
+// new Password is given.
+//
+// NOTE Roles are merged like any other field, so an empty list keeps the
+// stored Roles. Use Update to remove them.
+func (c *UserCollection) Patch(name common.ID, r *UserResource) error {
+	if err := prepareUser(r); err != nil {
+		return err
+	}
+	return c.core.db.patch(c, name, r)
+}
+
+// Delete deletes the User in etcd, along with its APITokens.
+func (c *UserCollection) Delete(r *UserResource) error {
+	tokens, err := c.core.APITokens().List()
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens.Items {
+		if token.User == nil || *token.User != *r.Name {
+			continue
+		}
+		if err := token.Delete(); err != nil {
+			return err
+		}
+	}
+	return c.core.db.delete(c, r.Name)
+}
+
+// prepareUser checks the Roles of a User, and replaces its Password with a
+// hash of it.
+func prepareUser(r *UserResource) error {
+	for _, binding := range r.Roles {
+		if _, ok := roleRanks[binding.Role]; !ok {
+			return fmt.Errorf("Invalid role %q, must be one of admin, deployer, viewer", binding.Role)
+		}
+	}
+	if r.Password == "" {
+		return nil
+	}
+	hash, err := hashPassword(r.Password)
+	if err != nil {
+		return err
+	}
+	r.PasswordHash = hash
+	r.Password = ""
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// Key implements the Locatable interface.
+func (c *UserCollection) locationKey() string {
+	return "users"
+}
+
+// Parent implements the Locatable interface. It returns nil here because Core
+// is the parent, and it is the root, which we exclude from paths.
+func (c *UserCollection) parent() (l Locatable) {
+	return
+}
+
+// Child implements the Locatable interface.
+func (c *UserCollection) child(key string) Locatable {
+	user, err := c.Get(common.IDString(key))
+	if err != nil {
+		panic(fmt.Errorf("No child with key %s for %T", key, c))
+	}
+	return user
+}
+
+// Key implements the Locatable interface.
+func (r *UserResource) locationKey() string {
+	return common.StringID(r.Name)
+}
+
+// Parent implements the Locatable interface.
+func (r *UserResource) parent() Locatable {
+	return r.collection.(Locatable)
+}
+
+// Child implements the Locatable interface.
+func (r *UserResource) child(key string) (l Locatable) {
+	switch key {
+	default:
+		panic(fmt.Errorf("No child with key %s for %T", key, r))
+	}
+}
+
+// Action implements the Resource interface.
+func (r *UserResource) Action(name string) *Action {
+	switch name {
+	default:
+		panic(fmt.Errorf("No action %s for User", name))
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// decorate implements the Resource interface
+func (r *UserResource) decorate() (err error) {
+	return
+}
+
+// Update is a proxy method to UserCollection's Update.
+func (r *UserResource) Update() error {
+	return r.collection.Update(r.Name, r)
+}
+
+// Patch is a proxy method to collection Patch.
+func (r *UserResource) Patch() error {
+	return r.collection.Patch(r.Name, r)
+}
+
+// Delete is a proxy method to UserCollection's Delete.
+func (r *UserResource) Delete() error {
+	return r.collection.Delete(r)
+}
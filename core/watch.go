@@ -0,0 +1,140 @@
+package core
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
+)
+
+// watchLocations maps the etcd directory of a nested Collection to the
+// Collections of its location in the API, whose IDs make up the rest of the
+// key. For example, /releases/:app_name/:component_name/:timestamp is at
+// /apps/:app_name/components/:component_name/releases/:timestamp.
+var watchLocations = map[string][]string{
+	"components": {"apps", "components"},
+	"releases":   {"apps", "components", "releases"},
+	"repos":      {"registries", "repos"},
+}
+
+// watchHidden are the stored Collections that are not in the API.
+var watchHidden = map[string]bool{
+	"failed_tasks": true,
+}
+
+// Watcher streams the changes to the Resources at a location, and under it.
+type Watcher struct {
+	db       *database
+	location string
+	store    storeWatcher
+}
+
+// Watch returns a Watcher for location, an API path such as /apps/search (or /
+// for everything). Close must be called once it is no longer used.
+//
+// NOTE with etcd, changes are only watched from the first call to Next on, so
+// changes made right after Watch returns may be missed.
+//
+// NOTE Resources of a location can be stored in several etcd directories
+// (Components of an App are under /components/:app_name), so the whole store
+// is watched, and events elsewhere are skipped.
+func (c *Core) Watch(location string) *Watcher {
+	return &Watcher{
+		db:       c.db,
+		location: path.Clean("/" + location),
+		store:    c.db.store.watch(""),
+	}
+}
+
+// Close releases the Watcher.
+func (w *Watcher) Close() {
+	w.store.close()
+}
+
+// Next blocks until the next change, or until ctx is done.
+func (w *Watcher) Next(ctx context.Context) (*common.WatchEvent, error) {
+	for {
+		storeEvent, err := w.store.next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		event, err := watchEventOf(storeEvent)
+		if err != nil {
+			Log.Errorf("Could not watch %s: %s", storeEvent.Key, err)
+			continue
+		}
+		if event == nil || !isLocationUnder(event.Location, w.location) {
+			continue
+		}
+		return event, nil
+	}
+}
+
+// watchEventOf converts a change to a stored record, returning nil for keys
+// that are not Resources in the API.
+func watchEventOf(storeEvent *storeEvent) (*common.WatchEvent, error) {
+	collection := recordCollection(storeEvent.Key)
+	recordType, ok := recordTypes[collection]
+	if !ok || watchHidden[collection] {
+		return nil, nil
+	}
+
+	ids := strings.Split(storeEvent.Key, "/")[2:]
+	collections, nested := watchLocations[collection]
+	if !nested {
+		collections = []string{collection}
+	}
+	if len(ids) != len(collections) {
+		return nil, nil
+	}
+	location := ""
+	for i, id := range ids {
+		location += "/" + collections[i] + "/" + id
+	}
+
+	event := &common.WatchEvent{
+		Kind:     reflect.TypeOf(recordType).Name(),
+		Location: location,
+	}
+	switch storeEvent.Action {
+	case "create":
+		event.Type = "created"
+	case "delete", "compareAndDelete", "expire":
+		event.Type = "deleted"
+		return event, nil
+	default: // set, update, compareAndSwap
+		event.Type = "updated"
+	}
+
+	_, record, err := migrateRecord(collection, storeEvent.Value)
+	if err != nil {
+		return nil, err
+	}
+	record, err = mapPrivateFields(collection, record, func(string, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// NOTE this leaves out schema_version, and orders fields as in responses.
+	resource := reflect.New(reflect.TypeOf(recordType)).Interface()
+	if err := json.Unmarshal([]byte(record), resource); err != nil {
+		return nil, err
+	}
+	if meta := reflect.ValueOf(resource).Elem().FieldByName("Meta"); meta.IsValid() && !meta.IsNil() {
+		meta.Elem().FieldByName("Revision").SetString(strconv.FormatUint(storeEvent.Revision, 10))
+	}
+	if event.Resource, err = json.Marshal(resource); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// isLocationUnder returns true if location is dir, or under it.
+func isLocationUnder(location string, dir string) bool {
+	return dir == "/" || location == dir || strings.HasPrefix(location, dir+"/")
+}
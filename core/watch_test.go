@@ -0,0 +1,92 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
+)
+
+func TestWatch(t *testing.T) {
+	Convey("Given a Watcher of an App", t, func() {
+		core := &Core{db: newDB(newMemoryStore())}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		watcher := core.Watch("/apps/test")
+		defer watcher.Close()
+
+		Convey("Closing it should release it from the store", func() {
+			hub := core.db.store.(*memoryStore).hub
+			So(hub.watchers, ShouldHaveLength, 1)
+			watcher.Close()
+			So(hub.watchers, ShouldBeEmpty)
+		})
+
+		Convey("Changes to the App and its Components should be events, with their API location", func() {
+			_, err := core.db.store.create("/apps/test", `{"name":"test","tags":{}}`)
+			So(err, ShouldBeNil)
+			_, err = core.db.store.create("/apps/other", `{"name":"other","tags":{}}`)
+			So(err, ShouldBeNil)
+
+			app := core.Apps().New()
+			app.Name = common.IDString("test")
+			component := app.Components().New()
+			component.Name = common.IDString("web")
+			So(app.Components().Create(component), ShouldBeNil)
+			So(core.db.store.delete("/components/test/web"), ShouldBeNil)
+
+			event, err := watcher.Next(ctx)
+			So(err, ShouldBeNil)
+			So(event.Type, ShouldEqual, "created")
+			So(event.Kind, ShouldEqual, "App")
+			So(event.Location, ShouldEqual, "/apps/test")
+			So(string(event.Resource), ShouldContainSubstring, `"name":"test"`)
+			So(string(event.Resource), ShouldNotContainSubstring, "schema_version")
+
+			event, err = watcher.Next(ctx)
+			So(err, ShouldBeNil)
+			So(event.Type, ShouldEqual, "created")
+			So(event.Kind, ShouldEqual, "Component")
+			So(event.Location, ShouldEqual, "/apps/test/components/web")
+			So(string(event.Resource), ShouldContainSubstring, `"revision":"`+component.Revision+`"`)
+
+			event, err = watcher.Next(ctx)
+			So(err, ShouldBeNil)
+			So(event.Type, ShouldEqual, "deleted")
+			So(event.Location, ShouldEqual, "/apps/test/components/web")
+			So(event.Resource, ShouldBeNil)
+		})
+
+		Convey("It should stop when its context is done", func() {
+			cancel()
+			_, err := watcher.Next(ctx)
+			So(err, ShouldEqual, context.Canceled)
+		})
+	})
+
+	Convey("Given a Watcher of everything", t, func() {
+		core := &Core{db: newDB(newMemoryStore())}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		watcher := core.Watch("/")
+		defer watcher.Close()
+
+		Convey("Private fields should be left out of events", func() {
+			repo := core.ImageRepos().New()
+			repo.Name = common.IDString("private")
+			repo.Key = "secret-key"
+			So(core.ImageRepos().Create(repo), ShouldBeNil)
+
+			event, err := watcher.Next(ctx)
+			So(err, ShouldBeNil)
+			So(event.Kind, ShouldEqual, "ImageRepo")
+			So(event.Location, ShouldEqual, "/registries/dockerhub/repos/private")
+			So(string(event.Resource), ShouldNotContainSubstring, "secret-key")
+		})
+	})
+}
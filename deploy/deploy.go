@@ -1,11 +1,20 @@
 package deploy
 
 import (
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/supergiant/supergiant/client"
+	"github.com/supergiant/supergiant/common"
+	"golang.org/x/net/context"
 )
 
-func Deploy(appName *string, componentName *string) error {
-	sg := client.New("http://localhost:8080/v0", "", "", true)
+// Deploy rolls the Component from its current Release to its target Release,
+// replacing as many Instances at a time as its RollingOptions allow, and
+// failing as soon as an Instance fails to start or stop. It stops early,
+// returning ctx.Err(), when ctx is cancelled.
+func Deploy(ctx context.Context, sg *client.Client, appName *string, componentName *string) error {
 
 	app, err := sg.Apps().Get(appName)
 	if err != nil {
@@ -36,18 +45,14 @@ func Deploy(appName *string, componentName *string) error {
 	}
 	targetInstances := targetList.Items
 
+	opts := component.Rolling
+	if opts == nil {
+		opts = new(common.RollingOptions)
+	}
+	minReady := time.Duration(opts.MinReadySeconds) * time.Second
+
 	if currentRelease == nil { // first release
-		for _, instance := range targetInstances {
-			if err = instance.Start(); err != nil {
-				return err
-			}
-		}
-		for _, instance := range targetInstances {
-			if err = instance.WaitForStarted(); err != nil {
-				return err
-			}
-		}
-		return nil
+		return startAll(ctx, targetInstances, minReady)
 	}
 
 	currentList, err := currentRelease.Instances().List()
@@ -59,24 +64,14 @@ func Deploy(appName *string, componentName *string) error {
 	// remove instances
 	if currentRelease.InstanceCount > targetRelease.InstanceCount {
 		instancesRemoving := currentRelease.InstanceCount - targetRelease.InstanceCount
-		for _, instance := range currentInstances[len(currentInstances)-instancesRemoving:] {
-			if err := instance.Stop(); err != nil {
-				return err
-			}
+		if err := stopAll(ctx, currentInstances[len(currentInstances)-instancesRemoving:]); err != nil {
+			return err
 		}
 		// add new instances
 	} else if currentRelease.InstanceCount < targetRelease.InstanceCount {
 		instancesAdding := targetRelease.InstanceCount - currentRelease.InstanceCount
-		newInstances := targetInstances[len(targetInstances)-instancesAdding:]
-		for _, instance := range newInstances {
-			if err := instance.Start(); err != nil {
-				return err
-			}
-		}
-		for _, instance := range newInstances {
-			if err := instance.WaitForStarted(); err != nil {
-				return err
-			}
+		if err := startAll(ctx, targetInstances[len(targetInstances)-instancesAdding:], minReady); err != nil {
+			return err
 		}
 	}
 
@@ -97,16 +92,141 @@ func Deploy(appName *string, componentName *string) error {
 		instancesRestarting = targetRelease.InstanceCount
 	}
 
-	for i := 0; i < instancesRestarting; i++ {
+	// An Instance shares its volumes with the one replacing it, so it has to be
+	// stopped first.
+	maxSurge := opts.MaxSurge
+	if len(targetRelease.Volumes) > 0 {
+		maxSurge = 0
+	}
+	maxUnavailable := opts.MaxUnavailable
+	if maxUnavailable == 0 && maxSurge == 0 {
+		maxUnavailable = 1
+	}
+
+	return roll(ctx, instancesRestarting, maxUnavailable, maxSurge, func(i int, startFirst bool) error {
 		currentInstance := currentInstances[i]
 		targetInstance := targetInstances[i]
 
-		currentInstance.Stop()
-		currentInstance.WaitForStopped()
+		if startFirst {
+			if err := startAll(ctx, []*client.InstanceResource{targetInstance}, minReady); err != nil {
+				return err
+			}
+			return stopAll(ctx, []*client.InstanceResource{currentInstance})
+		}
+		if err := stopAll(ctx, []*client.InstanceResource{currentInstance}); err != nil {
+			return err
+		}
+		return startAll(ctx, []*client.InstanceResource{targetInstance}, minReady)
+	})
+}
+
+// roll calls replace for the indexes of the n Instances being replaced, with
+// up to maxUnavailable of them stopping the old Instance first, and up to
+// maxSurge starting the new one first, at a time. Once a replacement fails, no
+// more are started, and the error is returned when those running are done.
+func roll(ctx context.Context, n int, maxUnavailable int, maxSurge int, replace func(i int, startFirst bool) error) error {
+	unavailable := make(chan struct{}, maxUnavailable)
+	surge := make(chan struct{}, maxSurge)
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+
+	var err error
+	for i := 0; i < n && err == nil; i++ {
+		// NOTE a send on a channel without capacity never proceeds, so a zero
+		// maxSurge or maxUnavailable is never picked.
+		var slots chan struct{}
+		select {
+		case err = <-errs:
+			continue
+		case <-ctx.Done():
+			err = ctx.Err()
+			continue
+		case surge <- struct{}{}:
+			slots = surge
+		case unavailable <- struct{}{}:
+			slots = unavailable
+		}
+
+		// NOTE a failed replacement sends its error before freeing its slot.
+		select {
+		case err = <-errs:
+			<-slots
+			continue
+		default:
+		}
+		if err = ctx.Err(); err != nil {
+			<-slots
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, slots chan struct{}) {
+			defer wg.Done()
+			if err := replace(i, slots == surge); err != nil {
+				errs <- err
+			}
+			<-slots
+		}(i, slots)
+	}
+	wg.Wait()
+
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	return err
+}
 
-		targetInstance.Start()
-		targetInstance.WaitForStarted()
+// startAll starts the Instances, and waits for all of them to be ready, i.e.
+// started, and still started without restarting minReady later.
+func startAll(ctx context.Context, instances []*client.InstanceResource, minReady time.Duration) error {
+	for _, instance := range instances {
+		if err := instance.Start(); err != nil {
+			return err
+		}
+	}
+	for _, instance := range instances {
+		if err := instance.WaitForStarted(ctx); err != nil {
+			return err
+		}
+	}
+	if minReady == 0 {
+		return nil
 	}
 
+	restarts := make([]int, len(instances))
+	for i, instance := range instances {
+		restarts[i] = instance.Restarts
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(minReady):
+	}
+	for i, instance := range instances {
+		if err := instance.Reload(); err != nil {
+			return err
+		}
+		if instance.Status != common.InstanceStatusStarted || instance.Restarts > restarts[i] {
+			return fmt.Errorf("Instance %s did not stay started for %s", instance.Name, minReady)
+		}
+	}
+	return nil
+}
+
+// stopAll stops the Instances, and waits for all of them to be stopped.
+func stopAll(ctx context.Context, instances []*client.InstanceResource) error {
+	for _, instance := range instances {
+		if err := instance.Stop(); err != nil {
+			return err
+		}
+	}
+	for _, instance := range instances {
+		if err := instance.WaitForStopped(ctx); err != nil {
+			return err
+		}
+	}
 	return nil
 }
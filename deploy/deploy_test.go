@@ -0,0 +1,79 @@
+package deploy
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"golang.org/x/net/context"
+)
+
+func TestRoll(t *testing.T) {
+	Convey("Given Instances replaced by roll", t, func() {
+		var mu sync.Mutex
+		var replaced []int
+		var running, maxRunning, surging, maxSurging int
+
+		replace := func(i int, startFirst bool) error {
+			mu.Lock()
+			replaced = append(replaced, i)
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			if startFirst {
+				surging++
+				if surging > maxSurging {
+					maxSurging = surging
+				}
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			if startFirst {
+				surging--
+			}
+			mu.Unlock()
+			return nil
+		}
+
+		Convey("Up to maxUnavailable should be replaced at a time", func() {
+			err := roll(context.Background(), 5, 2, 0, replace)
+			So(err, ShouldBeNil)
+			So(replaced, ShouldHaveLength, 5)
+			So(maxRunning, ShouldEqual, 2)
+			So(maxSurging, ShouldEqual, 0)
+		})
+
+		Convey("Up to maxSurge more should start the new Instance first", func() {
+			err := roll(context.Background(), 6, 1, 2, replace)
+			So(err, ShouldBeNil)
+			So(replaced, ShouldHaveLength, 6)
+			So(maxRunning, ShouldEqual, 3)
+			So(maxSurging, ShouldEqual, 2)
+		})
+
+		Convey("No more should be replaced once one fails", func() {
+			err := roll(context.Background(), 5, 1, 0, func(i int, startFirst bool) error {
+				replace(i, startFirst)
+				return errors.New("Instance did not start")
+			})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Instance did not start")
+			So(replaced, ShouldResemble, []int{0})
+		})
+
+		Convey("No more should be replaced once ctx is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			err := roll(ctx, 5, 1, 0, replace)
+			So(err, ShouldEqual, context.Canceled)
+		})
+	})
+}
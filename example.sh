@@ -1,21 +1,21 @@
-curl -XPOST localhost:8080/v0/registries/dockerhub/repos -d '{
+curl -u "admin:$ADMIN_PASSWORD" -XPOST localhost:8080/v0/registries/dockerhub/repos -d '{
   "name": "qbox",
   "key": "'$QBOX_DOCKERHUB_KEY'"
 }' || true
 
-curl -XPOST localhost:8080/v0/entrypoints -d '{
+curl -u "admin:$ADMIN_PASSWORD" -XPOST localhost:8080/v0/entrypoints -d '{
   "domain": "example.com"
 }' || true
 
-curl -XPOST localhost:8080/v0/apps -d '{
+curl -u "admin:$ADMIN_PASSWORD" -XPOST localhost:8080/v0/apps -d '{
   "name": "test"
 }'
 
-curl -XPOST localhost:8080/v0/apps/test/components -d '{
+curl -u "admin:$ADMIN_PASSWORD" -XPOST localhost:8080/v0/apps/test/components -d '{
   "name": "elasticsearch"
 }'
 
-curl -XPOST localhost:8080/v0/apps/test/components/elasticsearch/releases -d '{
+curl -u "admin:$ADMIN_PASSWORD" -XPOST localhost:8080/v0/apps/test/components/elasticsearch/releases -d '{
   "instance_count": 1,
   "termination_grace_period": 10,
   "volumes": [
@@ -110,4 +110,4 @@ curl -XPOST localhost:8080/v0/apps/test/components/elasticsearch/releases -d '{
   ]
 }'
 
-curl -XPOST localhost:8080/v0/apps/test/components/elasticsearch/deploy
+curl -u "admin:$ADMIN_PASSWORD" -XPOST localhost:8080/v0/apps/test/components/elasticsearch/deploy
@@ -3,6 +3,8 @@ package main
 import (
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/codegangsta/cli"
 	"github.com/supergiant/supergiant/api"
@@ -17,6 +19,8 @@ func main() {
 
 	c := new(core.Core)
 
+	var listenAddr, tlsCert, tlsKey, tlsClientCA string
+
 	app.Action = func(ctx *cli.Context) {
 
 		core.SetLogLevel(ctx.String("log-level"))
@@ -34,23 +38,177 @@ func main() {
 		}
 
 		c.EtcdEndpoints = ctx.StringSlice("etcd-hosts")
+		c.PreviousEncryptionKeys = ctx.StringSlice("previous-encryption-key")
 		if len(c.EtcdEndpoints) < 0 {
 			c.EtcdEndpoints = []string{"http://etcd:2379"}
 		}
 
 		// Log args that have default values.
+		core.Log.Info("Store,", c.Store)
 		core.Log.Info("ETCD hosts,", c.EtcdEndpoints)
 		core.Log.Info("Kubernetes Host,", c.K8sHost)
 
-		c.Initialize()
+		if (tlsCert == "") != (tlsKey == "") {
+			core.Log.Error("Both --tls-cert and --tls-key are required to serve HTTPS")
+			os.Exit(5)
+		}
+		if tlsClientCA != "" && tlsCert == "" {
+			core.Log.Error("--tls-client-ca requires --tls-cert and --tls-key")
+			os.Exit(5)
+		}
 
 		router := api.NewRouter(c)
+		c.APIHandler = router
+
+		c.Initialize()
+
+		// Give up leadership on shutdown, so another replica can take over the
+		// Supervisor and capacity service right away.
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-sigs
+			core.Log.Info("Shutting down")
+			c.Shutdown()
+			os.Exit(0)
+		}()
+
+		server := &http.Server{Addr: listenAddr, Handler: router}
+
+		if tlsCert == "" {
+			core.Log.Info("Serving API on ", listenAddr)
+			core.Log.Info(server.ListenAndServe())
+			return
+		}
+
+		certs, err := api.NewTLSCertificates(tlsCert, tlsKey, tlsClientCA)
+		if err != nil {
+			core.Log.Error(err)
+			os.Exit(5)
+		}
+		server.TLSConfig = certs.Config()
+
+		// Renewed certificates are picked up on SIGHUP.
+		hups := make(chan os.Signal, 1)
+		signal.Notify(hups, syscall.SIGHUP)
+		go func() {
+			for range hups {
+				if err := certs.Reload(); err != nil {
+					core.Log.Errorf("Could not reload TLS certificates, keeping the current ones: %s", err)
+					continue
+				}
+				core.Log.Info("Reloaded TLS certificates")
+			}
+		}()
 
-		core.Log.Info("Serving API on port :8080")
-		core.Log.Info(http.ListenAndServe(":8080", router))
+		if tlsClientCA != "" {
+			core.Log.Info("Serving API with HTTPS (client certificates required) on ", listenAddr)
+		} else {
+			core.Log.Info("Serving API with HTTPS on ", listenAddr)
+		}
+		core.Log.Info(server.ListenAndServeTLS("", ""))
+	}
+
+	app.Commands = []cli.Command{
+		{
+			Name:  "migrate",
+			Usage: "Upgrade all stored records to the current schema version, then exit.",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Print the upgraded records instead of saving them.",
+				},
+			},
+			Action: func(ctx *cli.Context) {
+				core.SetLogLevel(ctx.GlobalString("log-level"))
+				c.EtcdEndpoints = ctx.GlobalStringSlice("etcd-hosts")
+				c.PreviousEncryptionKeys = ctx.GlobalStringSlice("previous-encryption-key")
+
+				if err := c.Migrate(os.Stdout, ctx.Bool("dry-run")); err != nil {
+					core.Log.Error(err)
+					os.Exit(1)
+				}
+			},
+		},
+		{
+			Name:  "rotate-key",
+			Usage: "Re-encrypt the private fields of all stored records with --encryption-key, then exit. The old key must be given with --previous-encryption-key.",
+			Action: func(ctx *cli.Context) {
+				core.SetLogLevel(ctx.GlobalString("log-level"))
+				c.EtcdEndpoints = ctx.GlobalStringSlice("etcd-hosts")
+				c.PreviousEncryptionKeys = ctx.GlobalStringSlice("previous-encryption-key")
+
+				if err := c.RotateEncryptionKey(os.Stdout); err != nil {
+					core.Log.Error(err)
+					os.Exit(1)
+				}
+			},
+		},
 	}
 
 	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:        "store",
+			Value:       "etcd",
+			Usage:       "Storage backend, one of etcd, file (a single local file, see --store-file), or memory (lost on restart).",
+			EnvVar:      "STORE",
+			Destination: &c.Store,
+		},
+		cli.StringFlag{
+			Name:        "store-file",
+			Value:       "supergiant.db",
+			Usage:       "Path of the data file when using the file store.",
+			EnvVar:      "STORE_FILE",
+			Destination: &c.StoreFile,
+		},
+		cli.StringFlag{
+			Name:        "encryption-key",
+			Usage:       "Base64-encoded 32 byte key used to encrypt private fields (such as ImageRepo keys) in the store.",
+			EnvVar:      "ENCRYPTION_KEY",
+			Destination: &c.EncryptionKey,
+		},
+		cli.StringFlag{
+			Name:        "encryption-key-file",
+			Usage:       "Path of a file holding the encryption key, instead of --encryption-key.",
+			EnvVar:      "ENCRYPTION_KEY_FILE",
+			Destination: &c.EncryptionKeyFile,
+		},
+		cli.StringSliceFlag{
+			Name:   "previous-encryption-key",
+			Usage:  "Keys private fields may still be encrypted with, while rotating keys (see the rotate-key command).",
+			EnvVar: "PREVIOUS_ENCRYPTION_KEYS",
+		},
+		cli.StringFlag{
+			Name:        "listen",
+			Value:       ":8080",
+			Usage:       "Address to serve the API on.",
+			EnvVar:      "LISTEN_ADDR",
+			Destination: &listenAddr,
+		},
+		cli.StringFlag{
+			Name:        "tls-cert",
+			Usage:       "Path of a PEM certificate (chain) to serve the API with HTTPS. Reloaded on SIGHUP.",
+			EnvVar:      "TLS_CERT",
+			Destination: &tlsCert,
+		},
+		cli.StringFlag{
+			Name:        "tls-key",
+			Usage:       "Path of the PEM private key of --tls-cert.",
+			EnvVar:      "TLS_KEY",
+			Destination: &tlsKey,
+		},
+		cli.StringFlag{
+			Name:        "tls-client-ca",
+			Usage:       "Path of PEM CA certificates; when given, clients must present a certificate signed by one of them.",
+			EnvVar:      "TLS_CLIENT_CA",
+			Destination: &tlsClientCA,
+		},
+		cli.StringFlag{
+			Name:        "admin-password",
+			Usage:       "Create the admin User (an install-wide admin) with this password, or reset its password.",
+			EnvVar:      "ADMIN_PASSWORD",
+			Destination: &c.AdminPassword,
+		},
 		cli.StringSliceFlag{
 			Name:   "etcd-hosts",
 			Usage:  "Array of etcd hosts.",